@@ -0,0 +1,234 @@
+// Package archive persists chat sessions, metadata and transcript, to
+// Postgres through the supabase package, so conversations survive the
+// expiry or deletion of their session.
+//
+// An Archiver archives sessions on demand, when they are closed, and, once
+// started, shortly after every change reported by a store implementing
+// session.Notifier. Expired or deleted sessions can no longer be read, so
+// their last snapshot is what remains; the Archiver then records how they
+// ended. A session deleted or expired within the snapshot delay of its
+// creation has no snapshot, so nothing of it is archived, its end included;
+// archive sessions with Close to keep them all:
+//
+//	archiver := archive.New(store, supabaseClient)
+//	if err := archiver.Start(); err != nil {
+//		return err
+//	}
+//	defer archiver.Stop()
+//
+//	// When the conversation is over
+//	err = archiver.Close(ctx, sessionID)
+package archive
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/supabase"
+)
+
+// Default delay between a session change and its snapshot
+const defaultSnapshotDelay = 5 * time.Second
+
+// End reasons recorded for archived sessions
+const (
+	ReasonClosed  = "closed"  // Closed with Archiver.Close
+	ReasonDeleted = "deleted" // Deleted from the store
+	ReasonExpired = "expired" // Expired in the store
+)
+
+// ErrEventsUnsupported is returned by Start if the store does not emit
+// lifecycle events.
+var ErrEventsUnsupported = errors.New("session store does not implement session.Notifier")
+
+// Option is a functional option for configuring an Archiver.
+type Option func(*Archiver)
+
+// WithSnapshotDelay sets how long after a change a session is snapshotted
+// (default: 5 seconds). Further changes within the delay are included in the
+// same snapshot. Keep it well below the session TTL: changes made within the
+// delay before a session expires are not archived.
+func WithSnapshotDelay(delay time.Duration) Option {
+	return func(a *Archiver) {
+		a.delay = delay
+	}
+}
+
+// WithErrorHandler sets a function called with the errors of archiving in
+// the background, which are otherwise dropped.
+func WithErrorHandler(handler func(sessionID string, err error)) Option {
+	return func(a *Archiver) {
+		a.onError = handler
+	}
+}
+
+// Archiver archives sessions of a store to a supabase.SessionArchive.
+// Writes are idempotent by session ID and version, so several instances
+// may archive the same sessions.
+type Archiver struct {
+	store   session.Store
+	archive supabase.SessionArchive
+	delay   time.Duration
+	onError func(sessionID string, err error)
+
+	mu          sync.Mutex
+	pending     map[string]*time.Timer // Scheduled snapshots by session ID
+	unsubscribe func()
+}
+
+// New creates an Archiver for the sessions of store.
+func New(store session.Store, archive supabase.SessionArchive, opts ...Option) *Archiver {
+	a := &Archiver{
+		store:   store,
+		archive: archive,
+		delay:   defaultSnapshotDelay,
+		onError: func(string, error) {},
+		pending: make(map[string]*time.Timer),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Archive stores a snapshot of a session.
+// Reading the session refreshes its TTL, like any Get.
+// Returns session.ErrNotFound if the session does not exist.
+func (a *Archiver) Archive(ctx context.Context, id string) error {
+	data, err := a.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return session.ErrNotFound
+	}
+	return a.archive.ArchiveSession(ctx, archived(data))
+}
+
+// Close archives a finished session, records it as closed and deletes it
+// from the store.
+// Returns session.ErrNotFound if the session does not exist.
+func (a *Archiver) Close(ctx context.Context, id string) error {
+	if err := a.Archive(ctx, id); err != nil {
+		return err
+	}
+	if err := a.archive.EndArchivedSession(ctx, id, ReasonClosed, time.Now()); err != nil {
+		return err
+	}
+	return a.store.Delete(ctx, id)
+}
+
+// Start subscribes to the store's lifecycle events: sessions are
+// snapshotted after they change, and their end is recorded when they are
+// deleted or expire. Changes made since the last snapshot of a session
+// that is deleted or expires are lost, as it can no longer be read.
+// Returns ErrEventsUnsupported if the store does not emit events.
+func (a *Archiver) Start() error {
+	notifier, ok := a.store.(session.Notifier)
+	if !ok {
+		return ErrEventsUnsupported
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.unsubscribe == nil {
+		a.unsubscribe = notifier.Subscribe(a.handle)
+	}
+	return nil
+}
+
+// Stop unsubscribes from the store's events and cancels scheduled snapshots.
+func (a *Archiver) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.unsubscribe != nil {
+		a.unsubscribe()
+		a.unsubscribe = nil
+	}
+	for id, timer := range a.pending {
+		timer.Stop()
+		delete(a.pending, id)
+	}
+}
+
+// handle handles a lifecycle event. It returns quickly, archiving on timer
+// goroutines.
+func (a *Archiver) handle(event session.Event) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.unsubscribe == nil {
+		return // Stopped
+	}
+
+	switch event.Type {
+	case session.EventCreated, session.EventUpdated:
+		if _, scheduled := a.pending[event.ID]; !scheduled {
+			a.pending[event.ID] = time.AfterFunc(a.delay, func() {
+				a.snapshot(event.ID)
+			})
+		}
+	case session.EventDeleted, session.EventExpired:
+		if timer, scheduled := a.pending[event.ID]; scheduled {
+			timer.Stop()
+			delete(a.pending, event.ID)
+		}
+		reason := ReasonDeleted
+		if event.Type == session.EventExpired {
+			reason = ReasonExpired
+		}
+		go a.end(event.ID, reason, event.Time)
+	}
+}
+
+// snapshot archives a session whose snapshot was scheduled.
+func (a *Archiver) snapshot(id string) {
+	a.mu.Lock()
+	delete(a.pending, id)
+	a.mu.Unlock()
+
+	err := a.Archive(context.Background(), id)
+	if err != nil && !errors.Is(err, session.ErrNotFound) {
+		a.onError(id, err)
+	}
+}
+
+// end records the end of a session.
+func (a *Archiver) end(id, reason string, at time.Time) {
+	if err := a.archive.EndArchivedSession(context.Background(), id, reason, at); err != nil {
+		a.onError(id, err)
+	}
+}
+
+// archived converts a session to its archived form.
+func archived(data *session.SessionData) *supabase.ArchivedSession {
+	messages := make([]supabase.ArchivedMessage, len(data.ConversationHistory))
+	for i, msg := range data.ConversationHistory {
+		messages[i] = supabase.ArchivedMessage{
+			Role:       msg.Role,
+			Content:    msg.Content,
+			TokenCount: msg.TokenCount,
+			Timestamp:  msg.Timestamp,
+		}
+	}
+
+	return &supabase.ArchivedSession{
+		SessionID:    data.ID,
+		Version:      data.Version,
+		TenantID:     data.TenantID,
+		AssistantID:  data.AssistantID,
+		UserID:       data.UserID,
+		Language:     data.Language,
+		SystemPrompt: data.SystemPrompt,
+		Config:       data.Config,
+		Messages:     messages,
+		MessageCount: len(messages),
+		CreatedAt:    data.CreatedAt,
+		UpdatedAt:    data.UpdatedAt,
+		ArchivedAt:   time.Now(),
+	}
+}
@@ -0,0 +1,325 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/drivers"
+	"github.com/creastat/storage/supabase"
+)
+
+// testDelay is the snapshot delay of the tests.
+const testDelay = 20 * time.Millisecond
+
+// fakeArchive records the writes made to a supabase.SessionArchive, and
+// reports each one on ops, where basicStore also reports deletes.
+type fakeArchive struct {
+	ops chan string
+	err error // Returned by every write, if set
+
+	mu        sync.Mutex
+	snapshots map[string]*supabase.ArchivedSession
+	ends      map[string]time.Time
+}
+
+func newFakeArchive() *fakeArchive {
+	return &fakeArchive{
+		ops:       make(chan string, 100),
+		snapshots: make(map[string]*supabase.ArchivedSession),
+		ends:      make(map[string]time.Time),
+	}
+}
+
+func (f *fakeArchive) ArchiveSession(ctx context.Context, s *supabase.ArchivedSession) error {
+	f.ops <- fmt.Sprintf("archive %s v%d", s.SessionID, s.Version)
+	if f.err != nil {
+		return f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.snapshots[s.SessionID] = s
+	return nil
+}
+
+func (f *fakeArchive) EndArchivedSession(ctx context.Context, sessionID, reason string, at time.Time) error {
+	f.ops <- fmt.Sprintf("end %s %s", sessionID, reason)
+	if f.err != nil {
+		return f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ended := f.ends[sessionID]; !ended {
+		f.ends[sessionID] = at
+	}
+	return nil
+}
+
+// expect checks that the next operations are want, in order.
+func (f *fakeArchive) expect(t *testing.T, want ...string) {
+	t.Helper()
+	for _, op := range want {
+		select {
+		case got := <-f.ops:
+			if got != op {
+				t.Fatalf("operation = %q, want %q", got, op)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no operation, want %q", op)
+		}
+	}
+}
+
+// expectNone checks that no operation happens within a few snapshot delays.
+func (f *fakeArchive) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-f.ops:
+		t.Fatalf("unexpected operation %q", got)
+	case <-time.After(5 * testDelay):
+	}
+}
+
+// basicStore hides the optional interfaces of a store, and reports its
+// deletes on ops.
+type basicStore struct {
+	session.Store
+	ops chan string
+}
+
+func (s basicStore) Delete(ctx context.Context, id string) error {
+	s.ops <- "delete " + id
+	return s.Store.Delete(ctx, id)
+}
+
+// testClock is a clock moved forward by the tests.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestArchiver returns a started Archiver of a memory store on clock,
+// and its fake archive.
+func newTestArchiver(t *testing.T, opts ...Option) (*Archiver, *drivers.InMemoryStore, *fakeArchive, *testClock) {
+	t.Helper()
+	clock := &testClock{now: time.Now()}
+	store := drivers.NewInMemoryStore(drivers.WithMemoryTTL(time.Hour), drivers.WithJanitorInterval(0),
+		drivers.WithClock(clock.Now))
+	t.Cleanup(func() { store.Close() })
+
+	archive := newFakeArchive()
+	archiver := New(store, archive, append([]Option{WithSnapshotDelay(testDelay)}, opts...)...)
+	if err := archiver.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(archiver.Stop)
+	return archiver, store, archive, clock
+}
+
+// pendingCount returns the number of scheduled snapshots.
+func (a *Archiver) pendingCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.pending)
+}
+
+func TestStartUnsupported(t *testing.T) {
+	store := drivers.NewInMemoryStore()
+	t.Cleanup(func() { store.Close() })
+
+	archiver := New(basicStore{Store: store}, newFakeArchive())
+	if err := archiver.Start(); !errors.Is(err, ErrEventsUnsupported) {
+		t.Errorf("Start() = %v, want ErrEventsUnsupported", err)
+	}
+}
+
+func TestSnapshotAfterChanges(t *testing.T) {
+	_, store, archive, _ := newTestArchiver(t)
+	ctx := context.Background()
+
+	data := &session.SessionData{ID: "a", TenantID: "t1", Language: "en"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	data.Language = "fr"
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendMessages(ctx, "a", session.NewMessage("user", "hi")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The changes within the delay make a single snapshot of the last version
+	archive.expect(t, "archive a v2")
+	archive.expectNone(t)
+
+	archive.mu.Lock()
+	snapshot := archive.snapshots["a"]
+	archive.mu.Unlock()
+	if snapshot.TenantID != "t1" || snapshot.Language != "fr" || snapshot.MessageCount != 1 ||
+		len(snapshot.Messages) != 1 || snapshot.Messages[0].Content != "hi" {
+		t.Errorf("snapshot = %+v, want the updated session with its message", snapshot)
+	}
+
+	// A later change makes another
+	data, err := store.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Language = "de"
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "archive a v3")
+}
+
+func TestEndReasons(t *testing.T) {
+	archiver, store, archive, clock := newTestArchiver(t)
+	ctx := context.Background()
+
+	for _, id := range []string{"deleted", "expired"} {
+		if err := store.Create(ctx, &session.SessionData{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+		archive.expect(t, "archive "+id+" v1")
+	}
+
+	// The end of a session with a snapshot scheduled cancels it
+	for _, id := range []string{"deleted", "expired"} {
+		if err := store.Patch(ctx, &session.SessionData{ID: id, Version: 1, Language: "fr"}, session.FieldLanguage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, "deleted"); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "end deleted deleted")
+
+	clock.Advance(2 * time.Hour)
+	store.DeleteExpired()
+	archive.expect(t, "end expired expired")
+	if n := archiver.pendingCount(); n != 0 {
+		t.Errorf("%d snapshots still scheduled after the sessions ended", n)
+	}
+	archive.expectNone(t)
+
+	archive.mu.Lock()
+	defer archive.mu.Unlock()
+	if at := archive.ends["expired"]; !at.Equal(clock.Now()) {
+		t.Errorf("expired session ended at %v, want %v", at, clock.Now())
+	}
+}
+
+func TestEndBeforeFirstSnapshot(t *testing.T) {
+	_, store, archive, _ := newTestArchiver(t)
+	ctx := context.Background()
+
+	// A session deleted before its first snapshot cannot be read, so only
+	// its end is reported, which matches no archived session
+	if err := store.Create(ctx, &session.SessionData{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "end a deleted")
+	archive.expectNone(t)
+}
+
+func TestClose(t *testing.T) {
+	store := drivers.NewInMemoryStore()
+	t.Cleanup(func() { store.Close() })
+	ctx := context.Background()
+
+	archive := newFakeArchive()
+	archiver := New(basicStore{Store: store, ops: archive.ops}, archive)
+	if err := store.Create(ctx, &session.SessionData{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := archiver.Close(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "archive a v1", "end a closed", "delete a")
+	if data, err := store.Get(ctx, "a"); err != nil || data != nil {
+		t.Errorf("Get() after Close() = %v, %v, want nil", data, err)
+	}
+
+	if err := archiver.Close(ctx, "a"); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("Close() of missing session = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	archiver, store, archive, _ := newTestArchiver(t)
+	ctx := context.Background()
+
+	data := &session.SessionData{ID: "a"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	archiver.Stop()
+	if n := archiver.pendingCount(); n != 0 {
+		t.Errorf("%d snapshots still scheduled after Stop()", n)
+	}
+
+	// Nothing is archived once stopped
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	archive.expectNone(t)
+}
+
+func TestErrorHandler(t *testing.T) {
+	errArchive := errors.New("archive unavailable")
+	type report struct {
+		id  string
+		err error
+	}
+	reports := make(chan report, 10)
+	_, store, archive, _ := newTestArchiver(t, WithErrorHandler(func(id string, err error) {
+		reports <- report{id, err}
+	}))
+	archive.err = errArchive
+	ctx := context.Background()
+
+	if err := store.Create(ctx, &session.SessionData{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "archive a v1")
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	archive.expect(t, "end a deleted")
+
+	// Both the failed snapshot and the failed end are reported
+	for range 2 {
+		select {
+		case r := <-reports:
+			if r.id != "a" || r.err != errArchive {
+				t.Errorf("error handler called with %s, %v, want a, %v", r.id, r.err, errArchive)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("error not reported")
+		}
+	}
+}
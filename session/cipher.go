@@ -0,0 +1,17 @@
+package session
+
+import "context"
+
+// Cipher encrypts session data at rest.
+// Drivers that persist sessions encrypt every stored value with it, except
+// the IDs they index sessions by, and decrypt the values they read. Values
+// written before a cipher was configured are still read as plaintext.
+//
+// associatedData binds a ciphertext to where it is stored (the session ID
+// and field name): decryption fails if the ciphertext is moved to another
+// session or field. The encryption package provides an envelope-encryption
+// implementation.
+type Cipher interface {
+	Encrypt(ctx context.Context, plaintext, associatedData []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext, associatedData []byte) ([]byte, error)
+}
@@ -0,0 +1,14 @@
+package session
+
+// Codec encodes the session values drivers store, for smaller binary
+// encodings and compression.
+// Drivers marshal each value to JSON, encode it with the codec, then
+// encrypt it with the Cipher if one is configured; reading reverses the
+// steps. Decode must accept every format the codec can write, and plain
+// JSON, which drivers store without a codec, so values written by
+// differently configured instances during a rolling deployment can be read.
+// The codec package provides an implementation.
+type Codec interface {
+	Encode(val []byte) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
@@ -0,0 +1,240 @@
+// Package codec implements session.Codec with alternative encodings and
+// compression.
+//
+// Encoded values start with a header byte naming their encoding and
+// compression, so any Codec decodes values written by any other, whatever
+// its options, and values without a header are read as the plain JSON
+// drivers store without a codec:
+//
+//	store, err := session.NewStore(session.StoreTypeRedis,
+//		session.WithRedisClient(client),
+//		session.WithCodec(codec.New(
+//			codec.WithEncoding(codec.MessagePack),
+//			codec.WithCompression(codec.Zstd, 1024),
+//		)))
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/creastat/storage/session"
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Encoding is the serialization format of values.
+type Encoding byte
+
+// Supported encodings
+const (
+	JSON        Encoding = iota // JSON, as drivers store without a codec
+	MessagePack                 // MessagePack
+)
+
+// Compression is the compression algorithm of values.
+type Compression byte
+
+// Supported compression algorithms
+const (
+	None   Compression = iota // No compression
+	Zstd                      // Zstandard
+	Snappy                    // Snappy
+)
+
+const (
+	// Base of header bytes. Headers are headerBase | encoding<<2 |
+	// compression: below any byte JSON starts with, and above the header of
+	// encrypted values.
+	headerBase = 0x10
+	// Default size from which values are compressed
+	defaultThreshold = 1024
+)
+
+// ErrInvalidHeader is returned when decoding a value whose header names an
+// unknown encoding or compression.
+var ErrInvalidHeader = errors.New("invalid codec header")
+
+// Option is a functional option for configuring a Codec.
+type Option func(*Codec)
+
+// WithEncoding sets the encoding of values (default: JSON).
+// MessagePack keeps integers exact.
+func WithEncoding(encoding Encoding) Option {
+	return func(c *Codec) {
+		c.encoding = encoding
+	}
+}
+
+// WithCompression compresses values whose encoding is at least threshold
+// bytes long (default: no compression). Threshold <= 0 selects 1 KiB.
+func WithCompression(compression Compression, threshold int) Option {
+	return func(c *Codec) {
+		c.compression = compression
+		c.threshold = threshold
+		if c.threshold <= 0 {
+			c.threshold = defaultThreshold
+		}
+	}
+}
+
+// Codec implements session.Codec. It is safe for concurrent use.
+// Values encoded as uncompressed JSON are written as is, without a header,
+// so instances without a codec can still read them.
+type Codec struct {
+	encoding    Encoding
+	compression Compression
+	threshold   int
+}
+
+// New creates a Codec. Without options it stores plain JSON, and only
+// serves to decode values written by other codecs.
+func New(opts ...Option) *Codec {
+	c := &Codec{threshold: defaultThreshold}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Encode implements session.Codec.
+func (c *Codec) Encode(val []byte) ([]byte, error) {
+	encoded, err := encode(c.encoding, val)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := None
+	if c.compression != None && len(encoded) >= c.threshold {
+		compression = c.compression
+		if encoded, err = compress(compression, encoded); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.encoding == JSON && compression == None {
+		return encoded, nil
+	}
+	return append([]byte{headerBase | byte(c.encoding)<<2 | byte(compression)}, encoded...), nil
+}
+
+// Decode implements session.Codec.
+// Decodes values of any encoding and compression, and plain JSON.
+// Returns ErrInvalidHeader if the header is unknown.
+func (c *Codec) Decode(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0]&^0x0f != headerBase {
+		return data, nil // Plain JSON
+	}
+	encoding, compression := Encoding(data[0]>>2&0x03), Compression(data[0]&0x03)
+
+	val, err := decompress(compression, data[1:])
+	if err != nil {
+		return nil, err
+	}
+	return decode(encoding, val)
+}
+
+// encode converts a JSON value to the encoding.
+func encode(encoding Encoding, val []byte) ([]byte, error) {
+	switch encoding {
+	case JSON:
+		return val, nil
+	case MessagePack:
+		d := json.NewDecoder(bytes.NewReader(val))
+		d.UseNumber()
+		var v any
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		return msgpack.Marshal(exactNumbers(v))
+	}
+	return nil, fmt.Errorf("%w: encoding %d", ErrInvalidHeader, encoding)
+}
+
+// decode converts a value of the encoding back to JSON.
+func decode(encoding Encoding, val []byte) ([]byte, error) {
+	var v any
+	switch encoding {
+	case JSON:
+		return val, nil
+	case MessagePack:
+		if err := msgpack.Unmarshal(val, &v); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: encoding %d", ErrInvalidHeader, encoding)
+	}
+	return json.Marshal(v)
+}
+
+// exactNumbers replaces the json.Numbers of a decoded JSON value with
+// int64s, when they are integers that fit, or float64s.
+func exactNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, e := range v {
+			v[k] = exactNumbers(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = exactNumbers(e)
+		}
+	}
+	return v
+}
+
+// Shared zstd encoder and decoder; EncodeAll and DecodeAll are safe for
+// concurrent use.
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil)
+	})
+)
+
+// compress compresses a value.
+func compress(compression Compression, val []byte) ([]byte, error) {
+	switch compression {
+	case Zstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(val, nil), nil
+	case Snappy:
+		return s2.EncodeSnappy(nil, val), nil
+	}
+	return nil, fmt.Errorf("%w: compression %d", ErrInvalidHeader, compression)
+}
+
+// decompress decompresses a value.
+func decompress(compression Compression, val []byte) ([]byte, error) {
+	switch compression {
+	case None:
+		return val, nil
+	case Zstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(val, nil)
+	case Snappy:
+		return s2.Decode(nil, val)
+	}
+	return nil, fmt.Errorf("%w: compression %d", ErrInvalidHeader, compression)
+}
+
+// Compile-time check that Codec implements session.Codec.
+var _ session.Codec = (*Codec)(nil)
@@ -0,0 +1,202 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/session"
+)
+
+// testWords are the words of test messages.
+var testWords = strings.Fields(`the a session store user assistant message reply
+	order shipping invoice refund account password reset help please thanks
+	when where how why can could would should delivery tracking number
+	address payment card bank transfer today tomorrow week day hour minute`)
+
+// testSession returns the JSON encoding of a session with a history of n
+// messages of random words.
+func testSession(t testing.TB, n int) []byte {
+	t.Helper()
+	data := &session.SessionData{
+		ID:          "session-1",
+		TenantID:    "tenant-1",
+		AssistantID: "assistant-1",
+		UserID:      "user-1",
+		Version:     7,
+	}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for i := range n {
+		words := make([]string, 20+rnd.IntN(40))
+		for j := range words {
+			words[j] = testWords[rnd.IntN(len(testWords))]
+		}
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		data.ConversationHistory = append(data.ConversationHistory, session.Message{
+			Role:       role,
+			Content:    strings.Join(words, " "),
+			TokenCount: len(words),
+			Timestamp:  start.Add(time.Duration(i) * time.Second),
+		})
+	}
+	val, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+// testCodecs are the codec configurations compared by the tests.
+var testCodecs = []struct {
+	name  string
+	codec *Codec
+}{
+	{"JSON", New()},
+	{"MessagePack", New(WithEncoding(MessagePack))},
+	{"JSON+Zstd", New(WithCompression(Zstd, 1))},
+	{"JSON+Snappy", New(WithCompression(Snappy, 1))},
+	{"MessagePack+Zstd", New(WithEncoding(MessagePack), WithCompression(Zstd, 1))},
+	{"MessagePack+Snappy", New(WithEncoding(MessagePack), WithCompression(Snappy, 1))},
+}
+
+func TestRoundTrip(t *testing.T) {
+	val := testSession(t, 10)
+	var want any
+	if err := json.Unmarshal(val, &want); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCodecs {
+		t.Run(tc.name, func(t *testing.T) {
+			encoded, err := tc.codec.Encode(val)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Any codec decodes values written by any other
+			decoded, err := New().Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got any
+			if err := json.Unmarshal(decoded, &got); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("decoded %s, want %s", decoded, val)
+			}
+		})
+	}
+}
+
+func TestPlainJSON(t *testing.T) {
+	val := []byte(`{"id":"s1"}`)
+	// Uncompressed JSON is written without a header
+	encoded, err := New(WithCompression(Zstd, 1024)).Encode(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, val) {
+		t.Errorf("Encode = %q, want %q", encoded, val)
+	}
+
+	decoded, err := New(WithEncoding(MessagePack)).Decode(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, val) {
+		t.Errorf("Decode = %q, want %q", decoded, val)
+	}
+}
+
+func TestExactIntegers(t *testing.T) {
+	val := []byte(`{"n":9007199254740993}`)
+	c := New(WithEncoding(MessagePack))
+	encoded, err := c.Encode(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := c.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, val) {
+		t.Errorf("Decode = %s, want %s", decoded, val)
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	for _, header := range []byte{headerBase | 2<<2, headerBase | 3} {
+		if _, err := New().Decode([]byte{header, 0}); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Decode with header %#x: err = %v, want ErrInvalidHeader", header, err)
+		}
+	}
+	if _, err := New(WithEncoding(Encoding(2))).Encode([]byte(`{}`)); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("Encode with encoding 2: err = %v, want ErrInvalidHeader", err)
+	}
+}
+
+// TestEncodedSize compares the size of a session with 50 messages in each
+// configuration: compression saves far more than the encoding.
+func TestEncodedSize(t *testing.T) {
+	val := testSession(t, 50)
+	sizes := make(map[string]int)
+	for _, tc := range testCodecs {
+		encoded, err := tc.codec.Encode(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[tc.name] = len(encoded)
+		t.Logf("%-20s %6d bytes (%3.0f%% of JSON)", tc.name, len(encoded), 100*float64(len(encoded))/float64(len(val)))
+	}
+
+	if sizes["MessagePack"] >= sizes["JSON"] {
+		t.Errorf("MessagePack = %d bytes, want less than JSON (%d)", sizes["MessagePack"], sizes["JSON"])
+	}
+	for _, name := range []string{"JSON+Zstd", "JSON+Snappy", "MessagePack+Zstd", "MessagePack+Snappy"} {
+		if sizes[name] >= sizes["MessagePack"] {
+			t.Errorf("%s = %d bytes, want less than MessagePack (%d)", name, sizes[name], sizes["MessagePack"])
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	val := testSession(b, 50)
+	for _, tc := range testCodecs {
+		b.Run(tc.name, func(b *testing.B) {
+			var encoded []byte
+			for b.Loop() {
+				var err error
+				if encoded, err = tc.codec.Encode(val); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(encoded)), "bytes/value")
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	val := testSession(b, 50)
+	for _, tc := range testCodecs {
+		b.Run(tc.name, func(b *testing.B) {
+			encoded, err := tc.codec.Encode(val)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for b.Loop() {
+				if _, err := tc.codec.Decode(encoded); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package session
+
+import (
+	"context"
+	"errors"
+)
+
+// Number of Create/Get rounds CreateOrGet makes before giving up, in case the
+// existing session keeps disappearing between the two calls.
+const createOrGetAttempts = 3
+
+// CreateOrGet creates data as a new session, or returns the existing session
+// with the same ID, so retried handshakes are idempotent.
+// created reports whether data was stored; if not, data is left unchanged and
+// the existing session is returned instead.
+func CreateOrGet(ctx context.Context, store Store, data *SessionData) (result *SessionData, created bool, err error) {
+	for range createOrGetAttempts {
+		err := store.Create(ctx, data)
+		if err == nil {
+			return data, true, nil
+		}
+		if !errors.Is(err, ErrAlreadyExists) {
+			return nil, false, err
+		}
+
+		existing, err := store.Get(ctx, data.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		if existing != nil {
+			return existing, false, nil
+		}
+		// Deleted or expired in between; try creating it again
+	}
+	return nil, false, ErrAlreadyExists
+}
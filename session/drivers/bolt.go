@@ -0,0 +1,1056 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/creastat/storage/session"
+	bolt "go.etcd.io/bbolt"
+)
+
+// How long OpenBoltStore waits for another process to release the file
+const boltOpenTimeout = time.Second
+
+// Sessions are stored in a bbolt file with these top-level buckets:
+//   - sessions: session ID -> JSON boltRecord
+//   - messages: one nested bucket per session ID, holding the messages
+//     appended since its history was last written, keyed by sequence number,
+//     so appending does not rewrite the record. The bucket is deleted when
+//     the history is written, so its sequence is the number of messages.
+//   - expiry: session ID -> encoded boltExpiry, kept apart from the record
+//     so refreshing the TTL does not rewrite the history
+//   - expiry_index: expiry time + session ID -> nothing, in expiry order
+//     for the reaper
+//   - indexes: one nested bucket per index key (kind + ":" + ID), holding
+//     creation time + session ID -> nothing, in List order
+var (
+	boltSessionsBucket    = []byte("sessions")
+	boltMessagesBucket    = []byte("messages")
+	boltExpiryBucket      = []byte("expiry")
+	boltExpiryIndexBucket = []byte("expiry_index")
+	boltIndexesBucket     = []byte("indexes")
+)
+
+func init() {
+	session.Register(session.StoreTypeBolt, func(cfg session.Config) (session.Store, error) {
+		if cfg.BoltPath == "" {
+			return nil, session.ErrInvalidConfig
+		}
+		return OpenBoltStore(cfg.BoltPath, WithBoltTTL(cfg.TTL), WithBoltMaxLifetime(cfg.MaxLifetime),
+			WithBoltCipher(cfg.Cipher), WithBoltCodec(cfg.Codec))
+	})
+}
+
+// BoltOption is a functional option for configuring a BoltStore.
+type BoltOption func(*BoltStore)
+
+// WithBoltTTL sets the default idle TTL of bbolt sessions.
+// Zero or negative values keep the default (24 hours).
+func WithBoltTTL(ttl time.Duration) BoltOption {
+	return func(s *BoltStore) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithBoltMaxLifetime sets the default absolute lifetime of bbolt sessions.
+// Zero (the default) means sessions only expire when idle.
+func WithBoltMaxLifetime(lifetime time.Duration) BoltOption {
+	return func(s *BoltStore) {
+		s.maxLifetime = lifetime
+	}
+}
+
+// WithBoltReapInterval sets how often expired sessions are deleted from the
+// file. Zero or negative values disable the background reaper; expired
+// sessions are still never returned, and DeleteExpired can be called
+// directly.
+func WithBoltReapInterval(interval time.Duration) BoltOption {
+	return func(s *BoltStore) {
+		s.reapInterval = interval
+	}
+}
+
+// WithBoltCipher encrypts bbolt session records with cipher. Session IDs,
+// expiry and the tenant, assistant and user indexes stay in plaintext.
+func WithBoltCipher(cipher session.Cipher) BoltOption {
+	return func(s *BoltStore) {
+		s.sealer.cipher = cipher
+	}
+}
+
+// WithBoltCodec encodes bbolt session records with codec, before they are
+// encrypted. Records written by stores with any other codec, or none, are
+// still read.
+func WithBoltCodec(codec session.Codec) BoltOption {
+	return func(s *BoltStore) {
+		s.sealer.codec = codec
+	}
+}
+
+// BoltStore implements SessionStore in an embedded bbolt database file, for
+// single-process deployments without Redis or Postgres.
+// Every write runs in a single read-write transaction, which is fsynced to
+// disk before it returns, so sessions survive a crash or restart with
+// either all or none of a write applied. Versions are compared within the
+// transaction, and expiry is tracked alongside each session as in the other
+// stores. Reads run in read-only transactions, which neither take the
+// writer lock nor fsync: Get and Touch refresh expiry in memory, and the
+// refreshed expiry is written in batches by DeleteExpired and Close, so
+// after a crash sessions may expire up to one reap interval early.
+// A background reaper deletes expired sessions until Close is called.
+// Only one process can open the file at a time.
+// Lifecycle events are delivered to subscribers synchronously, after the
+// transaction emitting them commits.
+type BoltStore struct {
+	db           *bolt.DB
+	ttl          time.Duration
+	maxLifetime  time.Duration
+	reapInterval time.Duration
+	sealer       sealer
+	events       session.Broadcaster
+
+	// When sessions were last read, for those read since their expiry was
+	// written
+	touchMu sync.Mutex
+	touched map[string]time.Time
+
+	stop      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// boltRecord is a stored session.
+type boltRecord struct {
+	Data *session.SessionData `json:"data"`
+	// Number of messages appended since the history was last written, kept
+	// in the messages bucket rather than the record
+	Appended int `json:"-"`
+}
+
+// boltExpiry is the expiry state of a stored session.
+type boltExpiry struct {
+	session.Expiry
+	at time.Time
+}
+
+// OpenBoltStore opens the bbolt file at path, creating it if needed, and
+// returns a session store using it. The store owns the file: Close stops
+// the background reaper and closes it.
+// Returns an error if another process holds the file open.
+func OpenBoltStore(path string, opts ...BoltOption) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltSessionsBucket, boltMessagesBucket, boltExpiryBucket, boltExpiryIndexBucket, boltIndexesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &BoltStore{
+		db:           db,
+		ttl:          defaultTTL,
+		reapInterval: defaultReapInterval,
+		touched:      make(map[string]time.Time),
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.reapInterval > 0 {
+		go s.reaper()
+	}
+	return s, nil
+}
+
+// Create implements SessionStore.
+// Creates a new session with Version set to 1 and sets TTL.
+// Returns ErrAlreadyExists if a live session with the same ID exists.
+func (s *BoltStore) Create(ctx context.Context, data *session.SessionData) error {
+	// Work on a copy so data is left unchanged if the session exists
+	record := *data
+	now := time.Now()
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	record.Version = 1
+	record.SchemaVersion = session.CurrentSchemaVersion()
+	expiry := session.ResolveExpiry(&record, s.ttl, s.maxLifetime)
+	record.ExpiresAt = expiry.At(now)
+
+	err := s.update(ctx, func(tx *boltTx) error {
+		if _, ok, err := tx.live(record.ID); err != nil {
+			return err
+		} else if ok {
+			return session.ErrAlreadyExists
+		}
+
+		if err := tx.put(&boltRecord{Data: &record}); err != nil {
+			return err
+		}
+		if err := tx.setExpiry(record.ID, nil, boltExpiry{Expiry: expiry, at: record.ExpiresAt}); err != nil {
+			return err
+		}
+		if err := tx.index(&record); err != nil {
+			return err
+		}
+		tx.emit(session.EventCreated, record.ID, record.Version)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*data = record
+	return nil
+}
+
+// Get implements SessionStore.
+// Reads the session in a read-only transaction.
+// Returns nil if the session is not found or has expired (not an error).
+// Refreshes TTL on every read, in memory until it is written in a batch.
+func (s *BoltStore) Get(ctx context.Context, id string) (*session.SessionData, error) {
+	now := time.Now()
+	var result *session.SessionData
+	err := s.db.View(func(tx *bolt.Tx) error {
+		expiry, ok := s.expiryOf(tx, id)
+		if !ok || !now.Before(expiry.at) {
+			return nil // Expired, left to the reaper
+		}
+		record, err := s.decodeRecord(ctx, id, tx.Bucket(boltSessionsBucket).Get([]byte(id)))
+		if err != nil || record == nil {
+			return err
+		}
+		appended, err := s.appendedMessages(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		result = record.Data
+		result.ConversationHistory = append(result.ConversationHistory, appended...)
+		result.AppendedMessages = len(appended)
+		result.ExpiresAt = expiry.Expiry.At(now)
+		return nil
+	})
+	if err != nil || result == nil {
+		return nil, err
+	}
+
+	s.touch(id, now)
+	return result, nil
+}
+
+// Update implements SessionStore.
+// Implements optimistic locking: verifies Version matches within the write
+// transaction, increments it, updates UpdatedAt, and persists the SessionData.
+// Returns ErrVersionConflict if the version does not match or messages were
+// appended since the data was read.
+// Returns ErrNotFound if the session does not exist or has expired.
+// Refreshes TTL on every write.
+func (s *BoltStore) Update(ctx context.Context, data *session.SessionData) error {
+	// Work on a copy so data is left unchanged on conflict
+	record := *data
+	now := time.Now()
+	record.Version++
+	record.UpdatedAt = now
+	record.SchemaVersion = session.CurrentSchemaVersion()
+	expiry := session.ResolveExpiry(&record, s.ttl, s.maxLifetime)
+	record.ExpiresAt = expiry.At(now)
+	record.AppendedMessages = 0
+
+	err := s.update(ctx, func(tx *boltTx) error {
+		stored, current, err := tx.lookup(data.ID)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			return session.ErrNotFound
+		}
+		if stored.Data.Version != data.Version || stored.Appended != data.AppendedMessages {
+			return session.ErrVersionConflict
+		}
+
+		// The appended messages are now part of the stored history
+		if err := tx.put(&boltRecord{Data: &record}); err != nil {
+			return err
+		}
+		if err := tx.clearMessages(data.ID); err != nil {
+			return err
+		}
+		if err := tx.setExpiry(data.ID, &current, boltExpiry{Expiry: expiry, at: record.ExpiresAt}); err != nil {
+			return err
+		}
+		if err := tx.unindex(stored.Data); err != nil {
+			return err
+		}
+		if err := tx.index(&record); err != nil {
+			return err
+		}
+		tx.emit(session.EventUpdated, data.ID, record.Version)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*data = record
+	return nil
+}
+
+// Patch implements session.Patcher.
+// Copies the named fields from data into the stored session under the same
+// optimistic locking as Update.
+// Returns ErrInvalidField if a field cannot be patched.
+// Returns ErrVersionConflict if the version does not match.
+// Returns ErrNotFound if the session does not exist or has expired.
+// Refreshes TTL on every write.
+func (s *BoltStore) Patch(ctx context.Context, data *session.SessionData, fields ...session.Field) error {
+	if err := session.ValidatePatch(fields); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	patchHistory := slices.Contains(fields, session.FieldConversationHistory)
+	var updated *session.SessionData
+	err := s.update(ctx, func(tx *boltTx) error {
+		stored, current, err := tx.lookup(data.ID)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			return session.ErrNotFound
+		}
+
+		// Appended messages only conflict with a new history
+		if stored.Data.Version != data.Version || patchHistory && stored.Appended != data.AppendedMessages {
+			return session.ErrVersionConflict
+		}
+
+		updated, err = session.PatchFields(stored.Data, data, fields)
+		if err != nil {
+			return err
+		}
+		updated.Version++
+		updated.UpdatedAt = now
+		// The whole session is rewritten, upgraded as it was read
+		updated.SchemaVersion = session.CurrentSchemaVersion()
+		expiry := session.ResolveExpiry(updated, s.ttl, s.maxLifetime)
+		updated.ExpiresAt = expiry.At(now)
+
+		// The appended messages stay apart unless the history is replaced
+		if err := tx.put(&boltRecord{Data: updated}); err != nil {
+			return err
+		}
+		if patchHistory {
+			if err := tx.clearMessages(data.ID); err != nil {
+				return err
+			}
+		}
+		if err := tx.setExpiry(data.ID, &current, boltExpiry{Expiry: expiry, at: updated.ExpiresAt}); err != nil {
+			return err
+		}
+		tx.emit(session.EventUpdated, data.ID, updated.Version)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	data.Version = updated.Version
+	data.SchemaVersion = updated.SchemaVersion
+	data.UpdatedAt = updated.UpdatedAt
+	data.ExpiresAt = updated.ExpiresAt
+	if patchHistory {
+		data.AppendedMessages = 0
+	}
+	return nil
+}
+
+// AppendMessages implements session.Appender.
+// Adds the messages to the session's messages bucket, without rewriting its
+// record or incrementing Version. Refreshes TTL.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *BoltStore) AppendMessages(ctx context.Context, id string, msgs ...session.Message) error {
+	return s.update(ctx, func(tx *boltTx) error {
+		expiry, ok, err := tx.live(id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return session.ErrNotFound
+		}
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		if err := tx.appendMessages(id, msgs); err != nil {
+			return err
+		}
+		if _, err := tx.refresh(id, expiry); err != nil {
+			return err
+		}
+
+		// The record is only read for the version in the event
+		if !s.events.HasSubscribers() {
+			return nil
+		}
+		record, err := s.decodeRecord(ctx, id, tx.Bucket(boltSessionsBucket).Get([]byte(id)))
+		if err != nil || record == nil {
+			return err
+		}
+		tx.emit(session.EventUpdated, id, record.Data.Version)
+		return nil
+	})
+}
+
+// Touch implements session.Toucher.
+// Checks the session in a read-only transaction and refreshes its TTL in
+// memory, until it is written in a batch.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *BoltStore) Touch(ctx context.Context, id string) error {
+	now := time.Now()
+	live := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		expiry, ok := s.expiryOf(tx, id)
+		live = ok && now.Before(expiry.at)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !live {
+		return session.ErrNotFound
+	}
+
+	s.touch(id, now)
+	return nil
+}
+
+// List implements session.Lister.
+// Scans the most selective index from the cursor in a read-only transaction.
+func (s *BoltStore) List(ctx context.Context, filter session.ListFilter, cursor string) ([]*session.SessionData, string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := session.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	var results []*session.SessionData
+	err = s.db.View(func(tx *bolt.Tx) error {
+		index := tx.Bucket(boltIndexesBucket).Bucket([]byte(boltIndexKey(filterIndex(filter))))
+		if index == nil {
+			return nil
+		}
+
+		start := boltIndexEntry(after.CreatedAt, after.ID)
+		c := index.Cursor()
+		k, _ := c.Seek(start)
+		if bytes.Equal(k, start) {
+			k, _ = c.Next()
+		}
+		for ; k != nil && len(results) <= filter.Limit; k, _ = c.Next() {
+			id := string(k[8:])
+			expiry, ok := s.expiryOf(tx, id)
+			if !ok || !now.Before(expiry.at) {
+				continue // Expired, left to the reaper
+			}
+			record, err := s.decodeRecord(ctx, id, tx.Bucket(boltSessionsBucket).Get([]byte(id)))
+			if err != nil {
+				return err
+			}
+			if record == nil || !filter.Matches(record.Data) {
+				continue
+			}
+
+			// Sessions are listed without their history
+			record.Data.ConversationHistory = nil
+			record.Data.ExpiresAt = expiry.at
+			results = append(results, record.Data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(results) > filter.Limit {
+		results = results[:filter.Limit]
+		next = session.EncodeCursor(session.PositionOf(results[len(results)-1]))
+	}
+	return results, next, nil
+}
+
+// Delete implements SessionStore.
+func (s *BoltStore) Delete(ctx context.Context, id string) error {
+	return s.update(ctx, func(tx *boltTx) error {
+		record, expiry, err := tx.lookup(id)
+		if err != nil || record == nil {
+			return err
+		}
+		if err := tx.remove(record, expiry); err != nil {
+			return err
+		}
+		tx.emit(session.EventDeleted, id, record.Data.Version)
+		return nil
+	})
+}
+
+// DeleteExpired writes the expiry refreshed by reads since the last call to
+// the file, then deletes all expired sessions, a batch per transaction.
+// It is called periodically by the reaper.
+func (s *BoltStore) DeleteExpired(ctx context.Context) error {
+	if err := s.writeTouches(ctx); err != nil {
+		return err
+	}
+
+	for {
+		deleted := 0
+		err := s.update(ctx, func(tx *boltTx) error {
+			// Collect the batch first: deleting moves the cursor
+			var ids [][]byte
+			c := tx.Bucket(boltExpiryIndexBucket).Cursor()
+			for k, _ := c.First(); k != nil && len(ids) < reapBatchSize; k, _ = c.Next() {
+				if tx.now.Before(boltTime(k[:8])) {
+					break
+				}
+				ids = append(ids, bytes.Clone(k[8:]))
+			}
+
+			for _, id := range ids {
+				// live deletes the session, as it has expired
+				if _, _, err := tx.live(string(id)); err != nil {
+					return err
+				}
+			}
+			deleted = len(ids)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if deleted < reapBatchSize {
+			return nil
+		}
+	}
+}
+
+// Scan implements session.Scanner.
+// Reads the sessions in ID order, a batch per read transaction, and calls
+// fn between transactions so it can write to the store.
+func (s *BoltStore) Scan(ctx context.Context, fn func(*session.SessionData) error) error {
+	var after []byte
+	for {
+		now := time.Now()
+		var batch []*session.SessionData
+		done := false
+		err := s.db.View(func(tx *bolt.Tx) error {
+			c := tx.Bucket(boltSessionsBucket).Cursor()
+			k, val := c.First()
+			if after != nil {
+				if k, val = c.Seek(after); bytes.Equal(k, after) {
+					k, val = c.Next()
+				}
+			}
+			for ; k != nil && len(batch) < scanBatchSize; k, val = c.Next() {
+				expiry, ok := s.expiryOf(tx, string(k))
+				if !ok || !now.Before(expiry.at) {
+					continue // Expired, left to the reaper
+				}
+				record, err := s.decodeRecord(ctx, string(k), val)
+				if err != nil {
+					return err
+				}
+
+				// Sessions are scanned without their history, as listed
+				record.Data.ConversationHistory = nil
+				record.Data.ExpiresAt = expiry.at
+				batch = append(batch, record.Data)
+			}
+			done = k == nil
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, data := range batch {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		if done {
+			return nil
+		}
+		after = []byte(batch[len(batch)-1].ID)
+	}
+}
+
+// Subscribe implements session.Notifier.
+// Expired events are emitted when an expired session is written or deleted
+// by the reaper.
+func (s *BoltStore) Subscribe(handler session.EventHandler) func() {
+	return s.events.Subscribe(handler)
+}
+
+// Close implements SessionStore.
+// Stops the reaper, writes the expiry refreshed by reads and closes the file.
+func (s *BoltStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		err := s.writeTouches(context.Background())
+		s.closeErr = errors.Join(err, s.db.Close())
+	})
+	return s.closeErr
+}
+
+// writeTouches writes the expiry refreshed by reads to the file, a batch per
+// transaction.
+func (s *BoltStore) writeTouches(ctx context.Context) error {
+	s.touchMu.Lock()
+	ids := slices.Collect(maps.Keys(s.touched))
+	s.touchMu.Unlock()
+
+	for batch := range slices.Chunk(ids, reapBatchSize) {
+		err := s.update(ctx, func(tx *boltTx) error {
+			for _, id := range batch {
+				// live writes the refreshed expiry, or deletes the session
+				// if it has expired since
+				if _, _, err := tx.live(id); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// touch records that a live session was read at now, refreshing its expiry
+// until it is written.
+func (s *BoltStore) touch(id string, now time.Time) {
+	s.touchMu.Lock()
+	defer s.touchMu.Unlock()
+	if now.After(s.touched[id]) {
+		s.touched[id] = now
+	}
+}
+
+// lastTouched returns when a session was last read, if it was read since its
+// expiry was written.
+func (s *BoltStore) lastTouched(id string) (time.Time, bool) {
+	s.touchMu.Lock()
+	defer s.touchMu.Unlock()
+	at, ok := s.touched[id]
+	return at, ok
+}
+
+// untouch forgets the reads whose refreshed expiry was written, unless the
+// sessions were read again since.
+func (s *BoltStore) untouch(written map[string]time.Time) {
+	s.touchMu.Lock()
+	defer s.touchMu.Unlock()
+	for id, at := range written {
+		if s.touched[id].Equal(at) {
+			delete(s.touched, id)
+		}
+	}
+}
+
+// expiryOf returns the expiry of a session, refreshed by the reads not yet
+// written. ok is false if the session does not exist.
+func (s *BoltStore) expiryOf(tx *bolt.Tx, id string) (expiry boltExpiry, ok bool) {
+	expiry, ok = decodeBoltExpiry(tx.Bucket(boltExpiryBucket).Get([]byte(id)))
+	if !ok {
+		return boltExpiry{}, false
+	}
+	if touched, ok := s.lastTouched(id); ok {
+		if at := expiry.Expiry.At(touched); at.After(expiry.at) {
+			expiry.at = at
+		}
+	}
+	return expiry, true
+}
+
+// appendedMessages returns the messages appended to a session since its
+// history was last written.
+func (s *BoltStore) appendedMessages(ctx context.Context, tx *bolt.Tx, id string) ([]session.Message, error) {
+	bucket := tx.Bucket(boltMessagesBucket).Bucket([]byte(id))
+	if bucket == nil {
+		return nil, nil
+	}
+	var msgs []session.Message
+	err := bucket.ForEach(func(_, val []byte) error {
+		b, err := s.sealer.open(ctx, id, session.FieldConversationHistory, val)
+		if err != nil {
+			return err
+		}
+		var msg session.Message
+		if err := json.Unmarshal(b, &msg); err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+		return nil
+	})
+	return msgs, err
+}
+
+// reaper periodically deletes expired sessions until the store is closed.
+func (s *BoltStore) reaper() {
+	ticker := time.NewTicker(s.reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// Failures are retried on the next tick
+			_ = s.DeleteExpired(context.Background())
+		}
+	}
+}
+
+// update runs fn in a read-write transaction, and delivers the events it
+// emitted once the transaction commits.
+func (s *BoltStore) update(ctx context.Context, fn func(tx *boltTx) error) error {
+	var committed *boltTx
+	err := s.db.Update(func(btx *bolt.Tx) error {
+		tx := &boltTx{Tx: btx, ctx: ctx, store: s, now: time.Now(), touched: make(map[string]time.Time)}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		committed = tx
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.untouch(committed.touched)
+	for _, event := range committed.events {
+		s.events.Emit(event)
+	}
+	return nil
+}
+
+// boltTx is a read-write transaction of a BoltStore.
+type boltTx struct {
+	*bolt.Tx
+	ctx    context.Context
+	store  *BoltStore
+	now    time.Time
+	events []session.Event // events to deliver on commit
+	// Reads whose refreshed expiry the transaction wrote
+	touched map[string]time.Time
+}
+
+// live returns the expiry of a live session, writing the expiry refreshed by
+// reads, and deleting the session if it has expired. ok is false if the
+// session does not exist or has expired.
+func (tx *boltTx) live(id string) (expiry boltExpiry, ok bool, err error) {
+	touched, wasTouched := tx.store.lastTouched(id)
+	if wasTouched {
+		tx.touched[id] = touched
+	}
+	stored, ok := decodeBoltExpiry(tx.Bucket(boltExpiryBucket).Get([]byte(id)))
+	if !ok {
+		return boltExpiry{}, false, nil
+	}
+	expiry = stored
+	if wasTouched {
+		if at := stored.Expiry.At(touched); at.After(stored.at) {
+			expiry.at = at
+			if err := tx.setExpiry(id, &stored, expiry); err != nil {
+				return boltExpiry{}, false, err
+			}
+		}
+	}
+	if tx.now.Before(expiry.at) {
+		return expiry, true, nil
+	}
+
+	record, err := tx.store.decodeRecord(tx.ctx, id, tx.Bucket(boltSessionsBucket).Get([]byte(id)))
+	if err != nil || record == nil {
+		return boltExpiry{}, false, err
+	}
+	if err := tx.remove(record, expiry); err != nil {
+		return boltExpiry{}, false, err
+	}
+	tx.emit(session.EventExpired, id, record.Data.Version)
+	return boltExpiry{}, false, nil
+}
+
+// lookup returns a live session and its expiry, deleting the session if it
+// has expired. The record is nil if the session does not exist or has
+// expired. Its history excludes the appended messages, which are only
+// counted.
+func (tx *boltTx) lookup(id string) (*boltRecord, boltExpiry, error) {
+	expiry, ok, err := tx.live(id)
+	if err != nil || !ok {
+		return nil, boltExpiry{}, err
+	}
+	record, err := tx.store.decodeRecord(tx.ctx, id, tx.Bucket(boltSessionsBucket).Get([]byte(id)))
+	if err != nil || record == nil {
+		return nil, boltExpiry{}, err
+	}
+	if bucket := tx.Bucket(boltMessagesBucket).Bucket([]byte(id)); bucket != nil {
+		record.Appended = int(bucket.Sequence())
+	}
+	return record, expiry, nil
+}
+
+// put writes a session record. The history is written as is, and ExpiresAt
+// is kept in the expiry bucket instead.
+func (tx *boltTx) put(record *boltRecord) error {
+	stored := *record.Data
+	stored.ExpiresAt = time.Time{}
+	val, err := json.Marshal(boltRecord{Data: &stored})
+	if err != nil {
+		return err
+	}
+	if val, err = tx.store.sealer.seal(tx.ctx, stored.ID, "", val); err != nil {
+		return err
+	}
+	return tx.Bucket(boltSessionsBucket).Put([]byte(stored.ID), val)
+}
+
+// appendMessages adds messages to a session's messages bucket.
+func (tx *boltTx) appendMessages(id string, msgs []session.Message) error {
+	bucket, err := tx.Bucket(boltMessagesBucket).CreateBucketIfNotExists([]byte(id))
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		val, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if val, err = tx.store.sealer.seal(tx.ctx, id, session.FieldConversationHistory, val); err != nil {
+			return err
+		}
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(binary.BigEndian.AppendUint64(nil, seq), val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearMessages deletes a session's messages bucket, once its history is
+// written.
+func (tx *boltTx) clearMessages(id string) error {
+	messages := tx.Bucket(boltMessagesBucket)
+	if messages.Bucket([]byte(id)) == nil {
+		return nil
+	}
+	return messages.DeleteBucket([]byte(id))
+}
+
+// refresh extends a live session's sliding expiry, up to its deadline, and
+// returns the new expiry.
+func (tx *boltTx) refresh(id string, expiry boltExpiry) (boltExpiry, error) {
+	refreshed := expiry
+	refreshed.at = expiry.Expiry.At(tx.now)
+	return refreshed, tx.setExpiry(id, &expiry, refreshed)
+}
+
+// setExpiry replaces the expiry of a session, given its current expiry if
+// it has one.
+func (tx *boltTx) setExpiry(id string, current *boltExpiry, expiry boltExpiry) error {
+	index := tx.Bucket(boltExpiryIndexBucket)
+	if current != nil {
+		if err := index.Delete(boltExpiryEntry(current.at, id)); err != nil {
+			return err
+		}
+	}
+	if err := index.Put(boltExpiryEntry(expiry.at, id), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(boltExpiryBucket).Put([]byte(id), encodeBoltExpiry(expiry))
+}
+
+// remove deletes a session, its appended messages, its expiry and its index
+// entries.
+func (tx *boltTx) remove(record *boltRecord, expiry boltExpiry) error {
+	id := record.Data.ID
+	if err := tx.Bucket(boltSessionsBucket).Delete([]byte(id)); err != nil {
+		return err
+	}
+	if err := tx.clearMessages(id); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltExpiryBucket).Delete([]byte(id)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltExpiryIndexBucket).Delete(boltExpiryEntry(expiry.at, id)); err != nil {
+		return err
+	}
+	return tx.unindex(record.Data)
+}
+
+// index adds a session to the indexes of its tenant, assistant and user.
+func (tx *boltTx) index(data *session.SessionData) error {
+	entry := boltIndexEntry(data.CreatedAt.UnixMilli(), data.ID)
+	for _, key := range indexKeys(data, boltIndexKey) {
+		index, err := tx.Bucket(boltIndexesBucket).CreateBucketIfNotExists([]byte(key))
+		if err != nil {
+			return err
+		}
+		if err := index.Put(entry, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindex removes a session from the indexes of its tenant, assistant and
+// user, deleting indexes left empty.
+func (tx *boltTx) unindex(data *session.SessionData) error {
+	indexes := tx.Bucket(boltIndexesBucket)
+	entry := boltIndexEntry(data.CreatedAt.UnixMilli(), data.ID)
+	for _, key := range indexKeys(data, boltIndexKey) {
+		index := indexes.Bucket([]byte(key))
+		if index == nil {
+			continue
+		}
+		if err := index.Delete(entry); err != nil {
+			return err
+		}
+		if k, _ := index.Cursor().First(); k == nil {
+			if err := indexes.DeleteBucket([]byte(key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emit queues a lifecycle event, if anyone subscribed, to be delivered when
+// the transaction commits.
+func (tx *boltTx) emit(typ session.EventType, id string, version int64) {
+	if tx.store.events.HasSubscribers() {
+		tx.events = append(tx.events, session.Event{Type: typ, ID: id, Version: version, Time: time.Now()})
+	}
+}
+
+// decodeRecord decodes a stored session record, upgrading it to the current
+// schema, or returns nil if val is nil.
+func (s *BoltStore) decodeRecord(ctx context.Context, id string, val []byte) (*boltRecord, error) {
+	if val == nil {
+		return nil, nil
+	}
+	val, err := s.sealer.open(ctx, id, "", val)
+	if err != nil {
+		return nil, err
+	}
+	var record boltRecord
+	if err := json.Unmarshal(val, &record); err != nil {
+		return nil, err
+	}
+	if record.Data.SchemaVersion < session.CurrentSchemaVersion() {
+		// Decode the session again field by field, to upgrade it
+		var stored struct {
+			Data map[session.Field]json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(val, &stored); err != nil {
+			return nil, err
+		}
+		if err := session.UpgradeFields(stored.Data); err != nil {
+			return nil, err
+		}
+		record.Data = &session.SessionData{}
+		if err := session.UnmarshalFields(stored.Data, record.Data); err != nil {
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+// encodeBoltExpiry encodes an expiry as its expiry time, idle TTL and
+// deadline (zero if none), 8 bytes each.
+func encodeBoltExpiry(expiry boltExpiry) []byte {
+	var deadline int64
+	if !expiry.Deadline.IsZero() {
+		deadline = expiry.Deadline.UnixNano()
+	}
+	b := make([]byte, 0, 24)
+	b = binary.BigEndian.AppendUint64(b, uint64(expiry.at.UnixNano()))
+	b = binary.BigEndian.AppendUint64(b, uint64(expiry.IdleTTL))
+	return binary.BigEndian.AppendUint64(b, uint64(deadline))
+}
+
+// decodeBoltExpiry decodes an expiry encoded by encodeBoltExpiry.
+// ok is false if val is not a valid expiry.
+func decodeBoltExpiry(val []byte) (expiry boltExpiry, ok bool) {
+	if len(val) != 24 {
+		return boltExpiry{}, false
+	}
+	expiry.at = boltTime(val[:8])
+	expiry.IdleTTL = time.Duration(binary.BigEndian.Uint64(val[8:16]))
+	if deadline := int64(binary.BigEndian.Uint64(val[16:])); deadline != 0 {
+		expiry.Deadline = time.Unix(0, deadline)
+	}
+	return expiry, true
+}
+
+// boltExpiryEntry returns the key of a session in the expiry index: its
+// expiry time in Unix nanoseconds, then its ID.
+func boltExpiryEntry(at time.Time, id string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano())), id...)
+}
+
+// boltTime decodes a time in Unix nanoseconds from the first 8 bytes of b.
+func boltTime(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// boltIndexEntry returns the key of a session in an index: its creation
+// time in Unix milliseconds, with the sign bit flipped so negative times
+// sort first, then its ID. Keys sort in List order.
+func boltIndexEntry(createdAt int64, id string) []byte {
+	return append(binary.BigEndian.AppendUint64(nil, uint64(createdAt)^1<<63), id...)
+}
+
+// boltIndexKey returns the name of an index bucket.
+func boltIndexKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// Compile-time checks that BoltStore implements Store and the optional interfaces.
+var (
+	_ session.Store    = (*BoltStore)(nil)
+	_ session.Patcher  = (*BoltStore)(nil)
+	_ session.Appender = (*BoltStore)(nil)
+	_ session.Toucher  = (*BoltStore)(nil)
+	_ session.Lister   = (*BoltStore)(nil)
+	_ session.Notifier = (*BoltStore)(nil)
+	_ session.Scanner  = (*BoltStore)(nil)
+)
@@ -0,0 +1,156 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/sessiontest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		store, err := OpenBoltStore(filepath.Join(t.TempDir(), "sessions.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+// boltTxID returns the ID of the last transaction committed to the file.
+func boltTxID(t *testing.T, s *BoltStore) int {
+	t.Helper()
+	var id int
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		id = tx.ID()
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// boltValue returns a copy of the value of key in bucket.
+func boltValue(t *testing.T, s *BoltStore, bucket, key []byte) []byte {
+	t.Helper()
+	var val []byte
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		val = bytes.Clone(tx.Bucket(bucket).Get(key))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return val
+}
+
+func TestBoltStoreReads(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := OpenBoltStore(path, WithBoltTTL(time.Hour), WithBoltReapInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { store.Close() }()
+
+	data := &session.SessionData{ID: "s1"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	created := data.ExpiresAt
+
+	// Reads commit no write transaction, but refresh expiry in memory
+	txID := boltTxID(t, store)
+	got, err := store.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Touch(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if id := boltTxID(t, store); id != txID {
+		t.Errorf("Get and Touch committed %d transactions", id-txID)
+	}
+	if !got.ExpiresAt.After(created) {
+		t.Errorf("Get ExpiresAt = %v, want after %v", got.ExpiresAt, created)
+	}
+	if got, err = store.Get(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	touched := got.ExpiresAt
+
+	// Close writes the refreshed expiry
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store, err = OpenBoltStore(path, WithBoltReapInterval(0)); err != nil {
+		t.Fatal(err)
+	}
+	var expiry boltExpiry
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		expiry, _ = store.expiryOf(tx, "s1")
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !expiry.at.Equal(touched) {
+		t.Errorf("expiry after Close = %v, want %v", expiry.at, touched)
+	}
+}
+
+func TestBoltStoreAppendMessages(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenBoltStore(filepath.Join(t.TempDir(), "sessions.db"), WithBoltReapInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	data := &session.SessionData{ID: "s1", ConversationHistory: []session.Message{{Role: "user", Content: "a"}}}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	record := boltValue(t, store, boltSessionsBucket, []byte("s1"))
+
+	// Appending leaves the record as is
+	if err := store.AppendMessages(ctx, "s1", session.Message{Role: "assistant", Content: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AppendMessages(ctx, "s1", session.Message{Role: "user", Content: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := boltValue(t, store, boltSessionsBucket, []byte("s1")); !bytes.Equal(got, record) {
+		t.Error("AppendMessages rewrote the record")
+	}
+
+	got, err := store.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ConversationHistory) != 3 || got.ConversationHistory[2].Content != "c" || got.AppendedMessages != 2 {
+		t.Fatalf("Get = %d messages, %d appended, want 3, 2", len(got.ConversationHistory), got.AppendedMessages)
+	}
+
+	// Writing the history folds the appended messages into the record
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltMessagesBucket).Bucket([]byte("s1")) != nil {
+			t.Error("messages bucket left after Update")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = store.Get(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ConversationHistory) != 3 || got.AppendedMessages != 0 {
+		t.Errorf("Get after Update = %d messages, %d appended, want 3, 0", len(got.ConversationHistory), got.AppendedMessages)
+	}
+}
@@ -0,0 +1,63 @@
+package drivers
+
+import "github.com/creastat/storage/session"
+
+// Kinds of session index, as used in index keys
+const (
+	indexTenant    = "tenant"
+	indexAssistant = "assistant"
+	indexUser      = "user"
+)
+
+// indexKeys returns the keys of the indexes a session belongs to, built by
+// key from the index kind and the indexed ID.
+func indexKeys(data *session.SessionData, key func(kind, id string) string) []string {
+	var keys []string
+	if data.TenantID != "" {
+		keys = append(keys, key(indexTenant, data.TenantID))
+	}
+	if data.AssistantID != "" {
+		keys = append(keys, key(indexAssistant, data.AssistantID))
+	}
+	if data.UserID != "" {
+		keys = append(keys, key(indexUser, data.UserID))
+	}
+	return keys
+}
+
+// filterIndex returns the most selective index for a validated filter:
+// user, then assistant, then tenant.
+func filterIndex(filter session.ListFilter) (kind, id string) {
+	switch {
+	case filter.UserID != "":
+		return indexUser, filter.UserID
+	case filter.AssistantID != "":
+		return indexAssistant, filter.AssistantID
+	default:
+		return indexTenant, filter.TenantID
+	}
+}
+
+// indexedID returns the ID a session is indexed by in an index of the kind.
+func indexedID(data *session.SessionData, kind string) string {
+	switch kind {
+	case indexUser:
+		return data.UserID
+	case indexAssistant:
+		return data.AssistantID
+	default:
+		return data.TenantID
+	}
+}
+
+// comparePositions orders sessions as List returns them.
+func comparePositions(a, b *session.SessionData) int {
+	switch pa, pb := session.PositionOf(a), session.PositionOf(b); {
+	case pa.After(pb):
+		return 1
+	case pb.After(pa):
+		return -1
+	default:
+		return 0
+	}
+}
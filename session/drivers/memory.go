@@ -2,94 +2,548 @@ package drivers
 
 import (
 	"context"
+	"encoding/json"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/creastat/storage/session"
 )
 
+// Default interval between sweeps of expired in-memory sessions
+const defaultJanitorInterval = time.Minute
+
+func init() {
+	session.Register(session.StoreTypeMemory, func(cfg session.Config) (session.Store, error) {
+		return NewInMemoryStore(WithMemoryTTL(cfg.TTL), WithMemoryMaxLifetime(cfg.MaxLifetime)), nil
+	})
+}
+
+// MemoryOption is a functional option for configuring an InMemoryStore.
+type MemoryOption func(*InMemoryStore)
+
+// WithMemoryTTL sets the sliding TTL of in-memory sessions.
+// Values <= 0 select the default of 24 hours, as for Redis.
+func WithMemoryTTL(ttl time.Duration) MemoryOption {
+	return func(s *InMemoryStore) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithMemoryMaxLifetime sets the default absolute lifetime of in-memory
+// sessions. Zero (the default) means sessions only expire when idle.
+func WithMemoryMaxLifetime(lifetime time.Duration) MemoryOption {
+	return func(s *InMemoryStore) {
+		s.maxLifetime = lifetime
+	}
+}
+
+// WithClock sets the function used to read the current time, so expiry can
+// be tested deterministically. Defaults to time.Now.
+func WithClock(now func() time.Time) MemoryOption {
+	return func(s *InMemoryStore) {
+		if now != nil {
+			s.now = now
+		}
+	}
+}
+
+// WithJanitorInterval sets how often expired sessions are swept from memory.
+// Values <= 0 disable the background sweep; expired sessions are then only
+// removed by DeleteExpired, though they are never returned either way.
+func WithJanitorInterval(interval time.Duration) MemoryOption {
+	return func(s *InMemoryStore) {
+		s.janitorInterval = interval
+	}
+}
+
 // InMemoryStore implements SessionStore using an in-memory map with optimistic locking.
+// Sessions are cloned through a JSON round trip on every read and write, so
+// callers never share memory with the store and see exactly what the Redis
+// store would return (e.g. numbers in Config maps come back as float64).
+// Like Redis, sessions expire after a sliding TTL refreshed on every access,
+// capped by an optional maximum lifetime; a background janitor frees expired
+// sessions until Close is called.
+// Lifecycle events are delivered to subscribers synchronously, after the
+// operation emitting them releases the store's lock.
 type InMemoryStore struct {
 	mu       sync.RWMutex
-	sessions map[string]*session.SessionData
+	sessions map[string]*memorySession
+	indexes  map[string]map[string]struct{} // index key -> session IDs
+	pending  []session.Event                // events to emit on unlock
+	events   session.Broadcaster
+
+	ttl             time.Duration
+	maxLifetime     time.Duration
+	now             func() time.Time
+	janitorInterval time.Duration
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// memorySession is a stored session with its expiry state.
+type memorySession struct {
+	data      *session.SessionData
+	appended  []session.Message // messages appended since the last Update
+	expiry    session.Expiry
+	expiresAt time.Time
 }
 
 // NewInMemoryStore creates a new in-memory session store.
-func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{
-		sessions: make(map[string]*session.SessionData),
+// Call Close to stop the background janitor.
+func NewInMemoryStore(opts ...MemoryOption) *InMemoryStore {
+	s := &InMemoryStore{
+		sessions:        make(map[string]*memorySession),
+		indexes:         make(map[string]map[string]struct{}),
+		ttl:             defaultTTL,
+		now:             time.Now,
+		janitorInterval: defaultJanitorInterval,
+		stop:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.janitorInterval > 0 {
+		go s.janitor()
 	}
+	return s
 }
 
 // Create implements SessionStore.
-// Creates a new session with Version set to 1.
+// Creates a new session with Version set to 1 and sets TTL.
+// Returns ErrAlreadyExists if a live session with the same ID exists.
 func (s *InMemoryStore) Create(ctx context.Context, data *session.SessionData) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
-	now := time.Now()
+	if s.lookup(data.ID) != nil {
+		return session.ErrAlreadyExists
+	}
+
+	now := s.now()
 	data.CreatedAt = now
 	data.UpdatedAt = now
 	data.Version = 1
+	data.SchemaVersion = session.CurrentSchemaVersion()
+	expiry := session.ResolveExpiry(data, s.ttl, s.maxLifetime)
+	data.ExpiresAt = expiry.At(now)
+
+	stored, err := clone(data)
+	if err != nil {
+		return err
+	}
 
-	s.sessions[data.ID] = data
+	s.sessions[data.ID] = &memorySession{data: stored, expiry: expiry, expiresAt: data.ExpiresAt}
+	s.index(stored)
+	s.emit(session.EventCreated, data.ID, data.Version)
 	return nil
 }
 
 // Get implements SessionStore.
-// Returns nil if the session is not found (not an error).
+// Returns nil if the session is not found or has expired (not an error).
+// Refreshes TTL on every read.
 func (s *InMemoryStore) Get(ctx context.Context, id string) (*session.SessionData, error) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+	s.mu.Lock()
+	defer s.unlock()
 
-	data, exists := s.sessions[id]
-	if !exists {
+	entry := s.lookup(id)
+	if entry == nil {
 		return nil, nil // Not found
 	}
-	return data, nil
+
+	result, err := clone(entry.data)
+	if err != nil {
+		return nil, err
+	}
+
+	appended, err := clone(entry.appended)
+	if err != nil {
+		return nil, err
+	}
+	result.ConversationHistory = append(result.ConversationHistory, appended...)
+	result.AppendedMessages = len(appended)
+
+	s.refresh(entry)
+	result.ExpiresAt = entry.expiresAt
+	return result, nil
 }
 
 // Update implements SessionStore.
 // Implements optimistic locking: verifies Version matches, increments it,
 // updates UpdatedAt, and persists the SessionData.
 // Returns ErrVersionConflict if the version does not match.
-// Returns ErrNotFound if the session does not exist.
+// Returns ErrNotFound if the session does not exist or has expired.
+// Refreshes TTL on every write.
 func (s *InMemoryStore) Update(ctx context.Context, data *session.SessionData) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
-	stored, exists := s.sessions[data.ID]
-	if !exists {
+	entry := s.lookup(data.ID)
+	if entry == nil {
 		return session.ErrNotFound
 	}
 
-	// Check version for optimistic locking
-	if stored.Version != data.Version {
+	// Check version for optimistic locking, and that no messages were
+	// appended since the caller's read
+	if entry.data.Version != data.Version || len(entry.appended) != data.AppendedMessages {
 		return session.ErrVersionConflict
 	}
 
-	// Increment version and update timestamp
-	data.Version++
-	data.UpdatedAt = time.Now()
+	// Increment version and update timestamp on a copy, so the caller's
+	// data is left untouched if cloning fails
+	updated, err := clone(data)
+	if err != nil {
+		return err
+	}
+	updated.Version++
+	updated.SchemaVersion = session.CurrentSchemaVersion()
+	updated.UpdatedAt = s.now()
+
+	// The appended messages are now part of the stored history
+	s.unindex(entry.data)
+	s.index(updated)
+	entry.data = updated
+	entry.appended = nil
+	entry.expiry = session.ResolveExpiry(updated, s.ttl, s.maxLifetime)
+	s.refresh(entry)
+	updated.ExpiresAt = entry.expiresAt
+
+	s.emit(session.EventUpdated, data.ID, updated.Version)
+
+	data.Version = updated.Version
+	data.SchemaVersion = updated.SchemaVersion
+	data.UpdatedAt = updated.UpdatedAt
+	data.ExpiresAt = updated.ExpiresAt
+	data.AppendedMessages = 0
+	return nil
+}
+
+// Patch implements session.Patcher.
+// Copies the named fields from data into the stored session under the same
+// optimistic locking as Update.
+// Returns ErrInvalidField if a field cannot be patched.
+// Returns ErrVersionConflict if the version does not match.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *InMemoryStore) Patch(ctx context.Context, data *session.SessionData, fields ...session.Field) error {
+	if err := session.ValidatePatch(fields); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.unlock()
+
+	entry := s.lookup(data.ID)
+	if entry == nil {
+		return session.ErrNotFound
+	}
+
+	// Appended messages only conflict with a new history
+	patchHistory := slices.Contains(fields, session.FieldConversationHistory)
+	if entry.data.Version != data.Version || patchHistory && len(entry.appended) != data.AppendedMessages {
+		return session.ErrVersionConflict
+	}
+
+	updated, err := session.PatchFields(entry.data, data, fields)
+	if err != nil {
+		return err
+	}
+	updated.Version++
+	updated.UpdatedAt = s.now()
+
+	entry.data = updated
+	if patchHistory {
+		entry.appended = nil
+	}
+	entry.expiry = session.ResolveExpiry(updated, s.ttl, s.maxLifetime)
+	s.refresh(entry)
+	s.emit(session.EventUpdated, data.ID, updated.Version)
+
+	data.Version = updated.Version
+	data.SchemaVersion = updated.SchemaVersion
+	data.UpdatedAt = updated.UpdatedAt
+	data.ExpiresAt = entry.expiresAt
+	if patchHistory {
+		data.AppendedMessages = 0
+	}
+	return nil
+}
+
+// AppendMessages implements session.Appender.
+// Appends to a per-session log without incrementing Version. Refreshes TTL.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *InMemoryStore) AppendMessages(ctx context.Context, id string, msgs ...session.Message) error {
+	s.mu.Lock()
+	defer s.unlock()
+
+	entry := s.lookup(id)
+	if entry == nil {
+		return session.ErrNotFound
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	cloned, err := clone(msgs)
+	if err != nil {
+		return err
+	}
+
+	entry.appended = append(entry.appended, cloned...)
+	s.refresh(entry)
+	s.emit(session.EventUpdated, id, entry.data.Version)
+	return nil
+}
 
-	s.sessions[data.ID] = data
+// Touch implements session.Toucher.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *InMemoryStore) Touch(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.unlock()
+
+	entry := s.lookup(id)
+	if entry == nil {
+		return session.ErrNotFound
+	}
+
+	s.refresh(entry)
 	return nil
 }
 
+// List implements session.Lister.
+func (s *InMemoryStore) List(ctx context.Context, filter session.ListFilter, cursor string) ([]*session.SessionData, string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := session.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.unlock()
+
+	var matches []*memorySession
+	for id := range s.indexes[memoryIndexKey(filterIndex(filter))] {
+		entry := s.lookup(id)
+		if entry != nil && filter.Matches(entry.data) && session.PositionOf(entry.data).After(after) {
+			matches = append(matches, entry)
+		}
+	}
+	slices.SortFunc(matches, func(a, b *memorySession) int {
+		return comparePositions(a.data, b.data)
+	})
+
+	var next string
+	if len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+		next = session.EncodeCursor(session.PositionOf(matches[len(matches)-1].data))
+	}
+
+	results := make([]*session.SessionData, len(matches))
+	for i, entry := range matches {
+		result, err := clone(entry.data)
+		if err != nil {
+			return nil, "", err
+		}
+		result.ConversationHistory = nil
+		result.ExpiresAt = entry.expiresAt
+		results[i] = result
+	}
+	return results, next, nil
+}
+
 // Delete implements SessionStore.
 func (s *InMemoryStore) Delete(ctx context.Context, id string) error {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+
+	if entry := s.lookup(id); entry != nil {
+		s.remove(id)
+		s.emit(session.EventDeleted, id, entry.data.Version)
+	}
+	return nil
+}
 
-	delete(s.sessions, id)
+// Scan implements session.Scanner.
+// Copies the live sessions under the lock, then calls fn with each.
+func (s *InMemoryStore) Scan(ctx context.Context, fn func(*session.SessionData) error) error {
+	s.mu.Lock()
+	results := make([]*session.SessionData, 0, len(s.sessions))
+	for id := range s.sessions {
+		entry := s.lookup(id)
+		if entry == nil {
+			continue
+		}
+		result, err := clone(entry.data)
+		if err != nil {
+			s.unlock()
+			return err
+		}
+		result.ConversationHistory = nil
+		result.ExpiresAt = entry.expiresAt
+		results = append(results, result)
+	}
+	s.unlock()
+
+	for _, result := range results {
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// Subscribe implements session.Notifier.
+// Expired events are emitted when an expired session is accessed or freed
+// by the janitor.
+func (s *InMemoryStore) Subscribe(handler session.EventHandler) func() {
+	return s.events.Subscribe(handler)
+}
+
+// DeleteExpired removes all expired sessions from memory.
+// It is called periodically by the janitor.
+func (s *InMemoryStore) DeleteExpired() {
+	s.mu.Lock()
+	defer s.unlock()
+
+	now := s.now()
+	for id, entry := range s.sessions {
+		if !now.Before(entry.expiresAt) {
+			s.remove(id)
+			s.emit(session.EventExpired, id, entry.data.Version)
+		}
+	}
+}
+
 // Close implements SessionStore.
+// Stops the janitor and releases all sessions.
 func (s *InMemoryStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
 
 	s.sessions = nil
+	s.indexes = nil
 	return nil
 }
+
+// janitor periodically deletes expired sessions until the store is closed.
+func (s *InMemoryStore) janitor() {
+	ticker := time.NewTicker(s.janitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.DeleteExpired()
+		}
+	}
+}
+
+// lookup returns the live entry for a session, deleting it if it has
+// expired. Must be called with the write lock held.
+func (s *InMemoryStore) lookup(id string) *memorySession {
+	entry, exists := s.sessions[id]
+	if !exists {
+		return nil
+	}
+	if !s.now().Before(entry.expiresAt) {
+		s.remove(id)
+		s.emit(session.EventExpired, id, entry.data.Version)
+		return nil
+	}
+	return entry
+}
+
+// emit queues a lifecycle event, if anyone subscribed, to be delivered by
+// unlock. Must be called with the write lock held.
+func (s *InMemoryStore) emit(typ session.EventType, id string, version int64) {
+	if s.events.HasSubscribers() {
+		s.pending = append(s.pending, session.Event{Type: typ, ID: id, Version: version, Time: s.now()})
+	}
+}
+
+// unlock releases the write lock and delivers the events queued while it
+// was held, so handlers may call the store.
+func (s *InMemoryStore) unlock() {
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for _, event := range pending {
+		s.events.Emit(event)
+	}
+}
+
+// refresh extends an entry's sliding expiry, up to its deadline.
+func (s *InMemoryStore) refresh(entry *memorySession) {
+	entry.expiresAt = entry.expiry.At(s.now())
+}
+
+// clone deep-copies v through a JSON round trip, the same encoding the Redis
+// store uses.
+func clone[T any](v T) (T, error) {
+	var out T
+	b, err := json.Marshal(v)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(b, &out)
+	return out, err
+}
+
+// remove deletes a session and its index entries.
+// Must be called with the write lock held.
+func (s *InMemoryStore) remove(id string) {
+	if entry, exists := s.sessions[id]; exists {
+		s.unindex(entry.data)
+		delete(s.sessions, id)
+	}
+}
+
+// index adds a session to the indexes of its tenant, assistant and user.
+func (s *InMemoryStore) index(data *session.SessionData) {
+	for _, key := range indexKeys(data, memoryIndexKey) {
+		ids, ok := s.indexes[key]
+		if !ok {
+			ids = make(map[string]struct{})
+			s.indexes[key] = ids
+		}
+		ids[data.ID] = struct{}{}
+	}
+}
+
+// unindex removes a session from the indexes of its tenant, assistant and user.
+func (s *InMemoryStore) unindex(data *session.SessionData) {
+	for _, key := range indexKeys(data, memoryIndexKey) {
+		delete(s.indexes[key], data.ID)
+		if len(s.indexes[key]) == 0 {
+			delete(s.indexes, key)
+		}
+	}
+}
+
+// memoryIndexKey returns the key of an index in InMemoryStore.indexes.
+func memoryIndexKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// Compile-time checks that InMemoryStore implements Store and the optional interfaces.
+var (
+	_ session.Store    = (*InMemoryStore)(nil)
+	_ session.Patcher  = (*InMemoryStore)(nil)
+	_ session.Appender = (*InMemoryStore)(nil)
+	_ session.Toucher  = (*InMemoryStore)(nil)
+	_ session.Lister   = (*InMemoryStore)(nil)
+	_ session.Notifier = (*InMemoryStore)(nil)
+	_ session.Scanner  = (*InMemoryStore)(nil)
+)
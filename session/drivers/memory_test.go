@@ -0,0 +1,164 @@
+package drivers
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/sessiontest"
+)
+
+func TestInMemoryStore(t *testing.T) {
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		return NewInMemoryStore()
+	})
+}
+
+// fakeClock is a manually advanced clock for WithClock.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newClockedStore returns a memory store reading time from a fake clock,
+// without janitor, and the events it emits.
+func newClockedStore(t *testing.T, opts ...MemoryOption) (*InMemoryStore, *fakeClock, *[]session.Event) {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+	opts = append([]MemoryOption{WithClock(clock.Now), WithJanitorInterval(0)}, opts...)
+	store := NewInMemoryStore(opts...)
+	t.Cleanup(func() { store.Close() })
+
+	// Handlers run synchronously, after the operation emitting the event
+	var events []session.Event
+	store.Subscribe(func(event session.Event) {
+		events = append(events, event)
+	})
+	return store, clock, &events
+}
+
+// expectExpired checks that the last event is the expiry of the session id
+// at the current time of clock.
+func expectExpired(t *testing.T, events []session.Event, id string, clock *fakeClock) {
+	t.Helper()
+	if len(events) == 0 {
+		t.Fatal("no event emitted")
+	}
+	last := events[len(events)-1]
+	if last.Type != session.EventExpired || last.ID != id || last.Version != 1 || !last.Time.Equal(clock.Now()) {
+		t.Errorf("last event = %+v, want %s expired at %v", last, id, clock.Now())
+	}
+}
+
+func TestInMemoryStoreIdleTTL(t *testing.T) {
+	store, clock, events := newClockedStore(t, WithMemoryTTL(time.Minute))
+	ctx := context.Background()
+	if err := store.Create(ctx, &session.SessionData{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every access extends the idle expiry
+	for range 3 {
+		clock.Advance(50 * time.Second)
+		data, err := store.Get(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data == nil {
+			t.Fatalf("Get() = nil at %v, before the idle TTL", clock.Now())
+		}
+		if want := clock.Now().Add(time.Minute); !data.ExpiresAt.Equal(want) {
+			t.Errorf("Get() ExpiresAt = %v, want %v", data.ExpiresAt, want)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	data, err := store.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != nil {
+		t.Fatalf("Get() = %+v past the idle TTL, want nil", data)
+	}
+	expectExpired(t, *events, "a", clock)
+
+	// The session is gone, and expires only once
+	count := len(*events)
+	if err := store.Touch(ctx, "a"); err != session.ErrNotFound {
+		t.Errorf("Touch() error = %v, want ErrNotFound", err)
+	}
+	if len(*events) != count {
+		t.Errorf("events after expiry = %+v", (*events)[count:])
+	}
+}
+
+func TestInMemoryStoreMaxLifetime(t *testing.T) {
+	store, clock, events := newClockedStore(t, WithMemoryTTL(time.Hour), WithMemoryMaxLifetime(10*time.Minute))
+	ctx := context.Background()
+	data := &session.SessionData{ID: "a"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	deadline := clock.Now().Add(10 * time.Minute)
+	if !data.ExpiresAt.Equal(deadline) {
+		t.Errorf("Create() ExpiresAt = %v, want %v", data.ExpiresAt, deadline)
+	}
+
+	// Activity does not extend the session past its deadline
+	for range 3 {
+		clock.Advance(3 * time.Minute)
+		if err := store.Touch(ctx, "a"); err != nil {
+			t.Fatalf("Touch() at %v error = %v", clock.Now(), err)
+		}
+	}
+
+	clock.Advance(time.Minute)
+	got, err := store.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != nil {
+		t.Fatalf("Get() = %+v past MaxLifetime, want nil", got)
+	}
+	expectExpired(t, *events, "a", clock)
+}
+
+func TestInMemoryStoreDeleteExpired(t *testing.T) {
+	store, clock, events := newClockedStore(t, WithMemoryTTL(time.Minute))
+	ctx := context.Background()
+	for _, id := range []string{"a", "b"} {
+		if err := store.Create(ctx, &session.SessionData{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := store.Touch(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+	store.DeleteExpired()
+	expectExpired(t, *events, "a", clock)
+
+	store.mu.RLock()
+	_, kept := store.sessions["b"]
+	count := len(store.sessions)
+	store.mu.RUnlock()
+	if !kept || count != 1 {
+		t.Errorf("DeleteExpired() kept %d sessions, want only b", count)
+	}
+}
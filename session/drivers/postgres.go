@@ -0,0 +1,653 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creastat/storage/session"
+)
+
+const (
+	// Default table for Postgres sessions
+	defaultPostgresTable = "sessions"
+	// Default interval between deletions of expired Postgres sessions
+	defaultReapInterval = time.Minute
+	// Maximum number of expired sessions deleted per statement
+	reapBatchSize = 1000
+)
+
+func init() {
+	session.Register(session.StoreTypePostgres, func(cfg session.Config) (session.Store, error) {
+		if cfg.PostgresDB == nil {
+			return nil, session.ErrInvalidConfig
+		}
+		return NewPostgresStore(cfg.PostgresDB, WithPostgresTTL(cfg.TTL), WithPostgresMaxLifetime(cfg.MaxLifetime),
+			WithPostgresCipher(cfg.Cipher)), nil
+	})
+}
+
+// PostgresOption is a functional option for configuring a PostgresStore.
+type PostgresOption func(*PostgresStore)
+
+// WithPostgresTTL sets the default idle TTL of Postgres sessions.
+// Zero or negative values keep the default (24 hours).
+func WithPostgresTTL(ttl time.Duration) PostgresOption {
+	return func(s *PostgresStore) {
+		if ttl > 0 {
+			s.ttl = ttl
+		}
+	}
+}
+
+// WithPostgresMaxLifetime sets the default absolute lifetime of Postgres
+// sessions. Zero (the default) means sessions only expire when idle.
+func WithPostgresMaxLifetime(lifetime time.Duration) PostgresOption {
+	return func(s *PostgresStore) {
+		s.maxLifetime = lifetime
+	}
+}
+
+// WithPostgresTable sets the table holding sessions (default: "sessions").
+// The name may be schema-qualified; it is used unquoted.
+func WithPostgresTable(table string) PostgresOption {
+	return func(s *PostgresStore) {
+		s.queries = newPostgresQueries(table)
+	}
+}
+
+// WithPostgresCipher encrypts the JSONB values of Postgres sessions with
+// cipher: each field of the data column and each message of the history is
+// stored as a JSON string holding the ciphertext. The ID columns, version
+// and expiry stay in plaintext.
+func WithPostgresCipher(cipher session.Cipher) PostgresOption {
+	return func(s *PostgresStore) {
+		s.sealer.cipher = cipher
+	}
+}
+
+// WithReapInterval sets how often expired sessions are deleted from the
+// table. Zero or negative values disable the background reaper; expired
+// sessions are still never returned, and DeleteExpired can be called
+// directly.
+func WithReapInterval(interval time.Duration) PostgresOption {
+	return func(s *PostgresStore) {
+		s.reapInterval = interval
+	}
+}
+
+// PostgresStore implements SessionStore using a Postgres table with
+// optimistic locking, for deployments without Redis.
+// Every operation is a single statement: writes compare and bump the version
+// column, and reads refresh the expires_at column, which every query treats
+// as the session's expiry. A background reaper deletes expired rows until
+// Close is called. See postgres_sql.go for the table layout; EnsureSchema
+// creates it.
+// Lifecycle events are emitted for the operations of this store only, not
+// for those of other instances sharing the table.
+type PostgresStore struct {
+	db           *sql.DB
+	queries      postgresQueries
+	ttl          time.Duration
+	maxLifetime  time.Duration
+	reapInterval time.Duration
+	sealer       sealer
+	events       session.Broadcaster
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPostgresStore creates a new Postgres-based session store.
+// db must use a Postgres database/sql driver (such as pgx's stdlib or
+// lib/pq); the caller keeps ownership of it, and Close does not close it.
+// Call Close to stop the background reaper.
+func NewPostgresStore(db *sql.DB, opts ...PostgresOption) *PostgresStore {
+	s := &PostgresStore{
+		db:           db,
+		queries:      newPostgresQueries(defaultPostgresTable),
+		ttl:          defaultTTL,
+		reapInterval: defaultReapInterval,
+		stop:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.reapInterval > 0 {
+		go s.reaper()
+	}
+	return s
+}
+
+// EnsureSchema creates the session table and its indexes if they do not
+// exist.
+func (s *PostgresStore) EnsureSchema(ctx context.Context) error {
+	for _, stmt := range s.queries.schema {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create implements SessionStore.
+// Creates a new session with Version set to 1 and sets TTL, only if no live
+// session with the same ID exists. An expired session not yet reaped is
+// replaced, and an expired event emitted for it before the created event.
+// Returns ErrAlreadyExists if the session already exists.
+func (s *PostgresStore) Create(ctx context.Context, data *session.SessionData) error {
+	// Work on a copy so data is left unchanged if the session exists
+	record := *data
+	now := time.Now()
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	record.Version = 1
+	record.SchemaVersion = session.CurrentSchemaVersion()
+
+	row, err := s.encode(ctx, &record, now, nil)
+	if err != nil {
+		return err
+	}
+
+	var inserted bool
+	var replaced sql.NullInt64
+	err = s.db.QueryRowContext(ctx, s.queries.create,
+		record.ID, record.TenantID, record.AssistantID, record.UserID,
+		now.UnixMilli(), record.ExpiresAt, row.idleTTL, row.deadline, row.history, row.data,
+		postgresTime(now)).Scan(&inserted, &replaced)
+	if err == sql.ErrNoRows {
+		return session.ErrAlreadyExists
+	}
+	if err != nil {
+		return err
+	}
+
+	*data = record
+	if !inserted {
+		s.emit(session.EventExpired, data.ID, replaced.Int64)
+	}
+	s.emit(session.EventCreated, data.ID, data.Version)
+	return nil
+}
+
+// Get implements SessionStore.
+// Returns nil if the session is not found or has expired (not an error).
+// Refreshes TTL on every read.
+func (s *PostgresStore) Get(ctx context.Context, id string) (*session.SessionData, error) {
+	data, err := s.scanSession(ctx, s.db.QueryRowContext(ctx, s.queries.get, id, postgresTime(time.Now())))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil // Not found
+	}
+	return data, err
+}
+
+// Update implements SessionStore.
+// Implements optimistic locking with a single UPDATE that compares and bumps
+// the version column.
+// Returns ErrVersionConflict if the version does not match or messages were
+// appended since the data was read.
+// Returns ErrNotFound if the session does not exist or has expired.
+// Refreshes TTL on every write.
+func (s *PostgresStore) Update(ctx context.Context, data *session.SessionData) error {
+	return s.write(ctx, data, nil)
+}
+
+// Patch implements session.Patcher.
+// Merges only the named fields into the data column, and writes the history
+// only if FieldConversationHistory is named.
+// Returns ErrInvalidField if a field cannot be patched.
+// Returns ErrVersionConflict if the version does not match.
+// Returns ErrNotFound if the session does not exist or has expired.
+// Refreshes TTL on every write.
+func (s *PostgresStore) Patch(ctx context.Context, data *session.SessionData, fields ...session.Field) error {
+	if err := session.ValidatePatch(fields); err != nil {
+		return err
+	}
+	return s.write(ctx, data, fields)
+}
+
+// write implements Update (fields == nil) and Patch.
+func (s *PostgresStore) write(ctx context.Context, data *session.SessionData, fields []session.Field) error {
+	// Work on a copy so data is left unchanged on conflict
+	record := *data
+	now := time.Now()
+	record.Version++
+	record.UpdatedAt = now
+	// A patch leaves the other fields, and so their schema, as stored
+	if fields == nil {
+		record.SchemaVersion = session.CurrentSchemaVersion()
+	}
+
+	row, err := s.encode(ctx, &record, now, fields)
+	if err != nil {
+		return err
+	}
+	expectedAppended := -1
+	if row.writeHistory {
+		expectedAppended = data.AppendedMessages
+	}
+
+	res, err := s.db.ExecContext(ctx, s.queries.write,
+		data.ID, postgresTime(now), fields == nil,
+		record.TenantID, record.AssistantID, record.UserID, row.data,
+		row.writeHistory, row.history, row.idleTTL, row.deadline, record.ExpiresAt,
+		data.Version, expectedAppended)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, s.queries.exists, data.ID, postgresTime(now)).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return session.ErrVersionConflict
+		}
+		return session.ErrNotFound
+	}
+
+	// The appended messages are now part of the stored history
+	if row.writeHistory {
+		record.AppendedMessages = 0
+	}
+	*data = record
+	s.emit(session.EventUpdated, data.ID, data.Version)
+	return nil
+}
+
+// AppendMessages implements session.Appender.
+// Appends to the history column without touching the rest of the session
+// or incrementing Version. Refreshes TTL.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *PostgresStore) AppendMessages(ctx context.Context, id string, msgs ...session.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	val, err := s.encodeMessages(ctx, id, msgs)
+	if err != nil {
+		return err
+	}
+
+	var version int64
+	err = s.db.QueryRowContext(ctx, s.queries.appendMessages, id, postgresTime(time.Now()), string(val), len(msgs)).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s.emit(session.EventUpdated, id, version)
+	return nil
+}
+
+// Touch implements session.Toucher.
+// Returns ErrNotFound if the session does not exist or has expired.
+func (s *PostgresStore) Touch(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, s.queries.touch, id, postgresTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return session.ErrNotFound
+	}
+	return nil
+}
+
+// List implements session.Lister.
+// Filters on the indexed ID columns and pages by (created_ms, id).
+func (s *PostgresStore) List(ctx context.Context, filter session.ListFilter, cursor string) ([]*session.SessionData, string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := session.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := []any{postgresTime(time.Now()), after.CreatedAt, after.ID}
+	conds := []string{"expires_at > $1", "(created_ms, id) > ($2, $3)"}
+	for _, f := range []struct{ column, id string }{
+		{"tenant_id", filter.TenantID},
+		{"assistant_id", filter.AssistantID},
+		{"user_id", filter.UserID},
+	} {
+		if f.id != "" {
+			args = append(args, f.id)
+			conds = append(conds, fmt.Sprintf("%s = $%d", f.column, len(args)))
+		}
+	}
+	args = append(args, filter.Limit+1)
+	// Sessions are listed without their history
+	query := fmt.Sprintf(`SELECT id, tenant_id, assistant_id, user_id, version, expires_at, 0, NULL::jsonb, data
+FROM %s WHERE %s ORDER BY created_ms, id LIMIT $%d`, s.queries.table, strings.Join(conds, " AND "), len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var results []*session.SessionData
+	for rows.Next() {
+		data, err := s.scanSession(ctx, rows)
+		if err != nil {
+			return nil, "", err
+		}
+		results = append(results, data)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if len(results) > filter.Limit {
+		results = results[:filter.Limit]
+		next = session.EncodeCursor(session.PositionOf(results[len(results)-1]))
+	}
+	return results, next, nil
+}
+
+// Delete implements SessionStore.
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	var version int64
+	var live bool
+	err := s.db.QueryRowContext(ctx, s.queries.delete, id, postgresTime(time.Now())).Scan(&version, &live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // Not found
+	}
+	if err != nil {
+		return err
+	}
+
+	if live {
+		s.emit(session.EventDeleted, id, version)
+	} else {
+		s.emit(session.EventExpired, id, version)
+	}
+	return nil
+}
+
+// DeleteExpired deletes all expired sessions from the table.
+// It is called periodically by the reaper; several stores may reap the same
+// table concurrently.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) error {
+	for {
+		rows, err := s.db.QueryContext(ctx, s.queries.reap, postgresTime(time.Now()), reapBatchSize)
+		if err != nil {
+			return err
+		}
+
+		deleted := 0
+		for rows.Next() {
+			var id string
+			var version int64
+			if err := rows.Scan(&id, &version); err != nil {
+				rows.Close()
+				return err
+			}
+			deleted++
+			s.emit(session.EventExpired, id, version)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if deleted < reapBatchSize {
+			return nil
+		}
+	}
+}
+
+// Scan implements session.Scanner.
+// Pages through the live rows by ID, a batch per query.
+func (s *PostgresStore) Scan(ctx context.Context, fn func(*session.SessionData) error) error {
+	after := ""
+	for {
+		// Read the whole batch first, so fn can use the connection
+		rows, err := s.db.QueryContext(ctx, s.queries.scan, after, postgresTime(time.Now()), scanBatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []*session.SessionData
+		for rows.Next() {
+			data, err := s.scanSession(ctx, rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, data)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, data := range batch {
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+		if len(batch) < scanBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
+
+// Subscribe implements session.Notifier.
+// Expired events are emitted when the reaper deletes an expired session, or
+// when Delete finds it expired.
+func (s *PostgresStore) Subscribe(handler session.EventHandler) func() {
+	return s.events.Subscribe(handler)
+}
+
+// Close implements SessionStore.
+// Stops the reaper. The database is left open.
+func (s *PostgresStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	return nil
+}
+
+// reaper periodically deletes expired sessions until the store is closed.
+func (s *PostgresStore) reaper() {
+	ticker := time.NewTicker(s.reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			// Failures are retried on the next tick
+			_ = s.DeleteExpired(context.Background())
+		}
+	}
+}
+
+// emit delivers a lifecycle event, if anyone subscribed.
+func (s *PostgresStore) emit(typ session.EventType, id string, version int64) {
+	if s.events.HasSubscribers() {
+		s.events.Emit(session.Event{Type: typ, ID: id, Version: version, Time: time.Now()})
+	}
+}
+
+// postgresRow holds the encoded column values of a session.
+type postgresRow struct {
+	data         string
+	history      any // JSON, or nil if the history is not written
+	writeHistory bool
+	idleTTL      int64
+	deadline     any // time.Time, or nil if none
+}
+
+// encode sets data.ExpiresAt and returns the column values writing data.
+// fields lists the fields to patch, or nil to replace the whole session.
+func (s *PostgresStore) encode(ctx context.Context, data *session.SessionData, now time.Time, fields []session.Field) (postgresRow, error) {
+	expiry := session.ResolveExpiry(data, s.ttl, s.maxLifetime)
+	data.ExpiresAt = postgresTime(expiry.At(now))
+
+	encoded, err := session.MarshalFields(data)
+	if err != nil {
+		return postgresRow{}, err
+	}
+
+	// Fields kept elsewhere: the IDs and Version in their columns, the
+	// history in its own column, and ExpiresAt computed on every access
+	for _, f := range []session.Field{session.FieldID, session.FieldTenantID, session.FieldAssistantID,
+		session.FieldUserID, session.FieldVersion, session.FieldConversationHistory, session.FieldExpiresAt} {
+		delete(encoded, f)
+	}
+
+	row := postgresRow{
+		writeHistory: fields == nil || slices.Contains(fields, session.FieldConversationHistory),
+		idleTTL:      expiry.IdleTTL.Milliseconds(),
+	}
+	if !expiry.Deadline.IsZero() {
+		row.deadline = postgresTime(expiry.Deadline)
+	}
+
+	if fields != nil {
+		// UpdatedAt always changes; fields omitted when empty are written
+		// as null, which decodes to the zero value
+		patch := make(map[session.Field]json.RawMessage, len(fields)+1)
+		for _, f := range slices.Concat(fields, []session.Field{session.FieldUpdatedAt}) {
+			if f == session.FieldConversationHistory {
+				continue
+			}
+			v, ok := encoded[f]
+			if !ok {
+				v = json.RawMessage("null")
+			}
+			patch[f] = v
+		}
+		encoded = patch
+	}
+	for f, v := range encoded {
+		if encoded[f], err = s.sealer.sealJSON(ctx, data.ID, f, v); err != nil {
+			return postgresRow{}, err
+		}
+	}
+	val, err := json.Marshal(encoded)
+	if err != nil {
+		return postgresRow{}, err
+	}
+	row.data = string(val)
+
+	if row.writeHistory {
+		if row.history, err = s.encodeMessages(ctx, data.ID, data.ConversationHistory); err != nil {
+			return postgresRow{}, err
+		}
+	}
+	return row, nil
+}
+
+// encodeMessages encodes messages as a JSON array, for the history column.
+func (s *PostgresStore) encodeMessages(ctx context.Context, id string, msgs []session.Message) (string, error) {
+	vals := make([]json.RawMessage, len(msgs))
+	for i, msg := range msgs {
+		val, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		if vals[i], err = s.sealer.sealJSON(ctx, id, session.FieldConversationHistory, val); err != nil {
+			return "", err
+		}
+	}
+	val, err := json.Marshal(vals)
+	return string(val), err
+}
+
+// scanSession decodes a row of postgresColumns, upgrading it to the current
+// schema. The history is NULL when it is not read.
+func (s *PostgresStore) scanSession(ctx context.Context, row interface{ Scan(dest ...any) error }) (*session.SessionData, error) {
+	var id, tenantID, assistantID, userID string
+	var version int64
+	var expiresAt time.Time
+	var appended int
+	var history, fields []byte
+	if err := row.Scan(&id, &tenantID, &assistantID, &userID, &version, &expiresAt, &appended, &history, &fields); err != nil {
+		return nil, err
+	}
+
+	var encoded map[session.Field]json.RawMessage
+	if err := json.Unmarshal(fields, &encoded); err != nil {
+		return nil, err
+	}
+	for f, v := range encoded {
+		var err error
+		if encoded[f], err = s.sealer.openJSON(ctx, id, f, v); err != nil {
+			return nil, err
+		}
+	}
+	if history != nil {
+		var msgs []json.RawMessage
+		if err := json.Unmarshal(history, &msgs); err != nil {
+			return nil, err
+		}
+		for i, v := range msgs {
+			var err error
+			if msgs[i], err = s.sealer.openJSON(ctx, id, session.FieldConversationHistory, v); err != nil {
+				return nil, err
+			}
+		}
+		if len(msgs) > 0 {
+			v, err := json.Marshal(msgs)
+			if err != nil {
+				return nil, err
+			}
+			encoded[session.FieldConversationHistory] = v
+		}
+	}
+
+	if err := session.UpgradeFields(encoded); err != nil {
+		return nil, err
+	}
+	var data session.SessionData
+	if err := session.UnmarshalFields(encoded, &data); err != nil {
+		return nil, err
+	}
+	data.ID = id
+	data.TenantID = tenantID
+	data.AssistantID = assistantID
+	data.UserID = userID
+	data.Version = version
+	data.ExpiresAt = expiresAt
+	data.AppendedMessages = appended
+	return &data, nil
+}
+
+// postgresTime rounds a time down to the microsecond precision of Postgres
+// timestamps, which would otherwise round it to the nearest microsecond.
+func postgresTime(t time.Time) time.Time {
+	return t.Truncate(time.Microsecond)
+}
+
+// Compile-time checks that PostgresStore implements Store and the optional interfaces.
+var (
+	_ session.Store    = (*PostgresStore)(nil)
+	_ session.Patcher  = (*PostgresStore)(nil)
+	_ session.Appender = (*PostgresStore)(nil)
+	_ session.Toucher  = (*PostgresStore)(nil)
+	_ session.Lister   = (*PostgresStore)(nil)
+	_ session.Notifier = (*PostgresStore)(nil)
+	_ session.Scanner  = (*PostgresStore)(nil)
+)
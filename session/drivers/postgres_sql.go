@@ -0,0 +1,189 @@
+package drivers
+
+import "strings"
+
+// Sessions are rows of a single table. The columns the store queries by are
+// real columns; every other SessionData field is stored in the data column,
+// a JSONB object with one member per field, named by session.Field, holding
+// its JSON encoding (as in the Redis hash). The history is a JSONB array of
+// messages, so appends and setting changes never rewrite each other. With a
+// cipher, fields and messages are JSON strings holding their ciphertext.
+//
+// Columns:
+//   - id, tenant_id, assistant_id, user_id: the session's IDs, "" if unset.
+//     IDs use the "C" collation, so List orders them byte-wise.
+//   - version: Version, compared and bumped by updates
+//   - created_ms: creation time in Unix milliseconds, the List order
+//   - expires_at: when the session expires; earlier rows are treated as
+//     missing and deleted by the reaper
+//   - idle_ttl_ms, deadline: the idle TTL and absolute expiry (NULL if none)
+//     from which expires_at is refreshed
+//   - appended: number of messages appended since the history was last written
+//   - history: the conversation history
+//   - data: the remaining fields
+//
+// Queries refer to the table as {table}, and name indexes with the {index}
+// prefix. The current time is always passed by the store rather than read
+// from the server clock.
+
+// postgresSchema creates the session table and its indexes, one statement
+// at a time.
+var postgresSchema = []string{`
+CREATE TABLE IF NOT EXISTS {table} (
+	id           text COLLATE "C" PRIMARY KEY,
+	tenant_id    text COLLATE "C" NOT NULL DEFAULT '',
+	assistant_id text COLLATE "C" NOT NULL DEFAULT '',
+	user_id      text COLLATE "C" NOT NULL DEFAULT '',
+	version      bigint      NOT NULL,
+	created_ms   bigint      NOT NULL,
+	expires_at   timestamptz NOT NULL,
+	idle_ttl_ms  bigint      NOT NULL,
+	deadline     timestamptz,
+	appended     integer     NOT NULL DEFAULT 0,
+	history      jsonb       NOT NULL DEFAULT '[]',
+	data         jsonb       NOT NULL
+)`,
+	`CREATE INDEX IF NOT EXISTS {index}_expires_at_idx ON {table} (expires_at)`,
+	`CREATE INDEX IF NOT EXISTS {index}_tenant_idx ON {table} (tenant_id, created_ms, id)`,
+	`CREATE INDEX IF NOT EXISTS {index}_assistant_idx ON {table} (assistant_id, created_ms, id)`,
+	`CREATE INDEX IF NOT EXISTS {index}_user_idx ON {table} (user_id, created_ms, id)`,
+}
+
+// postgresColumns are the columns read by scanSession.
+const postgresColumns = `id, tenant_id, assistant_id, user_id, version, expires_at, appended, history, data`
+
+// postgresRefresh returns the expiry of a session refreshed at the time in
+// the given parameter.
+func postgresRefresh(now string) string {
+	return `LEAST(` + now + `::timestamptz + idle_ttl_ms * INTERVAL '1 millisecond', COALESCE(deadline, 'infinity'))`
+}
+
+// postgresCreate inserts a session, or replaces an expired session with the
+// same ID. Returns whether the row was inserted rather than replaced
+// (xmax is only set on replaced rows) and the version of the session
+// replaced, read from the statement's snapshot. Returns no row if a live
+// session exists.
+// $1..$4 = IDs, $5 = created_ms, $6 = expires_at, $7 = idle_ttl_ms,
+// $8 = deadline, $9 = history, $10 = data, $11 = current time.
+const postgresCreate = `
+WITH replaced AS (SELECT version FROM {table} WHERE id = $1)
+INSERT INTO {table} AS s (id, tenant_id, assistant_id, user_id, version, created_ms, expires_at, idle_ttl_ms, deadline, appended, history, data)
+VALUES ($1, $2, $3, $4, 1, $5, $6, $7, $8::timestamptz, 0, $9::jsonb, $10::jsonb)
+ON CONFLICT (id) DO UPDATE SET
+	tenant_id = EXCLUDED.tenant_id,
+	assistant_id = EXCLUDED.assistant_id,
+	user_id = EXCLUDED.user_id,
+	version = 1,
+	created_ms = EXCLUDED.created_ms,
+	expires_at = EXCLUDED.expires_at,
+	idle_ttl_ms = EXCLUDED.idle_ttl_ms,
+	deadline = EXCLUDED.deadline,
+	appended = 0,
+	history = EXCLUDED.history,
+	data = EXCLUDED.data
+WHERE s.expires_at <= $11
+RETURNING (s.xmax = 0), (SELECT version FROM replaced)`
+
+// postgresGet reads a live session and refreshes its expiry.
+// $1 = ID, $2 = current time.
+var postgresGet = `
+UPDATE {table} SET expires_at = ` + postgresRefresh("$2") + `
+WHERE id = $1 AND expires_at > $2
+RETURNING ` + postgresColumns
+
+// postgresWrite writes a live session, or patches fields of it, if its
+// version matches and, when the history is written, no messages were
+// appended since it was read. Affects no row otherwise.
+// $1 = ID, $2 = current time, $3 = true to replace all fields, $4..$6 = IDs,
+// $7 = data (merged into the stored data when patching), $8 = true to
+// replace the history, $9 = history, $10 = idle_ttl_ms, $11 = deadline,
+// $12 = expires_at, $13 = expected version, $14 = expected number of
+// appended messages, or -1 if the history is not written.
+const postgresWrite = `
+UPDATE {table} SET
+	version = version + 1,
+	tenant_id = CASE WHEN $3::boolean THEN $4::text ELSE tenant_id END,
+	assistant_id = CASE WHEN $3::boolean THEN $5::text ELSE assistant_id END,
+	user_id = CASE WHEN $3::boolean THEN $6::text ELSE user_id END,
+	data = CASE WHEN $3::boolean THEN $7::jsonb ELSE data || $7::jsonb END,
+	history = CASE WHEN $8::boolean THEN $9::jsonb ELSE history END,
+	appended = CASE WHEN $8::boolean THEN 0 ELSE appended END,
+	idle_ttl_ms = $10,
+	deadline = $11::timestamptz,
+	expires_at = $12
+WHERE id = $1 AND expires_at > $2 AND version = $13 AND ($14::integer < 0 OR appended = $14::integer)`
+
+// postgresExists reports whether a live session exists.
+// $1 = ID, $2 = current time.
+const postgresExists = `SELECT EXISTS (SELECT 1 FROM {table} WHERE id = $1 AND expires_at > $2)`
+
+// postgresAppend appends messages to a live session's history and refreshes
+// its expiry. Returns the session's version.
+// $1 = ID, $2 = current time, $3 = messages, $4 = number of messages.
+var postgresAppend = `
+UPDATE {table} SET
+	history = history || $3::jsonb,
+	appended = appended + $4,
+	expires_at = ` + postgresRefresh("$2") + `
+WHERE id = $1 AND expires_at > $2
+RETURNING version`
+
+// postgresTouch refreshes a live session's expiry.
+// $1 = ID, $2 = current time.
+var postgresTouch = `
+UPDATE {table} SET expires_at = ` + postgresRefresh("$2") + `
+WHERE id = $1 AND expires_at > $2`
+
+// postgresDelete deletes a session. Returns its version and whether it was
+// live. $1 = ID, $2 = current time.
+const postgresDelete = `DELETE FROM {table} WHERE id = $1 RETURNING version, expires_at > $2`
+
+// postgresScan reads a batch of live sessions without their history, in ID
+// order. $1 = ID to start after, $2 = current time, $3 = batch size.
+const postgresScan = `
+SELECT id, tenant_id, assistant_id, user_id, version, expires_at, 0, NULL::jsonb, data
+FROM {table} WHERE id > $1 AND expires_at > $2
+ORDER BY id
+LIMIT $3`
+
+// postgresReap deletes a batch of expired sessions, skipping rows locked by
+// another reaper. Returns the IDs and versions deleted.
+// $1 = current time, $2 = batch size.
+const postgresReap = `
+DELETE FROM {table} WHERE id IN (
+	SELECT id FROM {table} WHERE expires_at <= $1
+	ORDER BY expires_at
+	LIMIT $2
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING id, version`
+
+// postgresQueries holds the queries for a table.
+type postgresQueries struct {
+	table  string
+	schema []string
+
+	create, get, write, exists, appendMessages, touch, delete, scan, reap string
+}
+
+// newPostgresQueries prepares the queries for a table. The table name may be
+// schema-qualified; it is not quoted.
+func newPostgresQueries(table string) postgresQueries {
+	r := strings.NewReplacer("{table}", table, "{index}", strings.ReplaceAll(table, ".", "_"))
+	q := postgresQueries{
+		table:          table,
+		create:         r.Replace(postgresCreate),
+		get:            r.Replace(postgresGet),
+		write:          r.Replace(postgresWrite),
+		exists:         r.Replace(postgresExists),
+		appendMessages: r.Replace(postgresAppend),
+		touch:          r.Replace(postgresTouch),
+		delete:         r.Replace(postgresDelete),
+		scan:           r.Replace(postgresScan),
+		reap:           r.Replace(postgresReap),
+	}
+	for _, stmt := range postgresSchema {
+		q.schema = append(q.schema, r.Replace(stmt))
+	}
+	return q
+}
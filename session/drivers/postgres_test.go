@@ -0,0 +1,103 @@
+package drivers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/sessiontest"
+)
+
+// openTestDB opens the database in TEST_DATABASE_URL, or skips the test.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping test database: %v", err)
+	}
+	return db
+}
+
+// newTestTable creates a fresh session table, dropped when the test ends,
+// and returns its name.
+func newTestTable(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	table := fmt.Sprintf("sessions_test_%d", time.Now().UnixNano())
+	if err := NewPostgresStore(db, WithPostgresTable(table), WithReapInterval(0)).EnsureSchema(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec("DROP TABLE " + table); err != nil {
+			t.Errorf("drop %s: %v", table, err)
+		}
+	})
+	return table
+}
+
+func TestPostgresStore(t *testing.T) {
+	db := openTestDB(t)
+	table := newTestTable(t, db)
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		return NewPostgresStore(db, WithPostgresTable(table))
+	})
+}
+
+func TestPostgresCreateReplacesExpired(t *testing.T) {
+	db := openTestDB(t)
+	table := newTestTable(t, db)
+	store := NewPostgresStore(db, WithPostgresTable(table), WithReapInterval(0))
+	t.Cleanup(func() { store.Close() })
+	ctx := context.Background()
+
+	id := fmt.Sprintf("expired:%d", time.Now().UnixNano())
+	if err := store.Create(ctx, &session.SessionData{ID: id}); err != nil {
+		t.Fatal(err)
+	}
+	// Expire the session at version 2, as the reaper is disabled
+	_, err := db.Exec("UPDATE "+table+" SET version = 2, expires_at = $1 WHERE id = $2", time.Now().Add(-time.Second), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []session.Event
+	unsubscribe := store.Subscribe(func(event session.Event) {
+		events = append(events, event)
+	})
+	defer unsubscribe()
+
+	data := &session.SessionData{ID: id, Language: "de"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatalf("Create() over expired session error = %v", err)
+	}
+	if data.Version != 1 {
+		t.Errorf("Create() Version = %d, want 1", data.Version)
+	}
+	if len(events) != 2 ||
+		events[0].Type != session.EventExpired || events[0].ID != id || events[0].Version != 2 ||
+		events[1].Type != session.EventCreated || events[1].ID != id || events[1].Version != 1 {
+		t.Errorf("events = %+v, want expired at version 2, then created", events)
+	}
+
+	// A live session is not replaced, and emits nothing
+	events = nil
+	if err := store.Create(ctx, &session.SessionData{ID: id}); err != session.ErrAlreadyExists {
+		t.Errorf("Create() over live session error = %v, want ErrAlreadyExists", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("events = %+v, want none", events)
+	}
+}
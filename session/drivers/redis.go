@@ -3,6 +3,10 @@ package drivers
 import (
 	"context"
 	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/creastat/storage/session"
@@ -12,50 +16,177 @@ import (
 const (
 	// Redis key prefix for sessions
 	sessionKeyPrefix = "session:"
+	// Redis key suffix for the conversation history list
+	historyKeySuffix = ":history"
+	// Redis key suffix for the appended message list of an earlier layout
+	legacyMessagesKeySuffix = ":messages"
+	// Redis key prefix for the tenant, assistant and user indexes
+	indexKeyPrefix = "session:index:"
+	// Number of keys requested per SCAN by Scan
+	scanBatchSize = 100
+	// Pub/Sub channel of lifecycle events published with WithRedisEvents
+	eventsChannel = "session:events"
+	// Pub/Sub pattern of the keyspace notifications for expired keys
+	expiredEventsPattern = "__keyevent@*__:expired"
 	// Default TTL for session keys (24 hours)
 	defaultTTL = 24 * time.Hour
 )
 
+func init() {
+	session.Register(session.StoreTypeRedis, func(cfg session.Config) (session.Store, error) {
+		if cfg.RedisClient == nil {
+			return nil, session.ErrInvalidConfig
+		}
+		ttl := cfg.RedisTTL
+		if ttl <= 0 {
+			ttl = cfg.TTL
+		}
+		opts := []RedisOption{WithRedisMaxLifetime(cfg.MaxLifetime)}
+		if cfg.Events {
+			opts = append(opts, WithRedisEvents())
+		}
+		if cfg.Cipher != nil {
+			opts = append(opts, WithRedisCipher(cfg.Cipher))
+		}
+		if cfg.Codec != nil {
+			opts = append(opts, WithRedisCodec(cfg.Codec))
+		}
+		return NewRedisStore(cfg.RedisClient, ttl, opts...), nil
+	})
+}
+
+// RedisOption is a functional option for configuring a RedisStore.
+type RedisOption func(*RedisStore)
+
+// WithRedisMaxLifetime sets the default absolute lifetime of Redis sessions.
+// Zero (the default) means sessions only expire when idle.
+func WithRedisMaxLifetime(lifetime time.Duration) RedisOption {
+	return func(s *RedisStore) {
+		s.maxLifetime = lifetime
+	}
+}
+
+// WithRedisEvents makes the store publish created, updated and deleted
+// events on the session:events Pub/Sub channel, at the cost of one more
+// round trip per write. Every store subscribed to events receives them,
+// whichever instance published them.
+func WithRedisEvents() RedisOption {
+	return func(s *RedisStore) {
+		s.publishEvents = true
+	}
+}
+
+// WithRedisCipher encrypts the session fields and messages stored in Redis
+// with cipher. The tenant, assistant and user IDs, the control fields and
+// the key names stay in plaintext.
+func WithRedisCipher(cipher session.Cipher) RedisOption {
+	return func(s *RedisStore) {
+		s.sealer.cipher = cipher
+	}
+}
+
+// WithRedisCodec encodes the session fields and messages stored in Redis
+// with codec, before they are encrypted. Values written by stores with any
+// other codec, or none, are still read.
+func WithRedisCodec(codec session.Codec) RedisOption {
+	return func(s *RedisStore) {
+		s.sealer.codec = codec
+	}
+}
+
+// WithRedisErrorHandler sets a function called with the errors of updating
+// the tenant, assistant and user indexes of a session once it is written,
+// which are otherwise dropped. The write itself has succeeded by then, so
+// Create and Update do not fail; the session is missing from List until it
+// is indexed by its next update.
+func WithRedisErrorHandler(handler func(sessionID string, err error)) RedisOption {
+	return func(s *RedisStore) {
+		s.onError = handler
+	}
+}
+
 // RedisStore implements SessionStore using Redis with optimistic locking.
+// Each session is a hash with one field per SessionData field next to a list
+// holding its history, so settings can be patched without rewriting the
+// history, and every operation runs as one Lua script in a single round trip
+// (see redis_scripts.go).
 type RedisStore struct {
-	client *redis.Client
-	ttl    time.Duration
+	client        redis.UniversalClient
+	ttl           time.Duration
+	maxLifetime   time.Duration
+	publishEvents bool
+	sealer        sealer
+	onError       func(sessionID string, err error)
+
+	events session.Broadcaster
+	mu     sync.Mutex
+	pubsub *redis.PubSub // Receives events once subscribed
+	closed bool
 }
 
 // NewRedisStore creates a new Redis-based session store.
-func NewRedisStore(client *redis.Client, ttl time.Duration) *RedisStore {
+// The client may be a standalone, Sentinel failover or Cluster client.
+// ttl is the default idle TTL of sessions.
+func NewRedisStore(client redis.UniversalClient, ttl time.Duration, opts ...RedisOption) *RedisStore {
 	if ttl <= 0 {
 		ttl = defaultTTL
 	}
-	return &RedisStore{
-		client: client,
-		ttl:    ttl,
+	s := &RedisStore{
+		client:  client,
+		ttl:     ttl,
+		onError: func(string, error) {},
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Create implements SessionStore.
-// Creates a new session with Version set to 1 and sets TTL.
+// Creates a new session with Version set to 1 and sets TTL, only if no
+// session with the same ID exists.
+// Returns ErrAlreadyExists if the session already exists.
+// Failing to index the session created is reported to the error handler.
 func (s *RedisStore) Create(ctx context.Context, data *session.SessionData) error {
-	key := s.key(data.ID)
+	// Work on a copy so data is left unchanged if the session exists
+	record := *data
 	now := time.Now()
-	data.CreatedAt = now
-	data.UpdatedAt = now
-	data.Version = 1
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	record.Version = 1
+	record.SchemaVersion = session.CurrentSchemaVersion()
+
+	args, err := s.writeArgs(ctx, &record, now, 0, nil)
+	if err != nil {
+		return err
+	}
 
-	val, err := json.Marshal(data)
+	created, err := createScript.Run(ctx, s.client, s.keys(data.ID), args...).Int()
 	if err != nil {
 		return err
 	}
+	if created == 0 {
+		return session.ErrAlreadyExists
+	}
+	// Only the session created is indexed, so a duplicate never touches
+	// the indexes of the live session
+	s.index(ctx, &record)
+	s.publish(ctx, session.EventCreated, data.ID, record.Version)
 
-	return s.client.Set(ctx, key, val, s.ttl).Err()
+	*data = record
+	return nil
 }
 
 // Get implements SessionStore.
 // Returns nil if the session is not found (not an error).
 // Refreshes TTL on every read.
 func (s *RedisStore) Get(ctx context.Context, id string) (*session.SessionData, error) {
-	key := s.key(id)
-	val, err := s.client.Get(ctx, key).Result()
+	var res []any
+	err := s.withMigration(ctx, id, func() error {
+		var err error
+		res, err = getScript.Run(ctx, s.client, s.keys(id), time.Now().UnixMilli()).Slice()
+		return err
+	})
 	if err == redis.Nil {
 		return nil, nil // Not found
 	}
@@ -63,84 +194,822 @@ func (s *RedisStore) Get(ctx context.Context, id string) (*session.SessionData,
 		return nil, err
 	}
 
-	var data session.SessionData
-	if err := json.Unmarshal([]byte(val), &data); err != nil {
+	data, err := s.decodeSession(ctx, id, stringSlice(res[0]), stringSlice(res[1]))
+	if err != nil {
 		return nil, err
 	}
 
-	// Refresh TTL on read
-	if err := s.client.Expire(ctx, key, s.ttl).Err(); err != nil {
-		// Log but don't fail if TTL refresh fails
-		_ = err
-	}
+	expiresAt, _ := res[2].(int64)
+	data.ExpiresAt = time.UnixMilli(expiresAt)
 
-	return &data, nil
+	return data, nil
 }
 
 // Update implements SessionStore.
-// Implements optimistic locking using Redis WATCH/MULTI/EXEC.
+// Implements optimistic locking with a Lua script that compares and bumps
+// Version atomically on the server.
 // Verifies Version matches, increments it, updates UpdatedAt, and persists.
-// Returns ErrVersionConflict if the version does not match.
+// Returns ErrVersionConflict if the version does not match or messages were
+// appended since the data was read.
 // Returns ErrNotFound if the session does not exist.
 // Refreshes TTL on every write.
+// Failing to index the session written is reported to the error handler.
 func (s *RedisStore) Update(ctx context.Context, data *session.SessionData) error {
-	key := s.key(data.ID)
+	return s.write(ctx, data, nil)
+}
 
-	// Use WATCH/MULTI/EXEC for optimistic locking
-	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
-		// Get current value
-		val, err := tx.Get(ctx, key).Result()
-		if err == redis.Nil {
+// Patch implements session.Patcher.
+// Writes only the hash fields of the named fields, and the history list only
+// if FieldConversationHistory is named.
+// Returns ErrInvalidField if a field cannot be patched.
+// Returns ErrVersionConflict if the version does not match.
+// Returns ErrNotFound if the session does not exist.
+// Refreshes TTL on every write.
+func (s *RedisStore) Patch(ctx context.Context, data *session.SessionData, fields ...session.Field) error {
+	if err := session.ValidatePatch(fields); err != nil {
+		return err
+	}
+	return s.write(ctx, data, fields)
+}
+
+// write implements Update (fields == nil) and Patch.
+func (s *RedisStore) write(ctx context.Context, data *session.SessionData, fields []session.Field) error {
+	// Work on a copy so data is left unchanged on conflict
+	record := *data
+	now := time.Now()
+	record.Version++
+	record.UpdatedAt = now
+	// A patch leaves the other fields, and so their schema, as stored
+	if fields == nil {
+		record.SchemaVersion = session.CurrentSchemaVersion()
+	}
+
+	args, err := s.writeArgs(ctx, &record, now, data.Version, fields)
+	if err != nil {
+		return err
+	}
+
+	err = s.withMigration(ctx, data.ID, func() error {
+		result, err := updateScript.Run(ctx, s.client, s.keys(data.ID), args...).Int()
+		if err != nil {
+			return err
+		}
+		switch result {
+		case 0:
 			return session.ErrNotFound
+		case -1:
+			return session.ErrVersionConflict
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The indexed IDs cannot be patched, so only an update can move a
+	// session to other indexes. A rejected write never does.
+	if fields == nil {
+		s.index(ctx, &record)
+	}
+	s.publish(ctx, session.EventUpdated, data.ID, record.Version)
+
+	// The appended messages are now part of the stored history
+	if fields == nil || slices.Contains(fields, session.FieldConversationHistory) {
+		record.AppendedMessages = 0
+	}
+	*data = record
+	return nil
+}
+
+// AppendMessages implements session.Appender.
+// Pushes the messages onto the history list without touching the rest of
+// the session or incrementing Version. Refreshes TTL.
+// Returns ErrNotFound if the session does not exist.
+func (s *RedisStore) AppendMessages(ctx context.Context, id string, msgs ...session.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	args := make([]any, 1, len(msgs)+1) // args[0] is the current time, set on each run
+	for _, msg := range msgs {
+		val, err := s.encodeMessage(ctx, id, msg)
 		if err != nil {
 			return err
 		}
+		args = append(args, val)
+	}
 
-		// Unmarshal to check version
-		var stored session.SessionData
-		if err := json.Unmarshal([]byte(val), &stored); err != nil {
+	return s.withMigration(ctx, id, func() error {
+		args[0] = time.Now().UnixMilli()
+		version, err := appendScript.Run(ctx, s.client, s.keys(id), args...).Int64()
+		if err != nil {
 			return err
 		}
+		if version == 0 {
+			return session.ErrNotFound
+		}
+		s.publish(ctx, session.EventUpdated, id, version)
+		return nil
+	})
+}
 
-		// Check version for optimistic locking
-		if stored.Version != data.Version {
-			return session.ErrVersionConflict
+// Touch implements session.Toucher.
+// Returns ErrNotFound if the session does not exist.
+func (s *RedisStore) Touch(ctx context.Context, id string) error {
+	return s.withMigration(ctx, id, func() error {
+		ok, err := touchScript.Run(ctx, s.client, s.keys(id), time.Now().UnixMilli()).Int()
+		if err != nil {
+			return err
+		}
+		if ok == 0 {
+			return session.ErrNotFound
 		}
+		return nil
+	})
+}
 
-		// Increment version and update timestamp
-		data.Version++
-		data.UpdatedAt = time.Now()
+// List implements session.Lister.
+// Pages through the sorted set index of the filter's user, assistant or
+// tenant, in that order of preference, and reads the sessions in it with one
+// pipelined round trip per batch. Index entries of sessions that no longer
+// exist or were moved to another index are removed.
+// Returns ErrInvalidFilter if the filter selects no tenant, assistant or user.
+// Returns ErrInvalidCursor if the cursor is malformed.
+func (s *RedisStore) List(ctx context.Context, filter session.ListFilter, cursor string) ([]*session.SessionData, string, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := session.DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
 
-		// Marshal updated data
-		newVal, err := json.Marshal(data)
+	kind, indexed := filterIndex(filter)
+	key := s.indexKey(kind, indexed)
+	batch := int64(filter.Limit + 1)
+
+	// Collect one session more than the limit to learn whether there is a
+	// next page
+	var results []*session.SessionData
+	var stale []redis.Z
+	for offset := int64(0); len(results) <= filter.Limit; {
+		entries, err := s.client.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    strconv.FormatInt(after.CreatedAt, 10),
+			Max:    "+inf",
+			Offset: offset,
+			Count:  batch,
+		}).Result()
 		if err != nil {
-			return err
+			return nil, "", err
 		}
+		offset += int64(len(entries))
 
-		// Execute transaction
-		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-			pipe.Set(ctx, key, newVal, s.ttl)
-			return nil
-		})
-		return err
-	}, key)
+		ids := make([]string, len(entries))
+		for i, entry := range entries {
+			ids[i], _ = entry.Member.(string)
+		}
+		sessions, err := s.peek(ctx, ids)
+		if err != nil {
+			return nil, "", err
+		}
 
-	return err
+		for i, data := range sessions {
+			switch {
+			case data == nil, indexedID(data, kind) != indexed:
+				stale = append(stale, entries[i])
+			case filter.Matches(data) && session.PositionOf(data).After(after):
+				results = append(results, data)
+			}
+		}
+		if int64(len(entries)) < batch {
+			break
+		}
+	}
+
+	if err := s.unindex(ctx, key, stale); err != nil {
+		return nil, "", err
+	}
+
+	slices.SortFunc(results, comparePositions)
+	var next string
+	if len(results) > filter.Limit {
+		results = results[:filter.Limit]
+		next = session.EncodeCursor(session.PositionOf(results[len(results)-1]))
+	}
+	return results, next, nil
 }
 
 // Delete implements SessionStore.
+// Also removes the session from the indexes it belongs to.
 func (s *RedisStore) Delete(ctx context.Context, id string) error {
-	key := s.key(id)
-	return s.client.Del(ctx, key).Err()
+	keys := append(s.keys(id), s.legacyMessagesKey(id))
+	var res []any
+	err := s.withMigration(ctx, id, func() error {
+		var err error
+		if res, err = deleteScript.Run(ctx, s.client, keys).Slice(); err != nil {
+			return err
+		}
+		if deleted, _ := res[0].(int64); deleted == 0 {
+			return session.ErrNotFound
+		}
+		return nil
+	})
+	if err == session.ErrNotFound {
+		return nil // Not found
+	}
+	if err != nil {
+		return err
+	}
+
+	data := session.SessionData{ID: id}
+	if fields := stringSlice(res[1]); len(fields) == 4 {
+		data.Version, _ = strconv.ParseInt(fields[0], 10, 64)
+		for i, dst := range []*string{&data.TenantID, &data.AssistantID, &data.UserID} {
+			if val := fields[i+1]; val != "" {
+				if err := json.Unmarshal([]byte(val), dst); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	s.publish(ctx, session.EventDeleted, id, data.Version)
+
+	indexes := indexKeys(&data, s.indexKey)
+	if len(indexes) == 0 {
+		return nil
+	}
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range indexes {
+			pipe.ZRem(ctx, key, id)
+		}
+		return nil
+	})
+	return err
+}
+
+// Scan implements session.Scanner.
+// Iterates the session keys with SCAN, on every master of a Cluster, and
+// reads them as List does, converting sessions stored in an earlier layout.
+func (s *RedisStore) Scan(ctx context.Context, fn func(*session.SessionData) error) error {
+	cluster, ok := s.client.(*redis.ClusterClient)
+	if !ok {
+		return s.scan(ctx, s.client, fn)
+	}
+
+	// Masters are scanned concurrently, but fn is called by one at a time
+	var mu sync.Mutex
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return s.scan(ctx, node, func(data *session.SessionData) error {
+			mu.Lock()
+			defer mu.Unlock()
+			return fn(data)
+		})
+	})
+}
+
+// scan implements Scan for the keys of one node.
+// Sessions still stored under their untagged key are moved to their tagged
+// key first, which SCAN may then return again, so they are skipped there.
+func (s *RedisStore) scan(ctx context.Context, node redis.Cmdable, fn func(*session.SessionData) error) error {
+	match := sessionKeyPrefix + "*"
+	moved := make(map[string]bool)
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, match, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		ids := make([]string, 0, len(keys))
+		for _, key := range keys {
+			id, tagged := strings.CutPrefix(key, sessionKeyPrefix+"{")
+			switch {
+			case tagged:
+				// Skip history and message lists
+				if id, ok := strings.CutSuffix(id, "}"); ok && !moved[id] {
+					ids = append(ids, id)
+				}
+			case !strings.HasPrefix(key, indexKeyPrefix):
+				id = strings.TrimPrefix(key, sessionKeyPrefix)
+				ok, err := s.moveUntagged(ctx, id)
+				if err != nil {
+					return err
+				}
+				if ok {
+					moved[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+		sessions, err := s.peek(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, data := range sessions {
+			if data == nil {
+				continue // Expired or deleted since scanned
+			}
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// Subscribe implements session.Notifier.
+// Handlers receive the events published by every store created with
+// WithRedisEvents on the same Redis deployment, and expired events from
+// Redis keyspace notifications, which must be enabled on the server
+// (notify-keyspace-events "Ex"). Expired events carry no version, and are
+// only received from the node the subscription connects to on a Cluster.
+// Pub/Sub delivers events at most once: events published while the
+// subscription is reconnecting are lost.
+func (s *RedisStore) Subscribe(handler session.EventHandler) func() {
+	s.mu.Lock()
+	if s.pubsub == nil && !s.closed {
+		s.pubsub = s.client.PSubscribe(context.Background(), eventsChannel, expiredEventsPattern)
+		go s.listen(s.pubsub.Channel())
+	}
+	s.mu.Unlock()
+	return s.events.Subscribe(handler)
 }
 
 // Close implements SessionStore.
+// Also stops receiving events.
 func (s *RedisStore) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.pubsub != nil {
+		s.pubsub.Close()
+	}
+	s.mu.Unlock()
 	return s.client.Close()
 }
 
+// publish publishes a lifecycle event if WithRedisEvents is set.
+// Publishing is best effort, like Pub/Sub delivery: the operation has
+// already succeeded, so a failure to publish is not reported.
+func (s *RedisStore) publish(ctx context.Context, typ session.EventType, id string, version int64) {
+	if !s.publishEvents {
+		return
+	}
+	payload, err := json.Marshal(session.Event{Type: typ, ID: id, Version: version, Time: time.Now()})
+	if err != nil {
+		return
+	}
+	s.client.Publish(ctx, eventsChannel, payload)
+}
+
+// listen delivers events received on a subscription until it is closed.
+func (s *RedisStore) listen(messages <-chan *redis.Message) {
+	for msg := range messages {
+		var event session.Event
+		if msg.Channel == eventsChannel {
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue // Not an event
+			}
+		} else {
+			// An expired key: only session hashes are of interest, not
+			// their history lists or other keys
+			id, ok := strings.CutPrefix(msg.Payload, sessionKeyPrefix+"{")
+			if !ok || !strings.HasSuffix(id, "}") {
+				continue
+			}
+			event = session.Event{Type: session.EventExpired, ID: strings.TrimSuffix(id, "}"), Time: time.Now()}
+		}
+		s.events.Emit(event)
+	}
+}
+
 // key constructs the Redis key for a session ID.
+// The ID is wrapped in a hash tag ("session:{id}") so every key belonging
+// to a session hashes to the same Redis Cluster slot, which scripts
+// spanning those keys require.
 func (s *RedisStore) key(id string) string {
-	return sessionKeyPrefix + id
+	return sessionKeyPrefix + "{" + id + "}"
+}
+
+// historyKey constructs the Redis key for a session's conversation history.
+// It shares the session key's hash tag, so both live in the same slot.
+func (s *RedisStore) historyKey(id string) string {
+	return s.key(id) + historyKeySuffix
+}
+
+// legacyMessagesKey constructs the key of the appended message list used by
+// an earlier layout.
+func (s *RedisStore) legacyMessagesKey(id string) string {
+	return s.key(id) + legacyMessagesKeySuffix
+}
+
+// keys returns the keys of a session, in the order the scripts expect.
+func (s *RedisStore) keys(id string) []string {
+	return []string{s.key(id), s.historyKey(id)}
+}
+
+// writeArgs sets data.ExpiresAt and returns the script arguments writing
+// data, as expected by writeLua. fields lists the fields to patch, or nil to
+// replace the whole session.
+func (s *RedisStore) writeArgs(ctx context.Context, data *session.SessionData, now time.Time, expectedVersion int64, fields []session.Field) ([]any, error) {
+	expiry := session.ResolveExpiry(data, s.ttl, s.maxLifetime)
+	data.ExpiresAt = expiry.At(now)
+
+	encoded, err := session.MarshalFields(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline int64
+	if !expiry.Deadline.IsZero() {
+		deadline = expiry.Deadline.UnixMilli()
+	}
+
+	replaceAll := fields == nil
+	writeHistory := replaceAll || slices.Contains(fields, session.FieldConversationHistory)
+	expectedAppended := -1
+	if writeHistory {
+		expectedAppended = data.AppendedMessages
+	}
+
+	// Fields kept elsewhere: the ID in the key, Version in a control field,
+	// the history in its own list, and ExpiresAt computed on every access
+	delete(encoded, session.FieldID)
+	delete(encoded, session.FieldVersion)
+	delete(encoded, session.FieldConversationHistory)
+	delete(encoded, session.FieldExpiresAt)
+
+	if !replaceAll {
+		// UpdatedAt always changes; fields omitted when empty are written
+		// as null, which decodes to the zero value
+		patch := make(map[session.Field]json.RawMessage, len(fields)+1)
+		for _, f := range slices.Concat(fields, []session.Field{session.FieldUpdatedAt}) {
+			if f == session.FieldConversationHistory {
+				continue
+			}
+			v, ok := encoded[f]
+			if !ok {
+				v = json.RawMessage("null")
+			}
+			patch[f] = v
+		}
+		encoded = patch
+	}
+
+	var pairs []any
+	for f, v := range encoded {
+		val := []byte(v)
+		if sealable(f) {
+			var err error
+			if val, err = s.sealer.seal(ctx, data.ID, f, val); err != nil {
+				return nil, err
+			}
+		}
+		pairs = append(pairs, string(f), val)
+	}
+
+	args := []any{data.Version, expiry.IdleTTL.Milliseconds(), deadline, data.ExpiresAt.UnixMilli(),
+		expectedVersion, expectedAppended, boolArg(replaceAll), len(pairs) / 2}
+	args = append(args, pairs...)
+	args = append(args, boolArg(writeHistory))
+	if writeHistory {
+		for _, msg := range data.ConversationHistory {
+			val, err := s.encodeMessage(ctx, data.ID, msg)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, val)
+		}
+	}
+	return args, nil
+}
+
+// withMigration runs fn, and if the session is still stored in an earlier
+// layout, migrates it and runs fn again. fn reports a missing session with
+// redis.Nil or ErrNotFound, in which case the session is looked up under
+// its untagged key.
+func (s *RedisStore) withMigration(ctx context.Context, id string, fn func() error) error {
+	err := fn()
+	switch {
+	case isLegacy(err):
+	case err == redis.Nil || err == session.ErrNotFound:
+		moved, moveErr := s.moveUntagged(ctx, id)
+		if moveErr != nil {
+			return moveErr
+		}
+		if !moved {
+			return err
+		}
+	default:
+		return err
+	}
+	if err := s.migrate(ctx, id); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// moveUntagged moves a session stored by the first version of the driver,
+// under the untagged key "session:<id>", to its hash-tagged key, where
+// migrate converts it. The session keeps its expiry. On a Cluster the two
+// keys live in different slots, so it is copied and then deleted rather
+// than renamed.
+// Reports whether a session was found under the untagged key. If the tagged
+// key exists as well, it takes precedence and the untagged key is deleted.
+func (s *RedisStore) moveUntagged(ctx context.Context, id string) (bool, error) {
+	untagged, key := sessionKeyPrefix+id, s.key(id)
+	if _, ok := s.client.(*redis.ClusterClient); !ok {
+		moved, err := moveScript.Run(ctx, s.client, []string{untagged, key}).Int()
+		return moved == 1, err
+	}
+
+	if kind, err := s.client.Type(ctx, untagged).Result(); err != nil || kind != "string" {
+		return false, err
+	}
+	val, err := s.client.Get(ctx, untagged).Result()
+	if err == redis.Nil {
+		return false, nil // Expired or moved concurrently
+	}
+	if err != nil {
+		return false, err
+	}
+	ttl, err := s.client.PTTL(ctx, untagged).Result()
+	if err != nil {
+		return false, err
+	}
+	if ttl == -2*time.Nanosecond {
+		return false, nil // Expired since read
+	}
+	if ttl < 0 {
+		ttl = 0 // No expiry
+	}
+	if err := s.client.SetNX(ctx, key, val, ttl).Err(); err != nil {
+		return false, err
+	}
+	return true, s.client.Del(ctx, untagged).Err()
+}
+
+// migrate converts a session from an earlier layout stored under its tagged
+// key: a plain JSON string, or a hash with the JSON in a data field, a
+// version field and a separate list of appended messages. The appended messages are folded into the history.
+// It is a no-op if the session was deleted or converted concurrently.
+func (s *RedisStore) migrate(ctx context.Context, id string) error {
+	key := s.key(id)
+
+	var val string
+	var version int64
+	var err error
+	switch kind, _ := s.client.Type(ctx, key).Result(); kind {
+	case "string":
+		val, err = s.client.Get(ctx, key).Result()
+	case "hash":
+		var fields []any
+		fields, err = s.client.HMGet(ctx, key, "data", "version").Result()
+		if err == nil {
+			val, _ = fields[0].(string)
+			if v, _ := fields[1].(string); v != "" {
+				version, err = strconv.ParseInt(v, 10, 64)
+			}
+		}
+	default:
+		return nil // Deleted
+	}
+	if err == redis.Nil || err == nil && val == "" {
+		return nil // Deleted or converted
+	}
+	if err != nil {
+		return err
+	}
+
+	// The whole session is rewritten, so it is upgraded to the current schema
+	var fields map[session.Field]json.RawMessage
+	if err := json.Unmarshal([]byte(val), &fields); err != nil {
+		return err
+	}
+	if err := session.UpgradeFields(fields); err != nil {
+		return err
+	}
+	var data session.SessionData
+	if err := session.UnmarshalFields(fields, &data); err != nil {
+		return err
+	}
+	data.SchemaVersion = session.CurrentSchemaVersion()
+	if version > 0 {
+		data.Version = version // The version field is authoritative
+	}
+
+	pending, err := s.client.LRange(ctx, s.legacyMessagesKey(id), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	appended, err := s.decodeMessages(ctx, id, pending)
+	if err != nil {
+		return err
+	}
+	data.ConversationHistory = append(data.ConversationHistory, appended...)
+
+	args, err := s.writeArgs(ctx, &data, time.Now(), data.Version, nil)
+	if err != nil {
+		return err
+	}
+	args = append([]any{val, len(appended)}, args...)
+	keys := append(s.keys(id), s.legacyMessagesKey(id))
+	return migrateScript.Run(ctx, s.client, keys, args...).Err()
+}
+
+// indexKey constructs the Redis key of a tenant, assistant or user index.
+// The indexed ID is wrapped in a hash tag, like session IDs.
+func (s *RedisStore) indexKey(kind, id string) string {
+	return indexKeyPrefix + kind + ":{" + id + "}"
+}
+
+// index adds a session to the indexes of its tenant, assistant and user.
+// It is called once the session is written, as the indexes live in other
+// Cluster slots than the session and cannot be updated by its scripts.
+// Errors are reported to the error handler.
+func (s *RedisStore) index(ctx context.Context, data *session.SessionData) {
+	indexes := indexKeys(data, s.indexKey)
+	if len(indexes) == 0 {
+		return
+	}
+	score := float64(data.CreatedAt.UnixMilli())
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range indexes {
+			pipe.ZAdd(ctx, key, redis.Z{Score: score, Member: data.ID})
+		}
+		return nil
+	})
+	if err != nil {
+		s.onError(data.ID, err)
+	}
+}
+
+// unindex removes stale entries from an index.
+func (s *RedisStore) unindex(ctx context.Context, key string, entries []redis.Z) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			unindexScript.Eval(ctx, pipe, []string{key}, entry.Member, int64(entry.Score))
+		}
+		return nil
+	})
+	return err
+}
+
+// peek reads sessions for List, without their history and without
+// refreshing their expiry. Missing sessions are returned as nil.
+func (s *RedisStore) peek(ctx context.Context, ids []string) ([]*session.SessionData, error) {
+	cmds := make([]*redis.Cmd, len(ids))
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = peekScript.Eval(ctx, pipe, []string{s.key(id)})
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil && !isLegacy(err) {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := make([]*session.SessionData, len(ids))
+	for i, id := range ids {
+		res, err := cmds[i].Slice()
+		if isLegacy(err) {
+			if err := s.migrate(ctx, id); err != nil {
+				return nil, err
+			}
+			res, err = peekScript.Run(ctx, s.client, []string{s.key(id)}).Slice()
+		}
+		if err == redis.Nil {
+			continue // Not found
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := s.decodeSession(ctx, id, stringSlice(res[0]), nil)
+		if err != nil {
+			return nil, err
+		}
+		data.AppendedMessages = 0 // The history is not read
+		if ttl, _ := res[1].(int64); ttl >= 0 {
+			data.ExpiresAt = now.Add(time.Duration(ttl) * time.Millisecond)
+		}
+		sessions[i] = data
+	}
+	return sessions, nil
+}
+
+// decodeSession decodes the fields of a session hash, as returned by HGETALL,
+// and the entries of its history list, upgrading them to the current schema.
+// history is nil when the history is not read.
+func (s *RedisStore) decodeSession(ctx context.Context, id string, pairs, history []string) (*session.SessionData, error) {
+	fields := make(map[session.Field]json.RawMessage, len(pairs)/2)
+	control := make(map[string]string, 4)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		switch name, val := pairs[i], pairs[i+1]; name {
+		case "version", "idle", "deadline", "appended":
+			control[name] = val
+		default:
+			v, err := s.sealer.open(ctx, id, session.Field(name), []byte(val))
+			if err != nil {
+				return nil, err
+			}
+			fields[session.Field(name)] = v
+		}
+	}
+	if len(history) > 0 {
+		msgs := make([]json.RawMessage, len(history))
+		for i, val := range history {
+			var err error
+			if msgs[i], err = s.sealer.open(ctx, id, session.FieldConversationHistory, []byte(val)); err != nil {
+				return nil, err
+			}
+		}
+		v, err := json.Marshal(msgs)
+		if err != nil {
+			return nil, err
+		}
+		fields[session.FieldConversationHistory] = v
+	}
+
+	if err := session.UpgradeFields(fields); err != nil {
+		return nil, err
+	}
+	data := session.SessionData{ID: id}
+	if err := session.UnmarshalFields(fields, &data); err != nil {
+		return nil, err
+	}
+	var err error
+	if data.Version, err = strconv.ParseInt(control["version"], 10, 64); err != nil {
+		return nil, err
+	}
+	if appended := control["appended"]; appended != "" {
+		if data.AppendedMessages, err = strconv.Atoi(appended); err != nil {
+			return nil, err
+		}
+	}
+	return &data, nil
 }
+
+// boolArg encodes a flag for the scripts.
+func boolArg(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// stringSlice converts a script array reply of strings.
+func stringSlice(v any) []string {
+	items, _ := v.([]any)
+	vals := make([]string, len(items))
+	for i, item := range items {
+		vals[i], _ = item.(string)
+	}
+	return vals
+}
+
+// encodeMessage encodes a message as a history list entry.
+func (s *RedisStore) encodeMessage(ctx context.Context, id string, msg session.Message) ([]byte, error) {
+	val, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.sealer.seal(ctx, id, session.FieldConversationHistory, val)
+}
+
+// decodeMessages decodes history list entries.
+// Returns nil for an empty list.
+func (s *RedisStore) decodeMessages(ctx context.Context, id string, vals []string) ([]session.Message, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	msgs := make([]session.Message, len(vals))
+	for i, val := range vals {
+		b, err := s.sealer.open(ctx, id, session.FieldConversationHistory, []byte(val))
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &msgs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return msgs, nil
+}
+
+// Compile-time checks that RedisStore implements Store and the optional interfaces.
+var (
+	_ session.Store    = (*RedisStore)(nil)
+	_ session.Patcher  = (*RedisStore)(nil)
+	_ session.Appender = (*RedisStore)(nil)
+	_ session.Toucher  = (*RedisStore)(nil)
+	_ session.Lister   = (*RedisStore)(nil)
+	_ session.Notifier = (*RedisStore)(nil)
+	_ session.Scanner  = (*RedisStore)(nil)
+)
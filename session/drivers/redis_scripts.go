@@ -0,0 +1,237 @@
+package drivers
+
+import (
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Every operation on an existing session runs as a single Lua script, so it
+// costs one round trip and needs no WATCH. The scripts never decode JSON:
+// each session field is stored as its own JSON-encoded hash field, and the
+// version and lifetime settings live in control fields next to them.
+//
+// Session hash fields:
+//   - version:  Version, compared and bumped by updateScript
+//   - idle:     idle TTL in milliseconds
+//   - deadline: absolute expiry in Unix milliseconds, 0 if none
+//   - appended: number of messages appended since the history was last written
+//   - one field per SessionData field, named by session.Field, holding its
+//     JSON encoding (ID, Version, ExpiresAt and the history excepted)
+//
+// The conversation history is a list of JSON-encoded messages next to the
+// hash, so appends and setting changes never rewrite it.
+//
+// Sessions are indexed by tenant, assistant and user in sorted sets holding
+// session IDs scored by creation time in Unix milliseconds. An index lives in
+// a different Cluster slot than the sessions in it, so it cannot be updated
+// by the session scripts: the driver adds entries after creating or
+// updating a session and removes them after deleting it, and List checks
+// every entry against the session and drops stale ones.
+//
+// Unless noted otherwise, scripts take KEYS[1] = session key and
+// KEYS[2] = history key.
+
+// legacyError is returned by the scripts for sessions stored in the layout
+// of earlier versions of the driver: a plain JSON string, or a hash with the
+// whole session JSON in a data field. The driver then migrates the session
+// and retries.
+const legacyError = "LEGACY session stored in an earlier layout"
+
+// checkLua returns from the script with 0 if the session does not exist, or
+// with legacyError if it uses an earlier layout.
+const checkLua = `
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+	return 0
+end
+if kind ~= 'hash' or redis.call('HEXISTS', KEYS[1], 'data') == 1 then
+	return redis.error_reply('` + legacyError + `')
+end
+`
+
+// refreshLua sets the expiry of a session's keys from its idle TTL and
+// deadline and returns the new expiry in Unix milliseconds.
+// ARGV[1] = current time in Unix milliseconds
+const refreshLua = `
+local function refresh()
+	local settings = redis.call('HMGET', KEYS[1], 'idle', 'deadline')
+	local expires = tonumber(ARGV[1]) + tonumber(settings[1])
+	local deadline = tonumber(settings[2])
+	if deadline > 0 and deadline < expires then
+		expires = deadline
+	end
+	redis.call('PEXPIREAT', KEYS[1], expires)
+	redis.call('PEXPIREAT', KEYS[2], expires)
+	return expires
+end
+`
+
+// writeLua stores a session, or the fields of it being patched, and sets the
+// expiry of its keys. Its arguments start after the first b script arguments:
+// ARGV[b+1] = new version, ARGV[b+2] = idle TTL in milliseconds,
+// ARGV[b+3] = deadline in Unix milliseconds (0 if none),
+// ARGV[b+4] = expiry in Unix milliseconds,
+// ARGV[b+5] = expected version, ARGV[b+6] = expected number of appended
+// messages, or -1 if the history is not written,
+// ARGV[b+7] = 1 to replace all fields, 0 to patch,
+// ARGV[b+8] = number of fields n, ARGV[b+9..b+8+2n] = field name/value pairs,
+// ARGV[b+9+2n] = 1 to replace the history, then the encoded messages.
+const writeLua = `
+local function write(b)
+	local n = tonumber(ARGV[b + 8])
+	if ARGV[b + 7] == '1' then
+		redis.call('DEL', KEYS[1])
+	end
+	redis.call('HSET', KEYS[1], 'version', ARGV[b + 1], 'idle', ARGV[b + 2], 'deadline', ARGV[b + 3])
+	if n > 0 then
+		redis.call('HSET', KEYS[1], unpack(ARGV, b + 9, b + 8 + 2 * n))
+	end
+	local h = b + 9 + 2 * n
+	if ARGV[h] == '1' then
+		redis.call('DEL', KEYS[2])
+		for i = h + 1, #ARGV, 1000 do
+			redis.call('RPUSH', KEYS[2], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+		end
+		redis.call('HSET', KEYS[1], 'appended', 0)
+	end
+	redis.call('PEXPIREAT', KEYS[1], ARGV[b + 4])
+	redis.call('PEXPIREAT', KEYS[2], ARGV[b + 4])
+end
+`
+
+// createScript creates a session if no session with its ID exists.
+// Arguments as for writeLua. Returns 0 if the session already exists.
+var createScript = redis.NewScript(writeLua + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return 0
+end
+write(0)
+return 1
+`)
+
+// getScript reads a session and refreshes its expiry. Returns nil if the
+// session does not exist, otherwise
+// {{field, value...}, {message JSON...}, expiry in Unix milliseconds}.
+var getScript = redis.NewScript(refreshLua + `
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+	return false
+end
+if kind ~= 'hash' or redis.call('HEXISTS', KEYS[1], 'data') == 1 then
+	return redis.error_reply('` + legacyError + `')
+end
+return {redis.call('HGETALL', KEYS[1]), redis.call('LRANGE', KEYS[2], 0, -1), refresh()}
+`)
+
+// updateScript writes a session, or patches fields of it, if its version
+// matches and, when the history is written, no messages were appended since
+// it was read. Arguments as for writeLua.
+// Returns 1 on success, 0 if the session does not exist, -1 on conflict.
+var updateScript = redis.NewScript(writeLua + checkLua + `
+if redis.call('HGET', KEYS[1], 'version') ~= ARGV[5] then
+	return -1
+end
+if ARGV[6] ~= '-1' and tonumber(redis.call('HGET', KEYS[1], 'appended') or 0) ~= tonumber(ARGV[6]) then
+	return -1
+end
+write(0)
+return 1
+`)
+
+// peekScript reads a session without its history and without refreshing its
+// expiry. Takes only KEYS[1]. Returns nil if the session does not exist,
+// otherwise {{field, value...}, remaining TTL in milliseconds}.
+var peekScript = redis.NewScript(`
+local kind = redis.call('TYPE', KEYS[1]).ok
+if kind == 'none' then
+	return false
+end
+if kind ~= 'hash' or redis.call('HEXISTS', KEYS[1], 'data') == 1 then
+	return redis.error_reply('` + legacyError + `')
+end
+return {redis.call('HGETALL', KEYS[1]), redis.call('PTTL', KEYS[1])}
+`)
+
+// appendScript pushes messages onto the session's history and refreshes its
+// expiry. ARGV[2..] = encoded messages.
+// Returns the session's version, or 0 if the session does not exist.
+var appendScript = redis.NewScript(refreshLua + checkLua + `
+for i = 2, #ARGV, 1000 do
+	redis.call('RPUSH', KEYS[2], unpack(ARGV, i, math.min(i + 999, #ARGV)))
+end
+redis.call('HINCRBY', KEYS[1], 'appended', #ARGV - 1)
+refresh()
+return tonumber(redis.call('HGET', KEYS[1], 'version'))
+`)
+
+// touchScript refreshes a session's expiry.
+// Returns 0 if the session does not exist.
+var touchScript = redis.NewScript(refreshLua + checkLua + `
+refresh()
+return 1
+`)
+
+// deleteScript deletes a session. KEYS[3] = message list of the earlier
+// layout. Returns {number of keys deleted, fields}, where fields holds the
+// version and the JSON-encoded tenant_id, assistant_id and user_id the
+// session was indexed by, or is nil if it was not stored as a hash.
+var deleteScript = redis.NewScript(`
+local fields = false
+if redis.call('TYPE', KEYS[1]).ok == 'hash' then
+	fields = redis.call('HMGET', KEYS[1], 'version', 'tenant_id', 'assistant_id', 'user_id')
+end
+return {redis.call('DEL', KEYS[1], KEYS[2], KEYS[3]), fields}
+`)
+
+// unindexScript removes a stale index entry, unless it was re-added since it
+// was read. KEYS[1] = index key, ARGV[1] = session ID, ARGV[2] = score read.
+var unindexScript = redis.NewScript(`
+if tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1])) == tonumber(ARGV[2]) then
+	redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// migrateScript converts a session from an earlier layout, if it still holds
+// the JSON the driver read. KEYS[3] = message list of the earlier layout.
+// ARGV[1] = the JSON read, ARGV[2] = number of appended messages,
+// then arguments as for writeLua.
+// Returns 1 if the session was converted.
+var migrateScript = redis.NewScript(writeLua + `
+local kind = redis.call('TYPE', KEYS[1]).ok
+local val = false
+if kind == 'string' then
+	val = redis.call('GET', KEYS[1])
+elseif kind == 'hash' then
+	val = redis.call('HGET', KEYS[1], 'data')
+end
+if val ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1], KEYS[3])
+write(2)
+redis.call('HSET', KEYS[1], 'appended', ARGV[2])
+return 1
+`)
+
+// moveScript moves a session stored under its untagged key by the first
+// version of the driver to its tagged key, unless the tagged key exists.
+// KEYS[1] = untagged key, KEYS[2] = tagged key. Not usable on a Cluster,
+// where the two keys live in different slots.
+// Returns 1 if the untagged key held a session.
+var moveScript = redis.NewScript(`
+if redis.call('TYPE', KEYS[1]).ok ~= 'string' then
+	return 0
+end
+if redis.call('RENAMENX', KEYS[1], KEYS[2]) == 0 then
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// isLegacy reports whether a script failed because the session uses an
+// earlier layout.
+func isLegacy(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), legacyError)
+}
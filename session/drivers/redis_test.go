@@ -0,0 +1,363 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/sessiontest"
+	"github.com/redis/go-redis/v9"
+)
+
+// untaggedSession is a session as stored by the first version of the driver,
+// under the untagged key "session:<id>".
+const untaggedSession = `{"id":"%s","created_at":"2024-05-01T08:00:00Z","updated_at":"2024-05-01T08:05:00Z",` +
+	`"version":3,"conversation_history":[{"role":"user","content":"hi","token_count":1,"timestamp":"2024-05-01T08:05:00Z"}],` +
+	`"system_prompt":"Be brief","keyterms":null,"language":"en","tts_enabled":true,"allowed_origins":null,` +
+	`"rate_limits":null,"config":null}`
+
+func TestRedisStore(t *testing.T) {
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		m := miniredis.RunT(t)
+		return NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), 0, WithRedisEvents())
+	})
+}
+
+func TestRedisUntaggedKeys(t *testing.T) {
+	clients := map[string]func(addr string) redis.UniversalClient{
+		"standalone": func(addr string) redis.UniversalClient {
+			return redis.NewClient(&redis.Options{Addr: addr})
+		},
+		"cluster": func(addr string) redis.UniversalClient {
+			return redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{addr}})
+		},
+	}
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			m := miniredis.RunT(t)
+			store := NewRedisStore(newClient(m.Addr()), time.Hour)
+			t.Cleanup(func() { store.Close() })
+			ctx := context.Background()
+
+			setUntagged := func(t *testing.T, id string) {
+				t.Helper()
+				m.Set(sessionKeyPrefix+id, untaggedJSON(id))
+				m.SetTTL(sessionKeyPrefix+id, 10*time.Minute)
+			}
+			checkMoved := func(t *testing.T, id string) {
+				t.Helper()
+				if m.Exists(sessionKeyPrefix + id) {
+					t.Errorf("untagged key of %s still exists", id)
+				}
+			}
+
+			t.Run("Get", func(t *testing.T) {
+				setUntagged(t, "get")
+				data, err := store.Get(ctx, "get")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data == nil {
+					t.Fatal("Get() = nil, want the untagged session")
+				}
+				if data.Version != 3 || data.SystemPrompt != "Be brief" || data.Language != "en" ||
+					len(data.ConversationHistory) != 1 || data.ConversationHistory[0].Content != "hi" {
+					t.Errorf("Get() = %+v", data)
+				}
+				checkMoved(t, "get")
+				if ttl := m.TTL(store.key("get")); ttl <= 0 || ttl > time.Hour {
+					t.Errorf("TTL = %v, want the store TTL", ttl)
+				}
+			})
+
+			t.Run("Update", func(t *testing.T) {
+				setUntagged(t, "update")
+				data := &session.SessionData{ID: "update", Version: 3, Language: "fr"}
+				if err := store.Update(ctx, data); err != nil {
+					t.Fatal(err)
+				}
+				checkMoved(t, "update")
+				got, err := store.Get(ctx, "update")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got == nil || got.Version != 4 || got.Language != "fr" {
+					t.Errorf("Get() = %+v, want version 4 in fr", got)
+				}
+			})
+
+			t.Run("AppendMessages", func(t *testing.T) {
+				setUntagged(t, "append")
+				if err := store.AppendMessages(ctx, "append", session.Message{Role: "assistant", Content: "hello"}); err != nil {
+					t.Fatal(err)
+				}
+				checkMoved(t, "append")
+				got, err := store.Get(ctx, "append")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got == nil || len(got.ConversationHistory) != 2 || got.ConversationHistory[1].Content != "hello" {
+					t.Errorf("Get() = %+v, want two messages", got)
+				}
+			})
+
+			t.Run("Touch", func(t *testing.T) {
+				setUntagged(t, "touch")
+				if err := store.Touch(ctx, "touch"); err != nil {
+					t.Fatal(err)
+				}
+				checkMoved(t, "touch")
+			})
+
+			t.Run("Delete", func(t *testing.T) {
+				setUntagged(t, "delete")
+				if err := store.Delete(ctx, "delete"); err != nil {
+					t.Fatal(err)
+				}
+				checkMoved(t, "delete")
+				if got, err := store.Get(ctx, "delete"); err != nil || got != nil {
+					t.Errorf("Get() = %+v, %v after Delete, want nil", got, err)
+				}
+			})
+
+			t.Run("TaggedTakesPrecedence", func(t *testing.T) {
+				if err := store.Create(ctx, &session.SessionData{ID: "both", Language: "de"}); err != nil {
+					t.Fatal(err)
+				}
+				setUntagged(t, "both")
+				got, err := store.Get(ctx, "both")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got == nil || got.Language != "de" {
+					t.Errorf("Get() = %+v, want the tagged session", got)
+				}
+			})
+
+			t.Run("Missing", func(t *testing.T) {
+				if got, err := store.Get(ctx, "missing"); err != nil || got != nil {
+					t.Errorf("Get() = %+v, %v, want nil", got, err)
+				}
+				if err := store.Touch(ctx, "missing"); err != session.ErrNotFound {
+					t.Errorf("Touch() = %v, want ErrNotFound", err)
+				}
+			})
+
+			t.Run("Scan", func(t *testing.T) {
+				m.FlushAll()
+				setUntagged(t, "scan1")
+				setUntagged(t, "scan2")
+				if err := store.Create(ctx, &session.SessionData{ID: "scan3", TenantID: "t1"}); err != nil {
+					t.Fatal(err)
+				}
+				seen := make(map[string]int)
+				err := store.Scan(ctx, func(data *session.SessionData) error {
+					seen[data.ID]++
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, id := range []string{"scan1", "scan2", "scan3"} {
+					if seen[id] != 1 {
+						t.Errorf("Scan visited %s %d times, want once", id, seen[id])
+					}
+				}
+				if len(seen) != 3 {
+					t.Errorf("Scan visited %v, want 3 sessions", seen)
+				}
+				checkMoved(t, "scan1")
+				checkMoved(t, "scan2")
+			})
+		})
+	}
+}
+
+// untaggedJSON returns the untagged session with ID id.
+func untaggedJSON(id string) string {
+	return fmt.Sprintf(untaggedSession, id)
+}
+
+func TestRedisIndexesOnlyWrittenSessions(t *testing.T) {
+	m := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), time.Hour)
+	t.Cleanup(func() { store.Close() })
+	ctx := context.Background()
+
+	data := &session.SessionData{ID: "a", TenantID: "t1"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	tenantIndex := store.indexKey("tenant", "t1")
+	score, err := m.ZScore(tenantIndex, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A duplicate Create touches neither the live session's index entry
+	// nor the indexes of its own owner
+	time.Sleep(2 * time.Millisecond) // So the duplicates have another creation time
+	for _, tenant := range []string{"t1", "t2"} {
+		if err := store.Create(ctx, &session.SessionData{ID: "a", TenantID: tenant}); err != session.ErrAlreadyExists {
+			t.Fatalf("Create() of duplicate error = %v, want ErrAlreadyExists", err)
+		}
+	}
+	if got, err := m.ZScore(tenantIndex, "a"); err != nil || got != score {
+		t.Errorf("index score after duplicate Create() = %v, %v, want %v", got, err, score)
+	}
+	if m.Exists(store.indexKey("tenant", "t2")) {
+		t.Error("duplicate Create() indexed the session under its tenant")
+	}
+
+	// Neither does an Update rejected for its version
+	stale := *data
+	stale.Version = 0
+	stale.TenantID = "t3"
+	if err := store.Update(ctx, &stale); err != session.ErrVersionConflict {
+		t.Fatalf("Update() with stale version error = %v, want ErrVersionConflict", err)
+	}
+	if m.Exists(store.indexKey("tenant", "t3")) {
+		t.Error("rejected Update() indexed the session under its tenant")
+	}
+
+	// A successful Update moves the session
+	data.TenantID = "t3"
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := m.ZScore(store.indexKey("tenant", "t3"), "a"); err != nil || got != score {
+		t.Errorf("index score after Update() = %v, %v, want %v", got, err, score)
+	}
+}
+
+func TestRedisIndexFailure(t *testing.T) {
+	m := miniredis.RunT(t)
+	var failed []string
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), time.Hour, WithRedisEvents(),
+		WithRedisErrorHandler(func(id string, err error) {
+			if err == nil {
+				t.Errorf("error handler called for %s without an error", id)
+			}
+			failed = append(failed, id)
+		}))
+	t.Cleanup(func() { store.Close() })
+	ctx := context.Background()
+
+	events := make(chan session.Event, 10)
+	store.Subscribe(func(event session.Event) { events <- event })
+	expectEvent := func(t *testing.T, eventType session.EventType, version int64) {
+		t.Helper()
+		select {
+		case event := <-events:
+			if event.Type != eventType || event.ID != "a" || event.Version != version {
+				t.Errorf("event = %+v, want %s of a at version %d", event, eventType, version)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", eventType)
+		}
+	}
+
+	// The tenant index is not a sorted set, so adding to it fails
+	m.Set(store.indexKey("tenant", "t1"), "not an index")
+
+	data := &session.SessionData{ID: "a", TenantID: "t1"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatalf("Create() error = %v, want the session created despite the index", err)
+	}
+	if data.Version != 1 || data.CreatedAt.IsZero() {
+		t.Errorf("Create() left data at version %d, created at %v", data.Version, data.CreatedAt)
+	}
+	expectEvent(t, session.EventCreated, 1)
+	if stored, err := store.Get(ctx, "a"); err != nil || stored == nil {
+		t.Fatalf("Get() = %v, %v, want the session created", stored, err)
+	}
+
+	data.Language = "fr"
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatalf("Update() error = %v, want the session updated despite the index", err)
+	}
+	if data.Version != 2 {
+		t.Errorf("Update() left data at version %d, want 2", data.Version)
+	}
+	expectEvent(t, session.EventUpdated, 2)
+
+	if len(failed) != 2 || failed[0] != "a" || failed[1] != "a" {
+		t.Errorf("index errors reported for %v, want a twice", failed)
+	}
+
+	// The session is indexed by the next update after the index is fixed
+	m.Del(store.indexKey("tenant", "t1"))
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ZScore(store.indexKey("tenant", "t1"), "a"); err != nil {
+		t.Errorf("session not indexed after Update(): %v", err)
+	}
+}
+
+// newBenchmarkStore returns a store on the Redis server in REDIS_ADDR, or
+// skips the benchmark, and a session with a 50-message history deleted when
+// the benchmark ends.
+func newBenchmarkStore(b *testing.B) (*RedisStore, *session.SessionData) {
+	b.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		b.Skip("REDIS_ADDR is not set")
+	}
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: addr}), time.Hour)
+	b.Cleanup(func() { store.Close() })
+
+	ctx := context.Background()
+	data := &session.SessionData{
+		ID:           fmt.Sprintf("benchmark:%s:%d", b.Name(), time.Now().UnixNano()),
+		TenantID:     "benchmark",
+		SystemPrompt: "You are a helpful assistant.",
+		Language:     "en",
+		Config:       map[string]any{"voice": "alloy"},
+	}
+	for i := range 50 {
+		data.ConversationHistory = session.AddMessageToHistory(data.ConversationHistory, "user", fmt.Sprintf("message %d", i))
+	}
+	if err := store.Create(ctx, data); err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { store.Delete(context.Background(), data.ID) })
+	return store, data
+}
+
+func BenchmarkRedisGet(b *testing.B) {
+	store, data := newBenchmarkStore(b)
+	ctx := context.Background()
+	for b.Loop() {
+		if _, err := store.Get(ctx, data.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRedisUpdate(b *testing.B) {
+	store, data := newBenchmarkStore(b)
+	ctx := context.Background()
+	for b.Loop() {
+		// Update sets the new version on data, so the next one succeeds
+		data.TTSEnabled = !data.TTSEnabled
+		if err := store.Update(ctx, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRedisAppendMessages(b *testing.B) {
+	store, data := newBenchmarkStore(b)
+	ctx := context.Background()
+	msg := session.NewMessage("assistant", "reply")
+	for b.Loop() {
+		if err := store.AppendMessages(ctx, data.ID, msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
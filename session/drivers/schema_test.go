@@ -0,0 +1,179 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/creastat/storage/session"
+	"github.com/redis/go-redis/v9"
+	bolt "go.etcd.io/bbolt"
+)
+
+// The driver tests run at schema version 1, which renamed the former locale
+// field to language.
+func init() {
+	session.RegisterUpgrade(1, func(fields map[session.Field]json.RawMessage) error {
+		if locale, ok := fields["locale"]; ok {
+			if _, ok := fields[session.FieldLanguage]; !ok {
+				fields[session.FieldLanguage] = locale
+			}
+			delete(fields, "locale")
+		}
+		return nil
+	})
+}
+
+// downgrade rewrites stored fields as schema version 0 stored them.
+func downgrade(fields map[string]json.RawMessage) {
+	fields["locale"] = fields[string(session.FieldLanguage)]
+	delete(fields, string(session.FieldLanguage))
+	delete(fields, string(session.FieldSchemaVersion))
+}
+
+// checkUpgrade checks that the session id, stored at schema version 0 with
+// language fr, is upgraded when read and rewritten by MigrateAll.
+func checkUpgrade(t *testing.T, store session.Store, id string) {
+	t.Helper()
+	ctx := context.Background()
+
+	data, err := store.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil || data.Language != "fr" || data.SchemaVersion != 0 {
+		t.Fatalf("Get() = %+v, want language fr at schema version 0", data)
+	}
+	if data.TenantID != "t1" || len(data.ConversationHistory) != 1 {
+		t.Errorf("Get() = %+v, want the other fields as stored", data)
+	}
+
+	migrated, err := session.MigrateAll(ctx, store)
+	if err != nil || migrated != 1 {
+		t.Fatalf("MigrateAll() = %d, %v, want 1", migrated, err)
+	}
+	data, err = store.Get(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Language != "fr" || data.SchemaVersion != 1 || data.Version != 2 {
+		t.Errorf("Get() after MigrateAll() = %+v, want language fr at version 2, schema version 1", data)
+	}
+}
+
+// newUpgradeSession returns the session stored at schema version 0 by the
+// tests.
+func newUpgradeSession(id string) *session.SessionData {
+	return &session.SessionData{ID: id, TenantID: "t1", Language: "fr",
+		ConversationHistory: session.AddMessageToHistory(nil, "user", "bonjour")}
+}
+
+func TestRedisUpgradesOnRead(t *testing.T) {
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), time.Hour)
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.Create(ctx, newUpgradeSession("s1")); err != nil {
+		t.Fatal(err)
+	}
+	key := store.key("s1")
+	m.HDel(key, string(session.FieldLanguage))
+	m.HDel(key, string(session.FieldSchemaVersion))
+	m.HSet(key, "locale", `"fr"`)
+	checkUpgrade(t, store, "s1")
+	if m.HGet(key, "locale") != "" {
+		t.Error("former field still stored after MigrateAll()")
+	}
+}
+
+func TestRedisUpgradesUntaggedOnRead(t *testing.T) {
+	m := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: m.Addr()}), time.Hour)
+	t.Cleanup(func() { store.Close() })
+
+	// Sessions of the first version of the driver are converted when read
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(untaggedJSON("s1")), &fields); err != nil {
+		t.Fatal(err)
+	}
+	fields["language"] = json.RawMessage(`"fr"`)
+	fields["tenant_id"] = json.RawMessage(`"t1"`)
+	downgrade(fields)
+	untagged, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Set(sessionKeyPrefix+"s1", string(untagged))
+
+	data, err := store.Get(context.Background(), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data == nil || data.Language != "fr" || data.TenantID != "t1" {
+		t.Errorf("Get() = %+v, want language fr", data)
+	}
+	if !strings.Contains(m.HGet(store.key("s1"), string(session.FieldLanguage)), "fr") {
+		t.Error("converted session not stored with its language")
+	}
+}
+
+func TestBoltUpgradesOnRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store, err := OpenBoltStore(path, WithBoltTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.Create(context.Background(), newUpgradeSession("s1")); err != nil {
+		t.Fatal(err)
+	}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltSessionsBucket)
+		var record map[string]json.RawMessage
+		if err := json.Unmarshal(bucket.Get([]byte("s1")), &record); err != nil {
+			return err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(record["data"], &fields); err != nil {
+			return err
+		}
+		downgrade(fields)
+		var err error
+		if record["data"], err = json.Marshal(fields); err != nil {
+			return err
+		}
+		val, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte("s1"), val)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUpgrade(t, store, "s1")
+}
+
+func TestPostgresUpgradesOnRead(t *testing.T) {
+	db := openTestDB(t)
+	table := newTestTable(t, db)
+	store := NewPostgresStore(db, WithPostgresTable(table), WithReapInterval(0))
+	t.Cleanup(func() { store.Close() })
+
+	id := fmt.Sprintf("upgrade:%d", time.Now().UnixNano())
+	if err := store.Create(context.Background(), newUpgradeSession(id)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := db.Exec("UPDATE "+table+` SET data = (data - 'language' - 'schema_version') || jsonb_build_object('locale', data->'language') WHERE id = $1`, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUpgrade(t, store, id)
+}
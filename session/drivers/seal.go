@@ -0,0 +1,127 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/codec"
+)
+
+// sealedHeader starts the values encrypted by a sealer. Neither JSON nor
+// codec headers start with it, so values written without a cipher are read
+// as plaintext.
+const sealedHeader byte = 0x01
+
+// sealedJSONPrefix starts the JSON strings holding values encrypted by
+// sealJSON: the header character, escaped as encoding/json and Postgres
+// escape it.
+var sealedJSONPrefix = []byte(`"\u0001`)
+
+// plainCodec decodes values for stores without a codec, which may read
+// values encoded by other instances.
+var plainCodec = codec.New()
+
+// sealer encodes the values a driver stores with the configured codec, then
+// encrypts them with the configured cipher, and reverses both steps for the
+// values it reads. The zero value stores plain JSON.
+type sealer struct {
+	codec  session.Codec
+	cipher session.Cipher
+}
+
+// seal encodes and encrypts the JSON value of a session field.
+func (s sealer) seal(ctx context.Context, id string, field session.Field, val []byte) ([]byte, error) {
+	val, err := s.encoder().Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	return s.encrypt(ctx, id, field, val)
+}
+
+// open decrypts and decodes a value written by seal or sealJSON, or by a
+// store without a codec or cipher.
+// Returns ErrNoCipher if the value is encrypted and no cipher is configured.
+func (s sealer) open(ctx context.Context, id string, field session.Field, val []byte) ([]byte, error) {
+	if len(val) > 0 && val[0] == sealedHeader {
+		if s.cipher == nil {
+			return nil, session.ErrNoCipher
+		}
+		var err error
+		if val, err = s.cipher.Decrypt(ctx, val[1:], sealedData(id, field)); err != nil {
+			return nil, err
+		}
+	}
+	return s.encoder().Decode(val)
+}
+
+// encrypt encrypts a value, or returns it unchanged without a cipher.
+func (s sealer) encrypt(ctx context.Context, id string, field session.Field, val []byte) ([]byte, error) {
+	if s.cipher == nil {
+		return val, nil
+	}
+	ciphertext, err := s.cipher.Encrypt(ctx, val, sealedData(id, field))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{sealedHeader}, ciphertext...), nil
+}
+
+// encoder returns the configured codec, or one decoding values of any
+// codec while writing plain JSON.
+func (s sealer) encoder() session.Codec {
+	if s.codec == nil {
+		return plainCodec
+	}
+	return s.codec
+}
+
+// sealJSON is seal for stores that only hold JSON, which are not encoded:
+// the encrypted value is a JSON string of the header character followed by
+// the base64 ciphertext.
+func (s sealer) sealJSON(ctx context.Context, id string, field session.Field, val json.RawMessage) (json.RawMessage, error) {
+	if s.cipher == nil {
+		return val, nil
+	}
+	sealed, err := s.encrypt(ctx, id, field, val)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(sealedHeader) + base64.StdEncoding.EncodeToString(sealed[1:]))
+}
+
+// openJSON decrypts a value encrypted by sealJSON, or returns a plaintext
+// value unchanged.
+// Returns ErrNoCipher if the value is encrypted and no cipher is configured.
+func (s sealer) openJSON(ctx context.Context, id string, field session.Field, val json.RawMessage) (json.RawMessage, error) {
+	if !bytes.HasPrefix(val, sealedJSONPrefix) {
+		return val, nil
+	}
+	var str string
+	if err := json.Unmarshal(val, &str); err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(str[1:])
+	if err != nil {
+		return nil, err
+	}
+	return s.open(ctx, id, field, append([]byte{sealedHeader}, ciphertext...))
+}
+
+// sealedData returns the associated data binding a value to its session
+// and field.
+func sealedData(id string, field session.Field) []byte {
+	return []byte(id + "\x00" + string(field))
+}
+
+// sealable reports whether a field is encrypted. The tenant, assistant and
+// user IDs are stored in plaintext: stores index sessions by them.
+func sealable(field session.Field) bool {
+	switch field {
+	case session.FieldTenantID, session.FieldAssistantID, session.FieldUserID:
+		return false
+	}
+	return true
+}
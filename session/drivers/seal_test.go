@@ -0,0 +1,182 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/codec"
+	"github.com/creastat/storage/session/encryption"
+	"github.com/creastat/storage/session/sessiontest"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestCipher returns an envelope cipher under a fixed test key.
+func newTestCipher(t *testing.T) session.Cipher {
+	t.Helper()
+	keyring, err := encryption.NewKeyring("test", map[string][]byte{"test": bytes.Repeat([]byte{7}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encryption.NewEnvelope(keyring)
+}
+
+// sealedStores returns the store options of the sealed configurations.
+func sealedStores(t *testing.T) map[string][]session.StoreOption {
+	cipher := newTestCipher(t)
+	return map[string][]session.StoreOption{
+		"Cipher": {session.WithCipher(cipher)},
+		"CipherAndCodec": {session.WithCipher(cipher),
+			session.WithCodec(codec.New(codec.WithEncoding(codec.MessagePack), codec.WithCompression(codec.Zstd, 64)))},
+	}
+}
+
+// newSealedStore returns a store of storeType created by session.NewStore
+// with opts, on the Redis server or bbolt file of the test.
+func newSealedStore(t *testing.T, storeType session.StoreType, target string, opts ...session.StoreOption) session.Store {
+	t.Helper()
+	switch storeType {
+	case session.StoreTypeRedis:
+		opts = append(opts, session.WithRedisClient(redis.NewClient(&redis.Options{Addr: target})))
+	case session.StoreTypeBolt:
+		opts = append(opts, session.WithBoltPath(target))
+	}
+	store, err := session.NewStore(storeType, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSealedStores(t *testing.T) {
+	for name, opts := range sealedStores(t) {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Redis", func(t *testing.T) {
+				sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+					return newSealedStore(t, session.StoreTypeRedis, miniredis.RunT(t).Addr(), append(opts, session.WithEvents())...)
+				})
+			})
+			t.Run("Bolt", func(t *testing.T) {
+				sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+					return newSealedStore(t, session.StoreTypeBolt, filepath.Join(t.TempDir(), "sessions.db"), opts...)
+				})
+			})
+		})
+	}
+}
+
+func TestSealOrder(t *testing.T) {
+	ctx := context.Background()
+	cipher := newTestCipher(t)
+	c := codec.New(codec.WithEncoding(codec.MessagePack))
+	s := sealer{codec: c, cipher: cipher}
+	val := []byte(`{"speed":1.25,"voice":"alloy"}`)
+
+	sealed, err := s.seal(ctx, "s1", session.FieldConfig, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed[0] != sealedHeader {
+		t.Fatalf("sealed value starts with %#x, want %#x", sealed[0], sealedHeader)
+	}
+
+	// The value is encoded, then the encoding is encrypted
+	encoded, err := cipher.Decrypt(ctx, sealed[1:], sealedData("s1", session.FieldConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(encoded, val) {
+		t.Errorf("encrypted value = %q, want its codec encoding", encoded)
+	}
+	if decoded, err := c.Decode(encoded); err != nil || !bytes.Equal(decoded, val) {
+		t.Errorf("codec decoding of encrypted value = %s, %v, want %s", decoded, err, val)
+	}
+
+	if got, err := s.open(ctx, "s1", session.FieldConfig, sealed); err != nil || !bytes.Equal(got, val) {
+		t.Errorf("open() = %s, %v, want %s", got, err, val)
+	}
+	// The value is bound to its session and field
+	if _, err := s.open(ctx, "s2", session.FieldConfig, sealed); err == nil {
+		t.Error("open() of value moved to another session succeeded")
+	}
+	if _, err := s.open(ctx, "s1", session.FieldSystemPrompt, sealed); err == nil {
+		t.Error("open() of value moved to another field succeeded")
+	}
+	if _, err := (sealer{codec: c}).open(ctx, "s1", session.FieldConfig, sealed); !errors.Is(err, session.ErrNoCipher) {
+		t.Errorf("open() without cipher = %v, want ErrNoCipher", err)
+	}
+}
+
+func TestSealedStoresReadPlaintext(t *testing.T) {
+	ctx := context.Background()
+	targets := map[session.StoreType]func(t *testing.T) (target string, stored func(id string) []byte){
+		session.StoreTypeRedis: func(t *testing.T) (string, func(string) []byte) {
+			m := miniredis.RunT(t)
+			return m.Addr(), func(id string) []byte {
+				return []byte(m.HGet(sessionKeyPrefix+"{"+id+"}", string(session.FieldLanguage)))
+			}
+		},
+		session.StoreTypeBolt: func(t *testing.T) (string, func(string) []byte) {
+			path := filepath.Join(t.TempDir(), "sessions.db")
+			return path, func(id string) []byte {
+				store, err := OpenBoltStore(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer store.Close()
+				return boltValue(t, store, boltSessionsBucket, []byte(id))
+			}
+		},
+	}
+
+	for name, opts := range sealedStores(t) {
+		for storeType, newTarget := range targets {
+			t.Run(name+"/"+string(storeType), func(t *testing.T) {
+				target, stored := newTarget(t)
+
+				// A session written without a cipher or codec...
+				plain := newSealedStore(t, storeType, target)
+				data := &session.SessionData{ID: "s1", TenantID: "t1", Language: "fr",
+					ConversationHistory: session.AddMessageToHistory(nil, "user", "bonjour")}
+				if err := plain.Create(ctx, data); err != nil {
+					t.Fatal(err)
+				}
+				plain.Close()
+				if val := stored("s1"); val[0] == sealedHeader {
+					t.Fatalf("plain store wrote encrypted value %q", val)
+				}
+
+				// ...is still read once they are configured
+				sealed := newSealedStore(t, storeType, target, opts...)
+				got, err := sealed.Get(ctx, "s1")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got == nil || got.Language != "fr" || len(got.ConversationHistory) != 1 ||
+					got.ConversationHistory[0].Content != "bonjour" {
+					t.Fatalf("Get() = %+v, want the plaintext session", got)
+				}
+
+				// and encrypted when next written
+				got.Language = "de-x-sealed"
+				if err := sealed.Update(ctx, got); err != nil {
+					t.Fatal(err)
+				}
+				sealed.Close()
+				if val := stored("s1"); val[0] != sealedHeader || bytes.Contains(val, []byte("de-x-sealed")) {
+					t.Errorf("stored value after Update() = %q, want it encrypted", val)
+				}
+
+				plain = newSealedStore(t, storeType, target)
+				defer plain.Close()
+				if _, err := plain.Get(ctx, "s1"); !errors.Is(err, session.ErrNoCipher) {
+					t.Errorf("Get() of encrypted session without cipher = %v, want ErrNoCipher", err)
+				}
+			})
+		}
+	}
+}
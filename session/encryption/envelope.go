@@ -0,0 +1,254 @@
+// Package encryption implements session.Cipher with envelope encryption.
+//
+// Values are encrypted with AES-256-GCM under a random data key. The data
+// key is itself encrypted ("wrapped") by a key-encryption key held by a
+// KeyProvider, such as a KMS or a Keyring, and stored alongside the
+// ciphertext with the ID of that key. Rotating the key-encryption key only
+// changes which key wraps new data keys: values written under older keys
+// are still decrypted, as long as the provider can unwrap with them.
+//
+//	keyring, err := encryption.NewKeyring("2024-06", map[string][]byte{
+//		"2024-01": oldKey,
+//		"2024-06": currentKey,
+//	})
+//	store, err := session.NewStore(session.StoreTypeRedis,
+//		session.WithRedisClient(client),
+//		session.WithCipher(encryption.NewEnvelope(keyring)))
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/creastat/storage/session"
+)
+
+const (
+	// Format version of encrypted values
+	formatVersion = 1
+	// Size of data keys (AES-256)
+	dataKeySize = 32
+	// Default time a data key encrypts values before a new one is generated
+	defaultDataKeyLifetime = time.Hour
+	// Maximum number of unwrapped data keys kept for decryption
+	maxCachedKeys = 1024
+)
+
+// ErrInvalidCiphertext is returned when decrypting a value that was not
+// produced by an Envelope.
+var ErrInvalidCiphertext = errors.New("invalid ciphertext")
+
+// KeyProvider wraps and unwraps data keys with key-encryption keys.
+type KeyProvider interface {
+	// WrapKey encrypts a data key with the current key-encryption key, and
+	// returns that key's ID with the wrapped data key.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a data key wrapped by the key-encryption key with
+	// the given ID. Keys retired by rotation must remain available for as
+	// long as data encrypted under them is stored.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Option is a functional option for configuring an Envelope.
+type Option func(*Envelope)
+
+// WithDataKeyLifetime sets how long a data key encrypts values before a new
+// one is generated and wrapped (default: 1 hour). Each new data key costs a
+// WrapKey call, and each data key read back an UnwrapKey call. Zero or
+// negative values generate a data key per value.
+func WithDataKeyLifetime(lifetime time.Duration) Option {
+	return func(e *Envelope) {
+		e.lifetime = lifetime
+	}
+}
+
+// Envelope implements session.Cipher with AES-256-GCM data keys wrapped by a
+// KeyProvider. It is safe for concurrent use.
+//
+// Encrypted values hold, in order: a format version byte, the key ID
+// preceded by its length (1 byte), the wrapped data key preceded by its
+// length (2 bytes, big-endian), the GCM nonce, and the sealed value. The
+// header is authenticated with the associated data.
+type Envelope struct {
+	provider KeyProvider
+	lifetime time.Duration
+
+	mu      sync.Mutex
+	current *dataKey
+	keys    map[string]cipher.AEAD // Unwrapped data keys by key ID and wrapped key
+}
+
+// dataKey is a data key used for encryption.
+type dataKey struct {
+	header  []byte // Format version, key ID and wrapped key
+	aead    cipher.AEAD
+	expires time.Time
+}
+
+// NewEnvelope creates an Envelope wrapping its data keys with provider.
+func NewEnvelope(provider KeyProvider, opts ...Option) *Envelope {
+	e := &Envelope{
+		provider: provider,
+		lifetime: defaultDataKeyLifetime,
+		keys:     make(map[string]cipher.AEAD),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Encrypt implements session.Cipher.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext, associatedData []byte) ([]byte, error) {
+	key, err := e.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(key.header)+len(nonce)+len(plaintext)+key.aead.Overhead())
+	out = append(append(out, key.header...), nonce...)
+	return key.aead.Seal(out, nonce, plaintext, additionalData(key.header, associatedData)), nil
+}
+
+// Decrypt implements session.Cipher.
+// Returns ErrInvalidCiphertext if the value is malformed, and an error
+// from the AEAD if it was tampered with or moved.
+func (e *Envelope) Decrypt(ctx context.Context, ciphertext, associatedData []byte) ([]byte, error) {
+	header, keyID, wrapped, err := parseHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := e.unwrap(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := ciphertext[len(header):]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, additionalData(header, associatedData))
+}
+
+// dataKey returns the data key to encrypt with, generating and wrapping a
+// new one if the current one has expired.
+func (e *Envelope) dataKey(ctx context.Context) (*dataKey, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	if e.current != nil && now.Before(e.current.expires) {
+		return e.current, nil
+	}
+
+	raw := make([]byte, dataKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := e.provider.WrapKey(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyID) > 0xff || len(wrapped) > 0xffff {
+		return nil, errors.New("encryption: key ID or wrapped key too long")
+	}
+	aead, err := newGCM(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte{formatVersion, byte(len(keyID))}
+	header = append(header, keyID...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrapped)))
+	header = append(header, wrapped...)
+
+	e.current = &dataKey{header: header, aead: aead, expires: now.Add(e.lifetime)}
+	e.cache(keyID, wrapped, aead)
+	return e.current, nil
+}
+
+// unwrap returns the AEAD of a wrapped data key, unwrapping it with the
+// provider unless it is cached.
+func (e *Envelope) unwrap(ctx context.Context, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	e.mu.Lock()
+	aead, ok := e.keys[cacheKey(keyID, wrapped)]
+	e.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	raw, err := e.provider.UnwrapKey(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newGCM(raw); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.cache(keyID, wrapped, aead)
+	e.mu.Unlock()
+	return aead, nil
+}
+
+// cache keeps an unwrapped data key, emptying the cache when it is full.
+// Must be called with the lock held.
+func (e *Envelope) cache(keyID string, wrapped []byte, aead cipher.AEAD) {
+	if len(e.keys) >= maxCachedKeys {
+		clear(e.keys)
+	}
+	e.keys[cacheKey(keyID, wrapped)] = aead
+}
+
+// cacheKey returns the key of a data key in Envelope.keys.
+func cacheKey(keyID string, wrapped []byte) string {
+	return keyID + "\x00" + string(wrapped)
+}
+
+// parseHeader splits the header of an encrypted value into the key ID and
+// wrapped data key.
+func parseHeader(ciphertext []byte) (header []byte, keyID string, wrapped []byte, err error) {
+	if len(ciphertext) < 2 || ciphertext[0] != formatVersion {
+		return nil, "", nil, ErrInvalidCiphertext
+	}
+	n := 2 + int(ciphertext[1])
+	if len(ciphertext) < n+2 {
+		return nil, "", nil, ErrInvalidCiphertext
+	}
+	keyID = string(ciphertext[2:n])
+	end := n + 2 + int(binary.BigEndian.Uint16(ciphertext[n:]))
+	if len(ciphertext) < end {
+		return nil, "", nil, ErrInvalidCiphertext
+	}
+	return ciphertext[:end], keyID, ciphertext[n+2 : end], nil
+}
+
+// additionalData returns the data authenticated with a value: its header,
+// then the caller's associated data.
+func additionalData(header, associatedData []byte) []byte {
+	return append(header[:len(header):len(header)], associatedData...)
+}
+
+// newGCM returns an AES-GCM AEAD for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Compile-time check that Envelope implements session.Cipher.
+var _ session.Cipher = (*Envelope)(nil)
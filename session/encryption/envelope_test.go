@@ -0,0 +1,215 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+// testKeys are the key-encryption keys of the tests, by ID.
+var testKeys = map[string][]byte{
+	"2024-01": bytes.Repeat([]byte{1}, 32),
+	"2024-06": bytes.Repeat([]byte{2}, 32),
+}
+
+// countingProvider counts the calls made to a KeyProvider.
+type countingProvider struct {
+	KeyProvider
+	wraps, unwraps int
+}
+
+func (p *countingProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	p.wraps++
+	return p.KeyProvider.WrapKey(ctx, dataKey)
+}
+
+func (p *countingProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	p.unwraps++
+	return p.KeyProvider.UnwrapKey(ctx, keyID, wrapped)
+}
+
+// newTestEnvelope returns an Envelope wrapping its data keys with the test
+// key currentID, out of the test keys named by ids.
+func newTestEnvelope(t *testing.T, currentID string, ids []string, opts ...Option) *Envelope {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for _, id := range ids {
+		keys[id] = testKeys[id]
+	}
+	keyring, err := NewKeyring(currentID, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewEnvelope(keyring, opts...)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnvelope(t, "2024-01", []string{"2024-01"})
+	ad := []byte("s1\x00language")
+
+	for _, plaintext := range [][]byte{[]byte(`"fr"`), {}, bytes.Repeat([]byte("x"), 1<<16)} {
+		ciphertext, err := e.Encrypt(ctx, plaintext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(plaintext) > 0 && bytes.Contains(ciphertext, plaintext) {
+			t.Error("ciphertext contains the plaintext")
+		}
+		got, err := e.Decrypt(ctx, ciphertext, ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("Decrypt() = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	ad := []byte("s1\x00language")
+	old, err := newTestEnvelope(t, "2024-01", []string{"2024-01"}).Encrypt(ctx, []byte("old"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once rotated, new values are encrypted under the current key while
+	// values under the previous one are still decrypted
+	rotated := newTestEnvelope(t, "2024-06", []string{"2024-01", "2024-06"})
+	if got, err := rotated.Decrypt(ctx, old, ad); err != nil || string(got) != "old" {
+		t.Errorf("Decrypt() of value under rotated-out key = %q, %v, want old", got, err)
+	}
+	current, err := rotated.Encrypt(ctx, []byte("new"), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, keyID, _, err := parseHeader(current); err != nil || keyID != "2024-06" {
+		t.Errorf("value encrypted under key %q, %v, want 2024-06", keyID, err)
+	}
+
+	// Once the previous key is dropped, its values are lost
+	dropped := newTestEnvelope(t, "2024-06", []string{"2024-06"})
+	if _, err := dropped.Decrypt(ctx, old, ad); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt() under missing key = %v, want ErrUnknownKey", err)
+	}
+	if got, err := dropped.Decrypt(ctx, current, ad); err != nil || string(got) != "new" {
+		t.Errorf("Decrypt() under current key = %q, %v, want new", got, err)
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	if _, err := NewKeyring("missing", testKeys); err == nil {
+		t.Error("NewKeyring() without the current key succeeded")
+	}
+	if _, err := NewKeyring("short", map[string][]byte{"short": make([]byte, 10)}); err == nil {
+		t.Error("NewKeyring() with a 10-byte key succeeded")
+	}
+}
+
+func TestTampering(t *testing.T) {
+	ctx := context.Background()
+	e := newTestEnvelope(t, "2024-01", []string{"2024-01"})
+	ad := []byte("s1\x00language")
+	ciphertext, err := e.Encrypt(ctx, []byte(`"fr"`), ad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A value moved to another session or field is rejected
+	for _, other := range []string{"s2\x00language", "s1\x00system_prompt", ""} {
+		if _, err := e.Decrypt(ctx, ciphertext, []byte(other)); err == nil {
+			t.Errorf("Decrypt() with associated data %q succeeded", other)
+		}
+	}
+
+	// So is a value with any byte flipped, in the header or after it
+	header, _, _, err := parseHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{1, 2, len(header) - 1, len(header), len(ciphertext) - 1} {
+		tampered := bytes.Clone(ciphertext)
+		tampered[i] ^= 0x80
+		if _, err := e.Decrypt(ctx, tampered, ad); err == nil {
+			t.Errorf("Decrypt() with byte %d flipped succeeded", i)
+		}
+	}
+
+	// Truncated values are malformed
+	for _, n := range []int{0, 1, 2, len(header) - 1, len(header), len(header) + 12} {
+		if _, err := e.Decrypt(ctx, ciphertext[:n], ad); !errors.Is(err, ErrInvalidCiphertext) {
+			t.Errorf("Decrypt() of first %d bytes = %v, want ErrInvalidCiphertext", n, err)
+		}
+	}
+	if _, err := e.Decrypt(ctx, append([]byte{formatVersion + 1}, ciphertext[1:]...), ad); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("Decrypt() of unknown format = %v, want ErrInvalidCiphertext", err)
+	}
+}
+
+func TestDataKeyLifetime(t *testing.T) {
+	ctx := context.Background()
+	keyring, err := NewKeyring("2024-01", testKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("s1\x00language")
+
+	encrypt := func(t *testing.T, e *Envelope) [][]byte {
+		t.Helper()
+		var headers [][]byte
+		for range 3 {
+			ciphertext, err := e.Encrypt(ctx, []byte("value"), ad)
+			if err != nil {
+				t.Fatal(err)
+			}
+			header, _, _, err := parseHeader(ciphertext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers = append(headers, header)
+		}
+		return headers
+	}
+
+	t.Run("Reused", func(t *testing.T) {
+		provider := &countingProvider{KeyProvider: keyring}
+		headers := encrypt(t, NewEnvelope(provider))
+		if provider.wraps != 1 {
+			t.Errorf("%d data keys wrapped, want 1", provider.wraps)
+		}
+		if !bytes.Equal(headers[0], headers[1]) || !bytes.Equal(headers[0], headers[2]) {
+			t.Error("values encrypted under different data keys")
+		}
+	})
+
+	t.Run("PerValue", func(t *testing.T) {
+		provider := &countingProvider{KeyProvider: keyring}
+		headers := encrypt(t, NewEnvelope(provider, WithDataKeyLifetime(0)))
+		if provider.wraps != 3 {
+			t.Errorf("%d data keys wrapped, want 3", provider.wraps)
+		}
+		if bytes.Equal(headers[0], headers[1]) || bytes.Equal(headers[1], headers[2]) {
+			t.Error("values encrypted under the same data key")
+		}
+	})
+
+	t.Run("Unwrapped", func(t *testing.T) {
+		// Data keys read back are unwrapped once
+		ciphertext, err := NewEnvelope(keyring).Encrypt(ctx, []byte("value"), ad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		provider := &countingProvider{KeyProvider: keyring}
+		e := NewEnvelope(provider)
+		for range 3 {
+			if _, err := e.Decrypt(ctx, ciphertext, ad); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if provider.unwraps != 1 {
+			t.Errorf("%d data keys unwrapped, want 1", provider.unwraps)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownKey is returned by Keyring.UnwrapKey for a key ID it does not
+// hold.
+var ErrUnknownKey = errors.New("unknown key-encryption key")
+
+// Keyring is a KeyProvider holding AES key-encryption keys in memory, such
+// as keys loaded from a secret store at startup. Data keys are wrapped with
+// AES-GCM under the current key.
+//
+// To rotate keys, add a new key, make it current, and keep the previous
+// keys until no data encrypted under them remains: sessions are
+// re-encrypted under the current key whenever they are written, and expire
+// otherwise.
+type Keyring struct {
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyring creates a Keyring from keys by ID, wrapping new data keys with
+// the key named by currentID. Keys must be 16, 24 or 32 bytes long (AES-128,
+// AES-192 or AES-256) and IDs at most 255 bytes.
+func NewKeyring(currentID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[currentID]; !ok {
+		return nil, fmt.Errorf("encryption: current key %q not in keyring", currentID)
+	}
+
+	k := &Keyring{currentID: currentID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(id) > 0xff {
+			return nil, fmt.Errorf("encryption: key ID %q too long", id)
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: key %q: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// WrapKey implements KeyProvider.
+func (k *Keyring) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	aead := k.keys[k.currentID]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(dataKey)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return k.currentID, aead.Seal(nonce, nonce, dataKey, []byte(k.currentID)), nil
+}
+
+// UnwrapKey implements KeyProvider.
+// Returns ErrUnknownKey if the keyring does not hold the key.
+func (k *Keyring) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+// Compile-time check that Keyring implements KeyProvider.
+var _ KeyProvider = (*Keyring)(nil)
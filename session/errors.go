@@ -1,6 +1,9 @@
 package session
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Common errors for session store operations.
 var (
@@ -8,4 +11,27 @@ var (
 	ErrInvalidStoreType = errors.New("invalid store type")
 	ErrVersionConflict  = errors.New("session version conflict")
 	ErrNotFound         = errors.New("session not found")
+	ErrAlreadyExists    = errors.New("session already exists")
+	ErrInvalidField     = errors.New("invalid session field")
+	ErrInvalidFilter    = errors.New("invalid session filter")
+	ErrInvalidCursor    = errors.New("invalid session cursor")
+	ErrNoCipher         = errors.New("session data is encrypted but no cipher is configured")
+	ErrScanUnsupported  = errors.New("session store does not implement session.Scanner")
+	ErrListUnsupported  = errors.New("session store implements neither session.Lister nor session.Scanner")
 )
+
+// ConflictError is returned by Mutate when every attempt hit a version conflict.
+// It matches ErrVersionConflict with errors.Is.
+type ConflictError struct {
+	ID       string // Session ID
+	Attempts int    // Number of attempts made
+	Err      error  // Error returned by the last attempt
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("session %s: %v after %d attempts", e.ID, e.Err, e.Attempts)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a session lifecycle event.
+type EventType string
+
+// Lifecycle event types
+const (
+	EventCreated EventType = "created" // Create stored a new session
+	EventUpdated EventType = "updated" // Update, Patch or AppendMessages changed a session
+	EventDeleted EventType = "deleted" // Delete removed a session
+	EventExpired EventType = "expired" // The session's TTL or lifetime lapsed
+)
+
+// Event describes a change to a session.
+type Event struct {
+	Type EventType `json:"type"`
+	ID   string    `json:"id"`
+
+	// Version is the session's version after the change, or 0 if the driver
+	// no longer knows it (as for Redis expiry).
+	Version int64 `json:"version,omitempty"`
+
+	// Time is when the change happened, as seen by the store.
+	Time time.Time `json:"time"`
+}
+
+// EventHandler handles a lifecycle event.
+// Handlers run on the store's goroutines and should return quickly; they may
+// call the store.
+type EventHandler func(Event)
+
+// Notifier is implemented by stores that emit lifecycle events.
+// Use a type assertion to check whether a Store supports events:
+//
+//	if n, ok := store.(session.Notifier); ok {
+//		unsubscribe := n.Subscribe(handler)
+//		defer unsubscribe()
+//	}
+type Notifier interface {
+	// Subscribe registers handler for every subsequent event and returns a
+	// function removing it.
+	Subscribe(handler EventHandler) (unsubscribe func())
+}
+
+// Broadcaster fans events out to subscribed handlers. Drivers embed it to
+// implement Notifier. The zero value is ready to use.
+type Broadcaster struct {
+	mu       sync.RWMutex
+	handlers map[int]EventHandler
+	next     int
+}
+
+// Subscribe implements Notifier.
+func (b *Broadcaster) Subscribe(handler EventHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.handlers == nil {
+		b.handlers = make(map[int]EventHandler)
+	}
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.handlers, id)
+		})
+	}
+}
+
+// HasSubscribers reports whether any handler is subscribed, so drivers can
+// skip building events nobody receives.
+func (b *Broadcaster) HasSubscribers() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.handlers) > 0
+}
+
+// Emit calls every subscribed handler with the event.
+func (b *Broadcaster) Emit(event Event) {
+	b.mu.RLock()
+	handlers := make([]EventHandler, 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// Expiry holds the resolved lifetime settings of a session.
+type Expiry struct {
+	// IdleTTL is the sliding TTL, refreshed whenever the session is accessed.
+	IdleTTL time.Duration
+	// Deadline is the absolute expiry regardless of activity; zero if none.
+	Deadline time.Time
+}
+
+// ResolveExpiry resolves a session's lifetime settings against the store
+// defaults: IdleTTL falls back to defaultIdleTTL, and MaxLifetime (counted
+// from CreatedAt) falls back to defaultMaxLifetime. A zero maximum lifetime
+// means the session only expires when idle.
+// Drivers use it so every backend honours the settings the same way.
+func ResolveExpiry(data *SessionData, defaultIdleTTL, defaultMaxLifetime time.Duration) Expiry {
+	expiry := Expiry{IdleTTL: defaultIdleTTL}
+	if data.IdleTTL > 0 {
+		expiry.IdleTTL = data.IdleTTL
+	}
+
+	maxLifetime := defaultMaxLifetime
+	if data.MaxLifetime > 0 {
+		maxLifetime = data.MaxLifetime
+	}
+	if maxLifetime > 0 {
+		expiry.Deadline = data.CreatedAt.Add(maxLifetime)
+	}
+	return expiry
+}
+
+// At returns when the session expires if it is accessed at now: after
+// IdleTTL, but no later than Deadline.
+func (e Expiry) At(now time.Time) time.Time {
+	expiresAt := now.Add(e.IdleTTL)
+	if !e.Deadline.IsZero() && e.Deadline.Before(expiresAt) {
+		return e.Deadline
+	}
+	return expiresAt
+}
+
+// Toucher is implemented by stores that can extend a session's expiry
+// without reading it. Use Touch, which falls back to Get for stores that do
+// not implement it.
+type Toucher interface {
+	// Touch extends a session's idle expiry without reading or writing it,
+	// as any other access would. The maximum lifetime still applies.
+	// Returns ErrNotFound if the session does not exist.
+	Touch(ctx context.Context, id string) error
+}
+
+// Touch extends a session's idle expiry, as Toucher.Touch does. If store
+// does not implement Toucher, the session is read with Get, which extends
+// its expiry in stores that refresh it on every access.
+// Returns ErrNotFound if the session does not exist.
+func Touch(ctx context.Context, store Store, id string) error {
+	if toucher, ok := store.(Toucher); ok {
+		return toucher.Touch(ctx, id)
+	}
+	data, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return ErrNotFound
+	}
+	return nil
+}
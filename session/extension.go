@@ -0,0 +1,97 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Extension is a typed slot holding a service's own state in
+// SessionData.Extensions, under a name unique to the service. The state is
+// stored as JSON with the rest of the session, so it shares its version,
+// optimistic locking, expiry and encryption:
+//
+//	var Billing = session.NewExtension[BillingState]("billing")
+//
+//	state, ok, err := Billing.Get(data)
+//	err = Billing.Set(data, state)
+//	err = session.Patch(ctx, store, data, session.FieldExtensions)
+//
+// An Extension is a value: declare it once as a package variable.
+type Extension[T any] struct {
+	name string
+}
+
+// NewExtension returns the slot named name, holding values of type T,
+// which must round-trip through encoding/json. Names are namespaced by
+// convention (e.g. "billing" or "myservice.state"); every Extension with
+// the same name refers to the same slot.
+func NewExtension[T any](name string) Extension[T] {
+	return Extension[T]{name: name}
+}
+
+// Name returns the name of the slot in SessionData.Extensions.
+func (e Extension[T]) Name() string {
+	return e.name
+}
+
+// Get decodes the value of the slot in data. ok is false, and value the
+// zero value, if the slot is empty.
+// Returns an error if the stored value does not decode into T.
+func (e Extension[T]) Get(data *SessionData) (value T, ok bool, err error) {
+	raw, ok := data.Extensions[e.name]
+	if !ok {
+		return value, false, nil
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return value, false, fmt.Errorf("session: extension %s: %w", e.name, err)
+	}
+	return value, true, nil
+}
+
+// Set encodes value into the slot in data. Like any other change to data,
+// it is stored by the next Update, or Patch of FieldExtensions.
+func (e Extension[T]) Set(data *SessionData, value T) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("session: extension %s: %w", e.name, err)
+	}
+	if data.Extensions == nil {
+		data.Extensions = make(map[string]json.RawMessage)
+	}
+	data.Extensions[e.name] = raw
+	return nil
+}
+
+// Delete empties the slot in data.
+func (e Extension[T]) Delete(data *SessionData) {
+	delete(data.Extensions, e.name)
+}
+
+// Mutate performs an atomic read-modify-write of the slot in a session, as
+// Mutate does for the whole session: fn receives the current value (the
+// zero value if the slot is empty) and may modify it, and the session is
+// written back with Update, retrying on ErrVersionConflict. fn may be called
+// several times; if it returns an error, Mutate stops and returns that
+// error unchanged.
+// Returns the stored value on success.
+// Returns ErrNotFound if the session does not exist.
+// Returns a *ConflictError (matching ErrVersionConflict) if every attempt conflicted.
+func (e Extension[T]) Mutate(ctx context.Context, store Store, id string, fn func(*T) error, opts ...MutateOption) (T, error) {
+	var value T
+	_, err := Mutate(ctx, store, id, func(data *SessionData) error {
+		var err error
+		if value, _, err = e.Get(data); err != nil {
+			return err
+		}
+		if err := fn(&value); err != nil {
+			return err
+		}
+		return e.Set(data, value)
+	}, opts...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
@@ -0,0 +1,47 @@
+package session_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/drivers"
+	"github.com/creastat/storage/session/sessiontest"
+)
+
+// basicStore hides every optional interface of the store it wraps, so the
+// helpers fall back to the Store methods.
+type basicStore struct {
+	session.Store
+}
+
+// scanningStore only keeps the Scanner of the store it wraps, so List falls
+// back to scanning.
+type scanningStore struct {
+	session.Store
+	session.Scanner
+}
+
+func TestFallbacks(t *testing.T) {
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		return basicStore{drivers.NewInMemoryStore()}
+	})
+}
+
+func TestListFallback(t *testing.T) {
+	sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+		store := drivers.NewInMemoryStore()
+		return scanningStore{store, store}
+	})
+}
+
+func TestListUnsupported(t *testing.T) {
+	store := basicStore{drivers.NewInMemoryStore()}
+	defer store.Close()
+
+	_, _, err := session.List(context.Background(), store, session.ListFilter{TenantID: "t1"}, "")
+	if !errors.Is(err, session.ErrListUnsupported) {
+		t.Errorf("List() error = %v, want ErrListUnsupported", err)
+	}
+}
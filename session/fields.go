@@ -0,0 +1,186 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Field names a SessionData field by its JSON name.
+// Fields are the unit of storage for drivers that store sessions field by
+// field, and of partial updates with Patch.
+type Field string
+
+// Fields that can be updated with Patch.
+const (
+	FieldConversationHistory Field = "conversation_history"
+	FieldSystemPrompt        Field = "system_prompt"
+	FieldKeyterms            Field = "keyterms"
+	FieldLanguage            Field = "language"
+	FieldTTSEnabled          Field = "tts_enabled"
+	FieldAllowedOrigins      Field = "allowed_origins"
+	FieldRateLimits          Field = "rate_limits"
+	FieldConfig              Field = "config"
+	FieldExtensions          Field = "extensions"
+	FieldIdleTTL             Field = "idle_ttl"
+	FieldMaxLifetime         Field = "max_lifetime"
+)
+
+// Fields maintained by the store, which cannot be patched. The indexed
+// tenant, assistant and user IDs can only be changed with Store.Update.
+const (
+	FieldID            Field = "id"
+	FieldTenantID      Field = "tenant_id"
+	FieldAssistantID   Field = "assistant_id"
+	FieldUserID        Field = "user_id"
+	FieldCreatedAt     Field = "created_at"
+	FieldUpdatedAt     Field = "updated_at"
+	FieldVersion       Field = "version"
+	FieldSchemaVersion Field = "schema_version"
+	FieldExpiresAt     Field = "expires_at"
+)
+
+// patchable is the set of fields accepted by Patch.
+var patchable = map[Field]bool{
+	FieldConversationHistory: true,
+	FieldSystemPrompt:        true,
+	FieldKeyterms:            true,
+	FieldLanguage:            true,
+	FieldTTSEnabled:          true,
+	FieldAllowedOrigins:      true,
+	FieldRateLimits:          true,
+	FieldConfig:              true,
+	FieldExtensions:          true,
+	FieldIdleTTL:             true,
+	FieldMaxLifetime:         true,
+}
+
+// ValidatePatch checks that fields is a non-empty list of patchable fields.
+// Returns ErrInvalidField otherwise.
+func ValidatePatch(fields []Field) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("%w: no fields to patch", ErrInvalidField)
+	}
+	for _, f := range fields {
+		if !patchable[f] {
+			return fmt.Errorf("%w: %s", ErrInvalidField, f)
+		}
+	}
+	return nil
+}
+
+// MarshalFields encodes each field of data as JSON, keyed by field name.
+// Fields omitted when empty (such as IdleTTL) are absent from the result.
+func MarshalFields(data *SessionData) (map[Field]json.RawMessage, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[Field]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// UnmarshalFields decodes fields encoded by MarshalFields into data.
+// Fields missing from the map are left unchanged.
+func UnmarshalFields(fields map[Field]json.RawMessage, data *SessionData) error {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, data)
+}
+
+// PatchFields returns a copy of stored with the named fields copied from
+// data. Drivers use it to apply a patch to a session they hold whole.
+func PatchFields(stored, data *SessionData, fields []Field) (*SessionData, error) {
+	encoded, err := MarshalFields(stored)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := MarshalFields(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		if v, ok := patch[f]; ok {
+			encoded[f] = v
+		} else {
+			delete(encoded, f) // Omitted when empty
+		}
+	}
+
+	var updated SessionData
+	if err := UnmarshalFields(encoded, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// Patcher is implemented by stores that can update some fields of a session
+// without rewriting the others. Use Patch, which falls back to Get and
+// Update for stores that do not implement it.
+type Patcher interface {
+	// Patch updates only the named fields of a session with optimistic
+	// locking, copying their values from data. Like Update, it verifies
+	// Version, increments it and updates UpdatedAt; other fields are left
+	// as stored, so patching settings does not rewrite the history.
+	// Messages appended since the read only cause a conflict if
+	// FieldConversationHistory is patched.
+	// Returns ErrInvalidField if a field cannot be patched.
+	// Returns ErrVersionConflict if the version does not match.
+	// Returns ErrNotFound if the session does not exist.
+	Patch(ctx context.Context, data *SessionData, fields ...Field) error
+}
+
+// Patch updates only the named fields of a session, as Patcher.Patch does.
+// If store does not implement Patcher, Patch reads the stored session,
+// copies the named fields into it and writes it back with Update, so the
+// whole session is rewritten, with the same result.
+// Returns ErrInvalidField if a field cannot be patched.
+// Returns ErrVersionConflict if the version does not match.
+// Returns ErrNotFound if the session does not exist.
+func Patch(ctx context.Context, store Store, data *SessionData, fields ...Field) error {
+	if patcher, ok := store.(Patcher); ok {
+		return patcher.Patch(ctx, data, fields...)
+	}
+	if err := ValidatePatch(fields); err != nil {
+		return err
+	}
+
+	stored, err := store.Get(ctx, data.ID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrNotFound
+	}
+
+	// Appended messages only conflict with a new history
+	patchHistory := slices.Contains(fields, FieldConversationHistory)
+	if stored.Version != data.Version || patchHistory && stored.AppendedMessages != data.AppendedMessages {
+		return ErrVersionConflict
+	}
+
+	updated, err := PatchFields(stored, data, fields)
+	if err != nil {
+		return err
+	}
+	// Update checks the stored session was not changed since read
+	updated.AppendedMessages = stored.AppendedMessages
+	if err := store.Update(ctx, updated); err != nil {
+		return err
+	}
+
+	data.Version = updated.Version
+	data.SchemaVersion = updated.SchemaVersion
+	data.UpdatedAt = updated.UpdatedAt
+	data.ExpiresAt = updated.ExpiresAt
+	if patchHistory {
+		data.AppendedMessages = 0
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package session
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // TruncateHistory truncates the conversation history based on token and message limits.
 // It applies message limit first, then token limit, removing oldest messages as needed.
@@ -33,12 +36,50 @@ func TruncateHistory(history []Message, tokenLimit, messageLimit int) []Message
 // AddMessageToHistory appends a message to the conversation history with an estimated token count.
 // It calculates the token count using EstimateTokens and returns the updated history.
 func AddMessageToHistory(history []Message, role, content string) []Message {
-	tokenCount := EstimateTokens(content)
-	message := Message{
+	return append(history, NewMessage(role, content))
+}
+
+// NewMessage creates a message with an estimated token count and the current timestamp,
+// ready for AddMessageToHistory or AppendMessages.
+func NewMessage(role, content string) Message {
+	return Message{
 		Role:       role,
 		Content:    content,
-		TokenCount: tokenCount,
+		TokenCount: EstimateTokens(content),
 		Timestamp:  time.Now(),
 	}
-	return append(history, message)
+}
+
+// Appender is implemented by stores that can append messages to a session
+// without rewriting it. Use AppendMessages, which falls back to Mutate for
+// stores that do not implement it.
+type Appender interface {
+	// AppendMessages appends messages to a session's conversation history
+	// without rewriting the rest of the session. It does not increment
+	// Version, so it never conflicts with concurrent appends or updates;
+	// Get returns the stored history followed by the appended messages.
+	// Update returns ErrVersionConflict if messages were appended since
+	// the data was read (see SessionData.AppendedMessages), rather than
+	// dropping them.
+	// Returns ErrNotFound if the session does not exist.
+	AppendMessages(ctx context.Context, id string, msgs ...Message) error
+}
+
+// AppendMessages appends messages to a session's conversation history, as
+// Appender.AppendMessages does. If store does not implement Appender, the
+// messages are appended with Mutate, which rewrites the whole session and
+// increments Version, so concurrent writers retry rather than conflict.
+// Returns ErrNotFound if the session does not exist.
+func AppendMessages(ctx context.Context, store Store, id string, msgs ...Message) error {
+	if appender, ok := store.(Appender); ok {
+		return appender.AppendMessages(ctx, id, msgs...)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	_, err := Mutate(ctx, store, id, func(data *SessionData) error {
+		data.ConversationHistory = append(data.ConversationHistory, msgs...)
+		return nil
+	})
+	return err
 }
@@ -3,9 +3,15 @@ package session
 import "context"
 
 // Store defines the interface for session storage operations.
+// Stores may also implement the optional Patcher, Appender, Toucher,
+// Lister, Notifier and Scanner interfaces. Call Patch, AppendMessages,
+// Touch and List rather than their methods: they fall back to the Store
+// methods for stores that do not implement them.
 type Store interface {
-	// Create creates a new session with Version set to 1.
-	// Returns an error if the session already exists.
+	// Create atomically creates a new session with Version set to 1, if no
+	// session with the same ID exists.
+	// Returns ErrAlreadyExists if the session already exists; data is then
+	// left unchanged.
 	Create(ctx context.Context, data *SessionData) error
 
 	// Get retrieves a session by ID.
@@ -25,5 +31,3 @@ type Store interface {
 	// Close closes the store and releases any resources.
 	Close() error
 }
-
-
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default number of sessions per List page
+const defaultListLimit = 100
+
+// ListFilter selects sessions for List.
+// At least one of TenantID, AssistantID and UserID must be set; sessions
+// must match all that are.
+type ListFilter struct {
+	TenantID    string
+	AssistantID string
+	UserID      string
+
+	// Limit is the maximum number of sessions per page. Defaults to 100.
+	Limit int
+}
+
+// Validate checks that the filter selects by at least one ID and applies
+// the default limit. Returns ErrInvalidFilter otherwise.
+func (f *ListFilter) Validate() error {
+	if f.TenantID == "" && f.AssistantID == "" && f.UserID == "" {
+		return fmt.Errorf("%w: no tenant, assistant or user ID", ErrInvalidFilter)
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultListLimit
+	}
+	return nil
+}
+
+// Matches reports whether a session matches every ID set in the filter.
+func (f ListFilter) Matches(data *SessionData) bool {
+	return (f.TenantID == "" || data.TenantID == f.TenantID) &&
+		(f.AssistantID == "" || data.AssistantID == f.AssistantID) &&
+		(f.UserID == "" || data.UserID == f.UserID)
+}
+
+// ListPosition is a session's position in List order: by creation time at
+// millisecond precision, then by ID.
+type ListPosition struct {
+	CreatedAt int64 // Unix milliseconds
+	ID        string
+}
+
+// PositionOf returns a session's position in List order.
+func PositionOf(data *SessionData) ListPosition {
+	return ListPosition{CreatedAt: data.CreatedAt.UnixMilli(), ID: data.ID}
+}
+
+// After reports whether p comes after other in List order.
+func (p ListPosition) After(other ListPosition) bool {
+	if p.CreatedAt != other.CreatedAt {
+		return p.CreatedAt > other.CreatedAt
+	}
+	return p.ID > other.ID
+}
+
+// EncodeCursor returns the opaque List cursor resuming after p.
+func EncodeCursor(p ListPosition) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(p.CreatedAt, 10) + ":" + p.ID))
+}
+
+// DecodeCursor parses a cursor returned by EncodeCursor.
+// An empty cursor decodes to a position before every session.
+// Returns ErrInvalidCursor if the cursor is malformed.
+func DecodeCursor(cursor string) (ListPosition, error) {
+	if cursor == "" {
+		return ListPosition{CreatedAt: time.Time{}.UnixMilli()}, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return ListPosition{}, ErrInvalidCursor
+	}
+	ms, id, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return ListPosition{}, ErrInvalidCursor
+	}
+	createdAt, err := strconv.ParseInt(ms, 10, 64)
+	if err != nil {
+		return ListPosition{}, ErrInvalidCursor
+	}
+	return ListPosition{CreatedAt: createdAt, ID: id}, nil
+}
+
+// Lister is implemented by stores that index sessions by tenant, assistant
+// and user. Use List, which falls back to Scanner for stores that do not
+// implement it.
+type Lister interface {
+	// List returns a page of live sessions matching filter, ordered by
+	// creation time, and the cursor of the next page ("" after the last
+	// page). Pass an empty cursor to start from the beginning.
+	// Sessions are returned without their conversation history, and listing
+	// does not refresh their expiry.
+	// Returns ErrInvalidFilter if the filter selects no tenant, assistant or user.
+	// Returns ErrInvalidCursor if the cursor is malformed.
+	List(ctx context.Context, filter ListFilter, cursor string) ([]*SessionData, string, error)
+}
+
+// List returns a page of live sessions matching filter, as Lister.List
+// does. If store does not implement Lister but implements Scanner, every
+// session is scanned to build each page.
+// Returns ErrInvalidFilter if the filter selects no tenant, assistant or user.
+// Returns ErrInvalidCursor if the cursor is malformed.
+// Returns ErrListUnsupported if the store implements neither interface.
+func List(ctx context.Context, store Store, filter ListFilter, cursor string) ([]*SessionData, string, error) {
+	if lister, ok := store.(Lister); ok {
+		return lister.List(ctx, filter, cursor)
+	}
+	scanner, ok := store.(Scanner)
+	if !ok {
+		return nil, "", ErrListUnsupported
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, "", err
+	}
+	after, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var results []*SessionData
+	err = scanner.Scan(ctx, func(data *SessionData) error {
+		if filter.Matches(data) && PositionOf(data).After(after) {
+			results = append(results, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	slices.SortFunc(results, func(a, b *SessionData) int {
+		if PositionOf(a).After(PositionOf(b)) {
+			return 1
+		}
+		return -1
+	})
+	var next string
+	if len(results) > filter.Limit {
+		results = results[:filter.Limit]
+		next = EncodeCursor(PositionOf(results[len(results)-1]))
+	}
+	return results, next, nil
+}
@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	// Default number of attempts made by Mutate
+	defaultMaxAttempts = 5
+	// Default backoff bounds between Mutate attempts
+	defaultBaseBackoff = 10 * time.Millisecond
+	defaultMaxBackoff  = time.Second
+)
+
+// MutateOption is a functional option for configuring Mutate.
+type MutateOption func(*mutateConfig)
+
+// mutateConfig holds configuration for Mutate.
+type mutateConfig struct {
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// WithMaxAttempts sets how many times Mutate tries the read-modify-write
+// cycle before giving up. Values below 1 are treated as 1.
+func WithMaxAttempts(n int) MutateOption {
+	return func(c *mutateConfig) {
+		c.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff sets the backoff between Mutate attempts.
+// The wait before retry n is drawn uniformly from [0, min(limit, base*2^(n-1))).
+// A zero base or limit disables waiting.
+func WithBackoff(base, limit time.Duration) MutateOption {
+	return func(c *mutateConfig) {
+		c.baseBackoff = base
+		c.maxBackoff = limit
+	}
+}
+
+// Mutate performs an atomic read-modify-write of a session.
+// It reads the session, applies fn and writes it back with Update, retrying
+// from a fresh read with jittered exponential backoff when Update returns
+// ErrVersionConflict. fn may be called several times and must not have side
+// effects outside the session it is given; if it returns an error, Mutate
+// stops and returns that error unchanged.
+// Returns the updated session on success.
+// Returns ErrNotFound if the session does not exist.
+// Returns a *ConflictError (matching ErrVersionConflict) if every attempt conflicted.
+func Mutate(ctx context.Context, store Store, id string, fn func(*SessionData) error, opts ...MutateOption) (*SessionData, error) {
+	config := mutateConfig{
+		maxAttempts: defaultMaxAttempts,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	var err error
+	for attempt := 1; attempt <= config.maxAttempts; attempt++ {
+		if attempt > 1 {
+			if err := sleep(ctx, backoff(config, attempt-1)); err != nil {
+				return nil, err
+			}
+		}
+
+		var data *SessionData
+		data, err = store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			return nil, ErrNotFound
+		}
+
+		if err := fn(data); err != nil {
+			return nil, err
+		}
+
+		err = store.Update(ctx, data)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, ErrVersionConflict) {
+			return nil, err
+		}
+	}
+
+	return nil, &ConflictError{ID: id, Attempts: config.maxAttempts, Err: err}
+}
+
+// backoff returns a random wait before the given retry (starting at 1).
+func backoff(config mutateConfig, retry int) time.Duration {
+	if config.baseBackoff <= 0 || config.maxBackoff <= 0 {
+		return 0
+	}
+	ceiling := config.baseBackoff
+	for i := 1; i < retry && ceiling < config.maxBackoff; i++ {
+		ceiling *= 2
+	}
+	return rand.N(min(ceiling, config.maxBackoff))
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,194 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conflictStore holds a single session, and rejects the first Updates with
+// ErrVersionConflict as if another writer got there first.
+type conflictStore struct {
+	mu        sync.Mutex
+	data      *SessionData
+	conflicts int   // Updates left to reject
+	updateErr error // Error returned by every Update, if set
+	gets      int
+	updates   int
+}
+
+func newConflictStore(conflicts int) *conflictStore {
+	return &conflictStore{data: &SessionData{ID: "s1", Version: 1}, conflicts: conflicts}
+}
+
+func (s *conflictStore) Create(ctx context.Context, data *SessionData) error {
+	return ErrAlreadyExists
+}
+
+func (s *conflictStore) Get(ctx context.Context, id string) (*SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gets++
+	if s.data == nil || s.data.ID != id {
+		return nil, nil
+	}
+	data := *s.data
+	return &data, nil
+}
+
+func (s *conflictStore) Update(ctx context.Context, data *SessionData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates++
+	if s.updateErr != nil {
+		return s.updateErr
+	}
+	if s.conflicts > 0 {
+		s.conflicts--
+		return ErrVersionConflict
+	}
+	if data.Version != s.data.Version {
+		return ErrVersionConflict
+	}
+	data.Version++
+	stored := *data
+	s.data = &stored
+	return nil
+}
+
+func (s *conflictStore) Delete(ctx context.Context, id string) error { return nil }
+
+func (s *conflictStore) Close() error { return nil }
+
+// noBackoff disables waiting between attempts.
+var noBackoff = WithBackoff(0, 0)
+
+func TestMutateRetries(t *testing.T) {
+	store := newConflictStore(2)
+	calls := 0
+	data, err := Mutate(context.Background(), store, "s1", func(data *SessionData) error {
+		calls++
+		data.Language = "fr"
+		return nil
+	}, noBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every attempt reads the session again and reapplies fn
+	if calls != 3 || store.gets != 3 || store.updates != 3 {
+		t.Errorf("fn called %d times, %d Gets, %d Updates, want 3 each", calls, store.gets, store.updates)
+	}
+	if data.Version != 2 || data.Language != "fr" || store.data.Language != "fr" {
+		t.Errorf("Mutate = version %d, language %q, want 2, fr", data.Version, data.Language)
+	}
+}
+
+func TestMutateConflictError(t *testing.T) {
+	store := newConflictStore(10)
+	_, err := Mutate(context.Background(), store, "s1", func(*SessionData) error { return nil },
+		WithMaxAttempts(3), noBackoff)
+
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("err = %v, want a *ConflictError", err)
+	}
+	if conflict.ID != "s1" || conflict.Attempts != 3 {
+		t.Errorf("ConflictError = %+v, want s1 after 3 attempts", conflict)
+	}
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Error("ConflictError does not match ErrVersionConflict")
+	}
+	if store.updates != 3 {
+		t.Errorf("%d Updates, want 3", store.updates)
+	}
+
+	// At least one attempt is made
+	store = newConflictStore(10)
+	_, err = Mutate(context.Background(), store, "s1", func(*SessionData) error { return nil },
+		WithMaxAttempts(0), noBackoff)
+	if !errors.As(err, &conflict) || conflict.Attempts != 1 || store.updates != 1 {
+		t.Errorf("WithMaxAttempts(0): err = %v after %d Updates, want a conflict after 1", err, store.updates)
+	}
+}
+
+func TestMutateErrors(t *testing.T) {
+	errFn := errors.New("fn failed")
+	store := newConflictStore(10)
+	calls := 0
+	_, err := Mutate(context.Background(), store, "s1", func(*SessionData) error {
+		calls++
+		return errFn
+	}, noBackoff)
+	// fn errors are returned as is, without writing or retrying
+	if err != errFn {
+		t.Errorf("err = %v, want %v", err, errFn)
+	}
+	if calls != 1 || store.updates != 0 {
+		t.Errorf("fn called %d times, %d Updates, want 1, 0", calls, store.updates)
+	}
+
+	// So are Update errors other than conflicts
+	errUpdate := errors.New("update failed")
+	store = newConflictStore(0)
+	store.updateErr = errUpdate
+	if _, err := Mutate(context.Background(), store, "s1", func(*SessionData) error { return nil }, noBackoff); err != errUpdate {
+		t.Errorf("err = %v, want %v", err, errUpdate)
+	}
+	if store.updates != 1 {
+		t.Errorf("%d Updates, want 1", store.updates)
+	}
+
+	if _, err := Mutate(context.Background(), store, "missing", func(*SessionData) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Mutate(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMutateBackoff(t *testing.T) {
+	const base, limit = 10 * time.Millisecond, 50 * time.Millisecond
+	config := mutateConfig{baseBackoff: base, maxBackoff: limit}
+	// Ceilings double from base, up to limit
+	ceilings := []time.Duration{10, 20, 40, 50, 50, 50}
+	for retry, ceiling := range ceilings {
+		ceiling *= time.Millisecond
+		var longest time.Duration
+		for range 1000 {
+			d := backoff(config, retry+1)
+			if d < 0 || d >= ceiling {
+				t.Fatalf("backoff before retry %d = %v, want in [0, %v)", retry+1, d, ceiling)
+			}
+			longest = max(longest, d)
+		}
+		// The waits are spread over the whole range
+		if longest < ceiling/2 {
+			t.Errorf("longest backoff before retry %d = %v, want close to %v", retry+1, longest, ceiling)
+		}
+	}
+
+	for _, config := range []mutateConfig{{baseBackoff: 0, maxBackoff: limit}, {baseBackoff: base, maxBackoff: 0}} {
+		if d := backoff(config, 3); d != 0 {
+			t.Errorf("backoff(%+v) = %v, want 0", config, d)
+		}
+	}
+}
+
+func TestMutateCanceledDuringBackoff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := newConflictStore(10)
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := Mutate(ctx, store, "s1", func(*SessionData) error { return nil }, WithBackoff(time.Hour, time.Hour))
+	if !errors.Is(err, context.Canceled) || err != ctx.Err() {
+		t.Errorf("err = %v, want %v", err, ctx.Err())
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Mutate returned after %v, want as soon as ctx was canceled", elapsed)
+	}
+	if store.updates != 1 {
+		t.Errorf("%d Updates, want 1 before the backoff", store.updates)
+	}
+}
@@ -1,30 +1,135 @@
 package session
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 // StoreOption is a functional option for configuring a session store.
-type StoreOption func(*storeConfig)
+type StoreOption func(*Config)
 
-// storeConfig holds configuration for session stores.
-type storeConfig struct {
-	redisClient *redis.Client
-	redisTTL    time.Duration
+// Config holds configuration for session stores.
+// It is assembled from StoreOptions by NewStore and passed to the Driver.
+type Config struct {
+	// RedisClient is the client used by the Redis driver.
+	RedisClient redis.UniversalClient
+
+	// PostgresDB is the database used by the Postgres driver.
+	PostgresDB *sql.DB
+
+	// BoltPath is the database file used by the bolt driver.
+	BoltPath string
+
+	// RedisTTL is the TTL for Redis keys.
+	// Takes precedence over TTL for the Redis driver.
+	RedisTTL time.Duration
+
+	// TTL is the default sliding session TTL for every driver.
+	// Zero selects the driver's default.
+	TTL time.Duration
+
+	// MaxLifetime is the default absolute session lifetime for every driver.
+	// Zero means sessions only expire when idle.
+	MaxLifetime time.Duration
+
+	// Cipher encrypts the session data persisted by the driver, if set.
+	Cipher Cipher
+
+	// Codec encodes the session data persisted by the driver, if set.
+	Codec Codec
+
+	// Events enables publishing lifecycle events, for drivers where it has
+	// a cost (Redis). Drivers that emit events in-process always do.
+	Events bool
+
+	// Options holds driver-specific settings, set with WithOption.
+	Options map[string]any
 }
 
 // WithRedisClient sets the Redis client for the Redis store.
-func WithRedisClient(client *redis.Client) StoreOption {
-	return func(c *storeConfig) {
-		c.redisClient = client
+// Accepts *redis.Client, *redis.ClusterClient, a Sentinel failover client,
+// or any other redis.UniversalClient.
+func WithRedisClient(client redis.UniversalClient) StoreOption {
+	return func(c *Config) {
+		c.RedisClient = client
+	}
+}
+
+// WithPostgresDB sets the database for the Postgres store.
+// The caller opens it with a Postgres database/sql driver (such as pgx's
+// stdlib or lib/pq) and keeps ownership: closing the store does not close it.
+func WithPostgresDB(db *sql.DB) StoreOption {
+	return func(c *Config) {
+		c.PostgresDB = db
+	}
+}
+
+// WithBoltPath sets the database file for the bolt store, an embedded
+// store for single-process deployments. The file is created if needed, and
+// only one process can open it at a time.
+func WithBoltPath(path string) StoreOption {
+	return func(c *Config) {
+		c.BoltPath = path
 	}
 }
 
 // WithRedisTTL sets the TTL for Redis keys.
 func WithRedisTTL(ttl time.Duration) StoreOption {
-	return func(c *storeConfig) {
-		c.redisTTL = ttl
+	return func(c *Config) {
+		c.RedisTTL = ttl
+	}
+}
+
+// WithTTL sets the default sliding session TTL for any driver.
+// Sessions can override it with SessionData.IdleTTL.
+func WithTTL(ttl time.Duration) StoreOption {
+	return func(c *Config) {
+		c.TTL = ttl
+	}
+}
+
+// WithMaxLifetime sets the default absolute session lifetime for any driver.
+// Sessions expire this long after creation regardless of activity, unless
+// they set their own SessionData.MaxLifetime.
+func WithMaxLifetime(lifetime time.Duration) StoreOption {
+	return func(c *Config) {
+		c.MaxLifetime = lifetime
+	}
+}
+
+// WithCipher encrypts session data at rest with cipher, for the drivers
+// that persist it (Redis, Postgres and bolt).
+func WithCipher(cipher Cipher) StoreOption {
+	return func(c *Config) {
+		c.Cipher = cipher
+	}
+}
+
+// WithCodec encodes session data with codec before it is stored, for the
+// drivers that store binary values (Redis and bolt). Postgres stores JSONB,
+// which it compresses itself.
+func WithCodec(codec Codec) StoreOption {
+	return func(c *Config) {
+		c.Codec = codec
+	}
+}
+
+// WithEvents makes the store publish lifecycle events (see Notifier).
+func WithEvents() StoreOption {
+	return func(c *Config) {
+		c.Events = true
+	}
+}
+
+// WithOption sets a driver-specific option, for drivers registered outside
+// this module. Keys should be namespaced by driver (e.g. "mydriver.dsn").
+func WithOption(key string, value any) StoreOption {
+	return func(c *Config) {
+		if c.Options == nil {
+			c.Options = make(map[string]any)
+		}
+		c.Options[key] = value
 	}
 }
@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Upgrade converts the stored fields of a session from the previous schema
+// version to the next, in place. fields holds the JSON encoding of each
+// field by name, as MarshalFields returns it, including fields SessionData
+// no longer has; fields that were not stored or not read (List reads no
+// history) are missing.
+//
+// Patch writes the fields it names in the current schema without upgrading
+// the others, so upgrades must leave fields already in the new format as
+// they are: an upgrade renaming a field must not overwrite the new field if
+// it is set.
+type Upgrade func(fields map[Field]json.RawMessage) error
+
+var (
+	upgradesMu sync.RWMutex
+	upgrades   []Upgrade // upgrades[i] upgrades schema version i to i+1
+)
+
+// RegisterUpgrade registers the upgrade of sessions to schema version
+// version from the previous one. Versions start at 1 and are registered in
+// order from an init function, so they are in place before any store reads
+// a session; sessions stored before the first upgrade was registered have
+// schema version 0.
+// If version is not the next version or if fn is nil, it panics.
+func RegisterUpgrade(version int, fn Upgrade) {
+	upgradesMu.Lock()
+	defer upgradesMu.Unlock()
+
+	if fn == nil {
+		panic("session: RegisterUpgrade upgrade is nil")
+	}
+	if version != len(upgrades)+1 {
+		panic(fmt.Sprintf("session: RegisterUpgrade called for version %d, expected %d", version, len(upgrades)+1))
+	}
+	upgrades = append(upgrades, fn)
+}
+
+// CurrentSchemaVersion returns the schema version stores stamp on the
+// sessions they write: the last version registered with RegisterUpgrade.
+func CurrentSchemaVersion() int {
+	upgradesMu.RLock()
+	defer upgradesMu.RUnlock()
+	return len(upgrades)
+}
+
+// UpgradeFields applies to fields encoded by MarshalFields the upgrades
+// registered after the schema version they were stored with, leaving
+// FieldSchemaVersion as stored. Fields stored by a later version, as during
+// a rolling deployment, are left unchanged.
+// Drivers call it on the fields they read, before UnmarshalFields.
+func UpgradeFields(fields map[Field]json.RawMessage) error {
+	var version int
+	if v, ok := fields[FieldSchemaVersion]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return fmt.Errorf("session: schema version: %w", err)
+		}
+	}
+
+	upgradesMu.RLock()
+	pending := upgrades[min(version, len(upgrades)):]
+	upgradesMu.RUnlock()
+
+	for i, fn := range pending {
+		if err := fn(fields); err != nil {
+			return fmt.Errorf("session: upgrade to schema version %d: %w", version+i+1, err)
+		}
+	}
+	return nil
+}
+
+// Scanner is implemented by stores that can enumerate their sessions, as
+// MigrateAll requires.
+type Scanner interface {
+	// Scan calls fn with every live session, without its conversation
+	// history and without refreshing its expiry, as List returns them.
+	// Sessions are visited in no particular order, and those created or
+	// deleted during the scan may be missed. fn may call the store; Scan
+	// stops at the first error it returns and returns that error.
+	Scan(ctx context.Context, fn func(*SessionData) error) error
+}
+
+// errUpToDate stops Mutate from rewriting a session already upgraded.
+var errUpToDate = errors.New("session is up to date")
+
+// MigrateAll rewrites every session stored with an earlier schema version
+// than CurrentSchemaVersion, so the stored data is current without waiting
+// for each session to be read and written. Sessions are upgraded whenever
+// they are read anyway; migrating them in bulk is optional. Rewriting a
+// session refreshes its idle expiry, as any write does, but sessions already
+// up to date are neither rewritten nor refreshed.
+// Returns the number of sessions rewritten, which is also set when an error
+// stops the migration.
+// Returns ErrScanUnsupported if the store does not implement Scanner.
+func MigrateAll(ctx context.Context, store Store, opts ...MutateOption) (int, error) {
+	scanner, ok := store.(Scanner)
+	if !ok {
+		return 0, ErrScanUnsupported
+	}
+
+	current := CurrentSchemaVersion()
+	migrated := 0
+	err := scanner.Scan(ctx, func(data *SessionData) error {
+		if data.SchemaVersion >= current {
+			return nil
+		}
+		_, err := Mutate(ctx, store, data.ID, func(latest *SessionData) error {
+			if latest.SchemaVersion >= current {
+				return errUpToDate // Rewritten concurrently
+			}
+			return nil
+		}, opts...)
+		switch {
+		case err == nil:
+			migrated++
+		case errors.Is(err, errUpToDate), errors.Is(err, ErrNotFound):
+			// Rewritten, deleted or expired since it was scanned
+		default:
+			return fmt.Errorf("session %s: %w", data.ID, err)
+		}
+		return nil
+	})
+	return migrated, err
+}
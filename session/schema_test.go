@@ -0,0 +1,261 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setUpgrades replaces the registered upgrades with fns, as versions 1 to
+// len(fns), until the test ends.
+func setUpgrades(t *testing.T, fns ...Upgrade) {
+	t.Helper()
+	upgradesMu.Lock()
+	registered := upgrades
+	upgrades = nil
+	upgradesMu.Unlock()
+	t.Cleanup(func() {
+		upgradesMu.Lock()
+		defer upgradesMu.Unlock()
+		upgrades = registered
+	})
+
+	for i, fn := range fns {
+		RegisterUpgrade(i+1, fn)
+	}
+}
+
+// renameLocale is an upgrade renaming the former locale field to language,
+// unless language is already set.
+func renameLocale(fields map[Field]json.RawMessage) error {
+	if locale, ok := fields["locale"]; ok {
+		if _, ok := fields[FieldLanguage]; !ok {
+			fields[FieldLanguage] = locale
+		}
+		delete(fields, "locale")
+	}
+	return nil
+}
+
+// expectPanic checks that fn panics with a message containing want.
+func expectPanic(t *testing.T, want string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if msg, _ := r.(string); !strings.Contains(msg, want) {
+			t.Errorf("panic = %v, want %q", r, want)
+		}
+	}()
+	fn()
+}
+
+func TestRegisterUpgrade(t *testing.T) {
+	setUpgrades(t)
+	expectPanic(t, "expected 1", func() { RegisterUpgrade(0, renameLocale) })
+	expectPanic(t, "expected 1", func() { RegisterUpgrade(2, renameLocale) })
+	expectPanic(t, "nil", func() { RegisterUpgrade(1, nil) })
+	if v := CurrentSchemaVersion(); v != 0 {
+		t.Fatalf("CurrentSchemaVersion() after rejected upgrades = %d, want 0", v)
+	}
+
+	RegisterUpgrade(1, renameLocale)
+	expectPanic(t, "expected 2", func() { RegisterUpgrade(1, renameLocale) })
+	RegisterUpgrade(2, renameLocale)
+	if v := CurrentSchemaVersion(); v != 2 {
+		t.Errorf("CurrentSchemaVersion() = %d, want 2", v)
+	}
+}
+
+func TestUpgradeFields(t *testing.T) {
+	var applied []int
+	record := func(version int) Upgrade {
+		return func(map[Field]json.RawMessage) error {
+			applied = append(applied, version)
+			return nil
+		}
+	}
+	setUpgrades(t, renameLocale, record(2), record(3))
+
+	tests := []struct {
+		stored  string // Stored schema version, if any
+		applied []int
+	}{
+		{"", []int{2, 3}},
+		{"1", []int{2, 3}},
+		{"2", []int{3}},
+		{"3", nil},
+		{"4", nil}, // Stored by a later version
+	}
+	for _, tt := range tests {
+		applied = nil
+		fields := map[Field]json.RawMessage{"locale": json.RawMessage(`"fr"`)}
+		if tt.stored != "" {
+			fields[FieldSchemaVersion] = json.RawMessage(tt.stored)
+		}
+		if err := UpgradeFields(fields); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(applied, tt.applied) {
+			t.Errorf("schema version %q: upgrades %v applied, want %v", tt.stored, applied, tt.applied)
+		}
+		if got := string(fields[FieldSchemaVersion]); got != tt.stored {
+			t.Errorf("schema version %q: upgraded to %q, want it as stored", tt.stored, got)
+		}
+		// Only sessions stored before version 1 are renamed
+		_, renamed := fields[FieldLanguage]
+		if want := tt.stored == ""; renamed != want {
+			t.Errorf("schema version %q: fields = %v, want locale renamed %v", tt.stored, slices.Collect(maps.Keys(fields)), want)
+		}
+	}
+
+	// An upgrade leaves fields written in the new format as they are
+	fields := map[Field]json.RawMessage{"locale": json.RawMessage(`"fr"`), FieldLanguage: json.RawMessage(`"de"`)}
+	if err := UpgradeFields(fields); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fields[FieldLanguage]); got != `"de"` {
+		t.Errorf("language after upgrade = %s, want \"de\"", got)
+	}
+}
+
+func TestUpgradeFieldsErrors(t *testing.T) {
+	errUpgrade := errors.New("upgrade failed")
+	setUpgrades(t, renameLocale, func(map[Field]json.RawMessage) error { return errUpgrade })
+
+	err := UpgradeFields(map[Field]json.RawMessage{})
+	if !errors.Is(err, errUpgrade) || !strings.Contains(err.Error(), "schema version 2") {
+		t.Errorf("UpgradeFields() = %v, want the upgrade to version 2 failed", err)
+	}
+	if err := UpgradeFields(map[Field]json.RawMessage{FieldSchemaVersion: json.RawMessage(`"1"`)}); err == nil {
+		t.Error("UpgradeFields() with invalid schema version succeeded")
+	}
+}
+
+// scanStore is a Store and Scanner of sessions in a map. Update stamps the
+// current schema version, as drivers do.
+type scanStore struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionData
+	vanish   map[string]bool // Sessions deleted as the scan reaches them
+	rewrite  map[string]bool // Sessions rewritten as the next scan reaches them
+	updates  int
+}
+
+func newScanStore(sessions ...*SessionData) *scanStore {
+	s := &scanStore{sessions: make(map[string]*SessionData), vanish: make(map[string]bool), rewrite: make(map[string]bool)}
+	for _, data := range sessions {
+		s.sessions[data.ID] = data
+	}
+	return s
+}
+
+func (s *scanStore) Create(ctx context.Context, data *SessionData) error {
+	return ErrAlreadyExists
+}
+
+func (s *scanStore) Get(ctx context.Context, id string) (*SessionData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	stored := *data
+	return &stored, nil
+}
+
+func (s *scanStore) Update(ctx context.Context, data *SessionData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.sessions[data.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if data.Version != stored.Version {
+		return ErrVersionConflict
+	}
+	s.updates++
+	data.Version++
+	data.SchemaVersion = CurrentSchemaVersion()
+	updated := *data
+	s.sessions[data.ID] = &updated
+	return nil
+}
+
+func (s *scanStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+func (s *scanStore) Close() error { return nil }
+
+func (s *scanStore) Scan(ctx context.Context, fn func(*SessionData) error) error {
+	s.mu.Lock()
+	ids := slices.Sorted(maps.Keys(s.sessions))
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		data, _ := s.Get(ctx, id)
+		if s.vanish[id] {
+			s.Delete(ctx, id)
+		}
+		if s.rewrite[id] {
+			delete(s.rewrite, id)
+			latest := *data
+			s.Update(ctx, &latest)
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMigrateAll(t *testing.T) {
+	setUpgrades(t, renameLocale)
+	ctx := context.Background()
+	store := newScanStore(
+		&SessionData{ID: "old1", Version: 3},
+		&SessionData{ID: "old2", Version: 1},
+		&SessionData{ID: "current", Version: 2, SchemaVersion: 1},
+		&SessionData{ID: "deleted", Version: 1},
+		&SessionData{ID: "rewritten", Version: 1},
+	)
+	// Sessions deleted or rewritten by others once scanned are skipped
+	store.vanish["deleted"] = true
+	store.rewrite["rewritten"] = true
+
+	migrated, err := MigrateAll(ctx, store, noBackoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 2 || store.updates != 3 {
+		t.Errorf("MigrateAll() = %d with %d updates, want 2 and 3 with the concurrent one", migrated, store.updates)
+	}
+	for id, version := range map[string]int64{"old1": 4, "old2": 2, "current": 2, "rewritten": 2} {
+		data, _ := store.Get(ctx, id)
+		if data.Version != version || data.SchemaVersion != 1 {
+			t.Errorf("%s at version %d, schema version %d, want %d, 1", id, data.Version, data.SchemaVersion, version)
+		}
+	}
+
+	// Once migrated, nothing is rewritten
+	if migrated, err := MigrateAll(ctx, store, noBackoff); err != nil || migrated != 0 {
+		t.Errorf("second MigrateAll() = %d, %v, want 0", migrated, err)
+	}
+	if store.updates != 3 {
+		t.Errorf("second MigrateAll() made %d updates", store.updates-3)
+	}
+
+	if _, err := MigrateAll(ctx, newConflictStore(0)); !errors.Is(err, ErrScanUnsupported) {
+		t.Errorf("MigrateAll() of store without Scan = %v, want ErrScanUnsupported", err)
+	}
+}
@@ -0,0 +1,978 @@
+// Package sessiontest provides a conformance suite for session.Store
+// implementations.
+//
+// Driver tests call RunStoreTests with a constructor for a fresh store:
+//
+//	func TestStore(t *testing.T) {
+//		sessiontest.RunStoreTests(t, func(t *testing.T) session.Store {
+//			return drivers.NewInMemoryStore()
+//		})
+//	}
+//
+// The suite uses unique session IDs per test, so stores backed by a shared
+// server (such as a Redis database) need no cleanup between tests.
+package sessiontest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/session"
+)
+
+// NewStoreFunc creates a fresh store for a single test.
+// The suite closes the store when the test ends.
+type NewStoreFunc func(t *testing.T) session.Store
+
+// RunStoreTests runs the conformance suite against stores created by newStore.
+// Every driver must pass it, so that drivers are interchangeable: reads and
+// writes are isolated from caller memory, data round-trips as it would
+// through JSON, and versioning follows the Store contract.
+// Stores implementing session.Notifier must be configured to emit events.
+// Stores not implementing the optional session.Patcher, session.Appender,
+// session.Toucher and session.Lister interfaces are tested through the
+// fallbacks of session.Patch, session.AppendMessages, session.Touch and
+// session.List; the List tests are skipped for stores that cannot list.
+func RunStoreTests(t *testing.T, newStore NewStoreFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store session.Store)
+	}{
+		{"CreateSetsVersion", testCreateSetsVersion},
+		{"CreateAlreadyExists", testCreateAlreadyExists},
+		{"CreateOrGet", testCreateOrGet},
+		{"GetNotFound", testGetNotFound},
+		{"RoundTrip", testRoundTrip},
+		{"GetReturnsCopy", testGetReturnsCopy},
+		{"CreateStoresCopy", testCreateStoresCopy},
+		{"UpdateStoresCopy", testUpdateStoresCopy},
+		{"UpdateIncrementsVersion", testUpdateIncrementsVersion},
+		{"UpdateVersionConflict", testUpdateVersionConflict},
+		{"UpdateNotFound", testUpdateNotFound},
+		{"Patch", testPatch},
+		{"PatchZeroValues", testPatchZeroValues},
+		{"PatchVersionConflict", testPatchVersionConflict},
+		{"PatchHistory", testPatchHistory},
+		{"PatchInvalidField", testPatchInvalidField},
+		{"PatchNotFound", testPatchNotFound},
+		{"AppendMessages", testAppendMessages},
+		{"AppendMessagesNotFound", testAppendMessagesNotFound},
+		{"AppendMessagesConflict", testAppendMessagesConflict},
+		{"IdleTTL", testIdleTTL},
+		{"MaxLifetime", testMaxLifetime},
+		{"Touch", testTouch},
+		{"TouchNotFound", testTouchNotFound},
+		{"List", testList},
+		{"ListInvalid", testListInvalid},
+		{"ListReindex", testListReindex},
+		{"Scan", testScan},
+		{"Delete", testDelete},
+		{"Mutate", testMutate},
+		{"Extensions", testExtensions},
+		{"Events", testEvents},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() {
+				if err := store.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+			})
+			tt.fn(t, store)
+		})
+	}
+}
+
+var idCounter atomic.Int64
+
+// newID returns a session ID unique to this process and test.
+func newID(t *testing.T) string {
+	return fmt.Sprintf("sessiontest:%s:%d:%d", t.Name(), time.Now().UnixNano(), idCounter.Add(1))
+}
+
+// create stores a new session with the given ID, failing the test on error.
+func create(t *testing.T, store session.Store, data *session.SessionData) *session.SessionData {
+	t.Helper()
+	if err := store.Create(context.Background(), data); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return data
+}
+
+// mustGet reads a session that must exist.
+func mustGet(t *testing.T, store session.Store, id string) *session.SessionData {
+	t.Helper()
+	data, err := store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if data == nil {
+		t.Fatalf("Get() = nil, want session %s", id)
+	}
+	return data
+}
+
+func testCreateSetsVersion(t *testing.T, store session.Store) {
+	before := time.Now()
+	data := create(t, store, &session.SessionData{ID: newID(t), Version: 42})
+
+	if data.Version != 1 {
+		t.Errorf("Create() Version = %d, want 1", data.Version)
+	}
+	if data.CreatedAt.Before(before) || !data.UpdatedAt.Equal(data.CreatedAt) {
+		t.Errorf("Create() CreatedAt = %v, UpdatedAt = %v", data.CreatedAt, data.UpdatedAt)
+	}
+
+	got := mustGet(t, store, data.ID)
+	if got.Version != 1 {
+		t.Errorf("Get() Version = %d, want 1", got.Version)
+	}
+	if !got.CreatedAt.Equal(data.CreatedAt) {
+		t.Errorf("Get() CreatedAt = %v, want %v", got.CreatedAt, data.CreatedAt)
+	}
+}
+
+func testCreateAlreadyExists(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t), Language: "en"})
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+
+	duplicate := &session.SessionData{ID: data.ID, Language: "de"}
+	if err := store.Create(ctx, duplicate); !errors.Is(err, session.ErrAlreadyExists) {
+		t.Fatalf("Create() of existing session error = %v, want ErrAlreadyExists", err)
+	}
+	if duplicate.Version != 0 || !duplicate.CreatedAt.IsZero() {
+		t.Errorf("Create() modified data of a rejected session: %+v", duplicate)
+	}
+
+	got := mustGet(t, store, data.ID)
+	if got.Language != "en" || contents(got.ConversationHistory) != "hello" {
+		t.Errorf("Get() after rejected Create() = %+v", got)
+	}
+}
+
+func testCreateOrGet(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	id := newID(t)
+
+	first, created, err := session.CreateOrGet(ctx, store, &session.SessionData{ID: id, Language: "en"})
+	if err != nil || !created {
+		t.Fatalf("CreateOrGet() = %v, %v, want created", created, err)
+	}
+
+	second, created, err := session.CreateOrGet(ctx, store, &session.SessionData{ID: id, Language: "de"})
+	if err != nil || created {
+		t.Fatalf("CreateOrGet() of existing session = %v, %v, want not created", created, err)
+	}
+	if second.Language != "en" || !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("CreateOrGet() of existing session = %+v, want the original", second)
+	}
+}
+
+func testGetNotFound(t *testing.T, store session.Store) {
+	got, err := store.Get(context.Background(), newID(t))
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got != nil {
+		t.Errorf("Get() = %+v, want nil", got)
+	}
+}
+
+func testRoundTrip(t *testing.T, store session.Store) {
+	data := create(t, store, &session.SessionData{
+		ID:                  newID(t),
+		ConversationHistory: []session.Message{session.NewMessage("user", "hello")},
+		SystemPrompt:        "be brief",
+		Keyterms:            []string{},
+		Language:            "en",
+		TTSEnabled:          true,
+		RateLimits:          map[string]any{"rpm": 60},
+		Config:              map[string]any{"nested": map[string]any{"ok": true}},
+	})
+
+	got := mustGet(t, store, data.ID)
+	if len(got.ConversationHistory) != 1 || got.ConversationHistory[0].Content != "hello" {
+		t.Errorf("Get() ConversationHistory = %+v", got.ConversationHistory)
+	}
+	if got.SystemPrompt != "be brief" || got.Language != "en" || !got.TTSEnabled {
+		t.Errorf("Get() = %+v", got)
+	}
+	if got.Keyterms == nil || len(got.Keyterms) != 0 {
+		t.Errorf("Get() Keyterms = %#v, want empty non-nil slice", got.Keyterms)
+	}
+	if got.AllowedOrigins != nil {
+		t.Errorf("Get() AllowedOrigins = %#v, want nil", got.AllowedOrigins)
+	}
+	// Values come back as JSON would decode them
+	if rpm, ok := got.RateLimits["rpm"].(float64); !ok || rpm != 60 {
+		t.Errorf("Get() RateLimits[rpm] = %#v, want float64(60)", got.RateLimits["rpm"])
+	}
+	if nested, ok := got.Config["nested"].(map[string]any); !ok || nested["ok"] != true {
+		t.Errorf("Get() Config[nested] = %#v", got.Config["nested"])
+	}
+}
+
+func testGetReturnsCopy(t *testing.T, store session.Store) {
+	data := create(t, store, &session.SessionData{
+		ID:                  newID(t),
+		ConversationHistory: []session.Message{session.NewMessage("user", "hello")},
+		Config:              map[string]any{"key": "value"},
+	})
+
+	got := mustGet(t, store, data.ID)
+	got.Language = "changed"
+	got.Version = 99
+	got.ConversationHistory[0].Content = "changed"
+	got.Config["key"] = "changed"
+
+	again := mustGet(t, store, data.ID)
+	if again.Language != "" || again.Version != 1 {
+		t.Errorf("Get() after mutating a previous result = %+v", again)
+	}
+	if again.ConversationHistory[0].Content != "hello" || again.Config["key"] != "value" {
+		t.Errorf("Get() shares memory with a previous result: %+v", again)
+	}
+}
+
+func testCreateStoresCopy(t *testing.T, store session.Store) {
+	data := create(t, store, &session.SessionData{
+		ID:       newID(t),
+		Keyterms: []string{"alpha"},
+	})
+
+	data.Language = "changed"
+	data.Version = 99
+	data.Keyterms[0] = "changed"
+
+	got := mustGet(t, store, data.ID)
+	if got.Language != "" || got.Version != 1 || got.Keyterms[0] != "alpha" {
+		t.Errorf("Get() after mutating the created data = %+v", got)
+	}
+}
+
+func testUpdateStoresCopy(t *testing.T, store session.Store) {
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	data.Keyterms = []string{"alpha"}
+	if err := store.Update(context.Background(), data); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	data.Keyterms[0] = "changed"
+
+	got := mustGet(t, store, data.ID)
+	if got.Keyterms[0] != "alpha" {
+		t.Errorf("Get() Keyterms after mutating the updated data = %v", got.Keyterms)
+	}
+}
+
+func testUpdateIncrementsVersion(t *testing.T, store session.Store) {
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	got := mustGet(t, store, data.ID)
+	got.Language = "de"
+	if err := store.Update(context.Background(), got); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got.Version != 2 {
+		t.Errorf("Update() Version = %d, want 2", got.Version)
+	}
+	if got.UpdatedAt.Before(data.UpdatedAt) {
+		t.Errorf("Update() UpdatedAt = %v, before %v", got.UpdatedAt, data.UpdatedAt)
+	}
+
+	again := mustGet(t, store, data.ID)
+	if again.Version != 2 || again.Language != "de" {
+		t.Errorf("Get() after Update() = %+v", again)
+	}
+}
+
+func testUpdateVersionConflict(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	first := mustGet(t, store, data.ID)
+	second := mustGet(t, store, data.ID)
+	if err := store.Update(ctx, first); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	second.Language = "stale"
+	if err := store.Update(ctx, second); !errors.Is(err, session.ErrVersionConflict) {
+		t.Fatalf("Update() with stale version error = %v, want ErrVersionConflict", err)
+	}
+	if got := mustGet(t, store, data.ID); got.Language != "" || got.Version != 2 {
+		t.Errorf("Get() after conflicting Update() = %+v", got)
+	}
+}
+
+func testUpdateNotFound(t *testing.T, store session.Store) {
+	err := store.Update(context.Background(), &session.SessionData{ID: newID(t), Version: 1})
+	if !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("Update() of missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+func testPatch(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{
+		ID:           newID(t),
+		SystemPrompt: "be brief",
+		Language:     "en",
+		Config:       map[string]any{"voice": "alloy"},
+	})
+
+	read := mustGet(t, store, data.ID)
+
+	// A concurrent append does not conflict with a settings patch, unless
+	// it increments Version
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+	if !appendsNatively(store) {
+		read = mustGet(t, store, data.ID)
+	}
+	wantVersion := read.Version + 1
+
+	read.Language = "de"
+	read.TTSEnabled = true
+	read.SystemPrompt = "not patched"
+	if err := session.Patch(ctx, store, read, session.FieldLanguage, session.FieldTTSEnabled); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if read.Version != wantVersion {
+		t.Errorf("Patch() Version = %d, want %d", read.Version, wantVersion)
+	}
+
+	got := mustGet(t, store, data.ID)
+	if got.Version != wantVersion || got.Language != "de" || !got.TTSEnabled {
+		t.Errorf("Get() after Patch() = %+v", got)
+	}
+	if got.SystemPrompt != "be brief" || got.Config["voice"] != "alloy" {
+		t.Errorf("Patch() changed fields it was not given: %+v", got)
+	}
+	if contents(got.ConversationHistory) != "hello" {
+		t.Errorf("Get() ConversationHistory after Patch() = %s, want hello", contents(got.ConversationHistory))
+	}
+	// Only a store patching natively leaves the history, and so the
+	// appended messages, as stored
+	if _, ok := store.(session.Patcher); ok && got.AppendedMessages != 1 {
+		t.Errorf("Get() AppendedMessages after Patch() = %d, want 1", got.AppendedMessages)
+	}
+	if got.UpdatedAt.Before(data.UpdatedAt) {
+		t.Errorf("Get() UpdatedAt after Patch() = %v, before %v", got.UpdatedAt, data.UpdatedAt)
+	}
+}
+
+func testPatchZeroValues(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{
+		ID:       newID(t),
+		Keyterms: []string{"alpha"},
+		IdleTTL:  time.Hour,
+		Config:   map[string]any{"key": "value"},
+	})
+
+	data.Keyterms = nil
+	data.IdleTTL = 0
+	data.Config = nil
+	if err := session.Patch(ctx, store, data, session.FieldKeyterms, session.FieldIdleTTL, session.FieldConfig); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+
+	got := mustGet(t, store, data.ID)
+	if got.Keyterms != nil || got.IdleTTL != 0 || got.Config != nil {
+		t.Errorf("Get() after patching zero values = %+v", got)
+	}
+}
+
+func testPatchVersionConflict(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	stale := mustGet(t, store, data.ID)
+	if err := session.Patch(ctx, store, data, session.FieldLanguage); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+
+	stale.Language = "stale"
+	if err := session.Patch(ctx, store, stale, session.FieldLanguage); !errors.Is(err, session.ErrVersionConflict) {
+		t.Fatalf("Patch() with stale version error = %v, want ErrVersionConflict", err)
+	}
+	if stale.Version != 1 {
+		t.Errorf("Patch() modified Version on conflict: %d", stale.Version)
+	}
+}
+
+func testPatchHistory(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{
+		ID:                  newID(t),
+		ConversationHistory: []session.Message{session.NewMessage("user", "one")},
+		Language:            "en",
+	})
+
+	stale := mustGet(t, store, data.ID)
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("assistant", "two")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+
+	// Replacing the history based on a read before the append conflicts
+	stale.ConversationHistory = nil
+	if err := session.Patch(ctx, store, stale, session.FieldConversationHistory); !errors.Is(err, session.ErrVersionConflict) {
+		t.Fatalf("Patch() of history after AppendMessages() error = %v, want ErrVersionConflict", err)
+	}
+
+	got := mustGet(t, store, data.ID)
+	got.ConversationHistory = session.TruncateHistory(got.ConversationHistory, 1000, 1)
+	got.Language = "not patched"
+	if err := session.Patch(ctx, store, got, session.FieldConversationHistory); err != nil {
+		t.Fatalf("Patch() of history error = %v", err)
+	}
+	if got.AppendedMessages != 0 {
+		t.Errorf("Patch() of history AppendedMessages = %d, want 0", got.AppendedMessages)
+	}
+
+	again := mustGet(t, store, data.ID)
+	if contents(again.ConversationHistory) != "two" || again.AppendedMessages != 0 || again.Language != "en" {
+		t.Errorf("Get() after patching history = %+v", again)
+	}
+}
+
+func testPatchInvalidField(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	for _, fields := range [][]session.Field{nil, {session.FieldVersion}, {session.FieldTenantID}, {session.FieldLanguage, "unknown"}} {
+		if err := session.Patch(ctx, store, data, fields...); !errors.Is(err, session.ErrInvalidField) {
+			t.Errorf("Patch(%v) error = %v, want ErrInvalidField", fields, err)
+		}
+	}
+}
+
+func testPatchNotFound(t *testing.T, store session.Store) {
+	err := session.Patch(context.Background(), store, &session.SessionData{ID: newID(t), Version: 1}, session.FieldLanguage)
+	if !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("Patch() of missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+func testAppendMessages(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{
+		ID:                  newID(t),
+		ConversationHistory: []session.Message{session.NewMessage("user", "one")},
+	})
+
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("assistant", "two"), session.NewMessage("user", "three")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+	if err := session.AppendMessages(ctx, store, data.ID); err != nil {
+		t.Fatalf("AppendMessages() with no messages error = %v", err)
+	}
+
+	got := mustGet(t, store, data.ID)
+	if wantVersion := appendedVersion(store, 1, 1); got.Version != wantVersion {
+		t.Errorf("Get() Version after AppendMessages() = %d, want %d", got.Version, wantVersion)
+	}
+	if contents := contents(got.ConversationHistory); contents != "one,two,three" {
+		t.Errorf("Get() ConversationHistory = %s, want one,two,three", contents)
+	}
+
+	// Update folds the appended messages into the stored history
+	got.ConversationHistory = session.AddMessageToHistory(got.ConversationHistory, "assistant", "four")
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	again := mustGet(t, store, data.ID)
+	if contents := contents(again.ConversationHistory); contents != "one,two,three,four" {
+		t.Errorf("Get() ConversationHistory after Update() = %s, want one,two,three,four", contents)
+	}
+	if again.AppendedMessages != 0 {
+		t.Errorf("Get() AppendedMessages after Update() = %d, want 0", again.AppendedMessages)
+	}
+}
+
+func testAppendMessagesNotFound(t *testing.T, store session.Store) {
+	err := session.AppendMessages(context.Background(), store, newID(t), session.NewMessage("user", "hello"))
+	if !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("AppendMessages() to missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+func testAppendMessagesConflict(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	stale := mustGet(t, store, data.ID)
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+
+	stale.Language = "de"
+	if err := store.Update(ctx, stale); !errors.Is(err, session.ErrVersionConflict) {
+		t.Fatalf("Update() after AppendMessages() error = %v, want ErrVersionConflict", err)
+	}
+	if got := mustGet(t, store, data.ID); contents(got.ConversationHistory) != "hello" {
+		t.Errorf("Get() ConversationHistory = %s, want hello", contents(got.ConversationHistory))
+	}
+}
+
+// appendsNatively reports whether the store appends messages without
+// incrementing Version, as stores implementing session.Appender do.
+func appendsNatively(store session.Store) bool {
+	_, ok := store.(session.Appender)
+	return ok
+}
+
+// appendedVersion returns the version of a session at version after
+// appending to it the given number of times.
+func appendedVersion(store session.Store, version int64, appends int) int64 {
+	if appendsNatively(store) {
+		return version
+	}
+	return version + int64(appends)
+}
+
+// assertExpiresAt checks an expiry to millisecond precision, the
+// resolution of Redis key expiry.
+func assertExpiresAt(t *testing.T, op string, got, earliest, latest time.Time) {
+	t.Helper()
+	if got.Before(earliest.Truncate(time.Millisecond)) || got.After(latest) {
+		t.Errorf("%s ExpiresAt = %v, want between %v and %v", op, got, earliest, latest)
+	}
+}
+
+func testIdleTTL(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	before := time.Now()
+	data := create(t, store, &session.SessionData{ID: newID(t), IdleTTL: 30 * time.Minute})
+	assertExpiresAt(t, "Create()", data.ExpiresAt, before.Add(30*time.Minute), time.Now().Add(30*time.Minute))
+
+	before = time.Now()
+	got := mustGet(t, store, data.ID)
+	assertExpiresAt(t, "Get()", got.ExpiresAt, before.Add(30*time.Minute), time.Now().Add(30*time.Minute))
+
+	// Changing the TTL takes effect on Update
+	got.IdleTTL = 7 * 24 * time.Hour
+	before = time.Now()
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	assertExpiresAt(t, "Update()", got.ExpiresAt, before.Add(7*24*time.Hour), time.Now().Add(7*24*time.Hour))
+
+	again := mustGet(t, store, data.ID)
+	if again.IdleTTL != 7*24*time.Hour {
+		t.Errorf("Get() IdleTTL = %v, want %v", again.IdleTTL, 7*24*time.Hour)
+	}
+}
+
+func testMaxLifetime(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{
+		ID:          newID(t),
+		IdleTTL:     time.Hour,
+		MaxLifetime: 10 * time.Minute,
+	})
+	deadline := data.CreatedAt.Add(10 * time.Minute)
+	assertExpiresAt(t, "Create()", data.ExpiresAt, deadline, deadline)
+
+	// Activity does not extend the session past its deadline
+	if err := session.Touch(ctx, store, data.ID); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	got := mustGet(t, store, data.ID)
+	assertExpiresAt(t, "Get()", got.ExpiresAt, deadline, deadline)
+}
+
+func testTouch(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t), IdleTTL: time.Hour})
+
+	time.Sleep(5 * time.Millisecond)
+	before := time.Now()
+	if err := session.Touch(ctx, store, data.ID); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+
+	got := mustGet(t, store, data.ID)
+	assertExpiresAt(t, "Get() after Touch()", got.ExpiresAt, before.Add(time.Hour), time.Now().Add(time.Hour))
+	if !got.ExpiresAt.After(data.ExpiresAt) {
+		t.Errorf("Touch() did not extend ExpiresAt: %v, created with %v", got.ExpiresAt, data.ExpiresAt)
+	}
+	if got.Version != 1 || !got.UpdatedAt.Equal(data.UpdatedAt) {
+		t.Errorf("Touch() modified the session: %+v", got)
+	}
+}
+
+func testTouchNotFound(t *testing.T, store session.Store) {
+	if err := session.Touch(context.Background(), store, newID(t)); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("Touch() of missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+// skipUnlisted skips a test of a store session.List cannot list.
+func skipUnlisted(t *testing.T, store session.Store) {
+	t.Helper()
+	_, lists := store.(session.Lister)
+	_, scans := store.(session.Scanner)
+	if !lists && !scans {
+		t.Skip("store implements neither session.Lister nor session.Scanner")
+	}
+}
+
+// listIDs reads every page of List, failing the test on error, and returns
+// the IDs listed.
+func listIDs(t *testing.T, store session.Store, filter session.ListFilter) []string {
+	t.Helper()
+	var ids []string
+	cursor := ""
+	for range 100 {
+		page, next, err := session.List(context.Background(), store, filter, cursor)
+		if err != nil {
+			t.Fatalf("List(%+v) error = %v", filter, err)
+		}
+		if filter.Limit > 0 && len(page) > filter.Limit {
+			t.Errorf("List(%+v) returned %d sessions", filter, len(page))
+		}
+		for _, data := range page {
+			ids = append(ids, data.ID)
+		}
+		if next == "" {
+			return ids
+		}
+		cursor = next
+	}
+	t.Fatalf("List(%+v) did not reach the last page", filter)
+	return nil
+}
+
+func testList(t *testing.T, store session.Store) {
+	skipUnlisted(t, store)
+	ctx := context.Background()
+	tenant := newID(t)
+
+	var all []*session.SessionData
+	for i := range 5 {
+		all = append(all, create(t, store, &session.SessionData{
+			ID:          newID(t),
+			TenantID:    tenant,
+			AssistantID: fmt.Sprintf("%s:assistant:%d", tenant, i%2),
+			UserID:      fmt.Sprintf("%s:user:%d", tenant, i),
+			Language:    "en",
+		}))
+	}
+	create(t, store, &session.SessionData{ID: newID(t), TenantID: newID(t)})
+	if err := session.AppendMessages(ctx, store, all[0].ID, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+
+	slices.SortFunc(all, func(a, b *session.SessionData) int {
+		if session.PositionOf(a).After(session.PositionOf(b)) {
+			return 1
+		}
+		return -1
+	})
+	want := func(keep func(i int, data *session.SessionData) bool) string {
+		var ids []string
+		for i, data := range all {
+			if keep(i, data) {
+				ids = append(ids, data.ID)
+			}
+		}
+		return strings.Join(ids, ",")
+	}
+
+	tests := []struct {
+		filter session.ListFilter
+		want   string
+	}{
+		{session.ListFilter{TenantID: tenant}, want(func(int, *session.SessionData) bool { return true })},
+		{session.ListFilter{TenantID: tenant, Limit: 2}, want(func(int, *session.SessionData) bool { return true })},
+		{session.ListFilter{TenantID: tenant, AssistantID: tenant + ":assistant:1", Limit: 1},
+			want(func(_ int, data *session.SessionData) bool { return data.AssistantID == tenant+":assistant:1" })},
+		{session.ListFilter{UserID: all[3].UserID}, all[3].ID},
+		{session.ListFilter{TenantID: newID(t)}, ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(listIDs(t, store, tt.filter), ","); got != tt.want {
+			t.Errorf("List(%+v) = %s, want %s", tt.filter, got, tt.want)
+		}
+	}
+
+	page, _, err := session.List(ctx, store, session.ListFilter{TenantID: tenant}, "")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	for _, data := range page {
+		wantVersion := int64(1)
+		if data.ID == all[0].ID {
+			wantVersion = appendedVersion(store, 1, 1)
+		}
+		if data.ConversationHistory != nil || data.Language != "en" || data.Version != wantVersion || data.ExpiresAt.IsZero() {
+			t.Errorf("List() session = %+v", data)
+		}
+	}
+}
+
+func testListInvalid(t *testing.T, store session.Store) {
+	skipUnlisted(t, store)
+	ctx := context.Background()
+	if _, _, err := session.List(ctx, store, session.ListFilter{Limit: 10}, ""); !errors.Is(err, session.ErrInvalidFilter) {
+		t.Errorf("List() without IDs error = %v, want ErrInvalidFilter", err)
+	}
+	if _, _, err := session.List(ctx, store, session.ListFilter{TenantID: newID(t)}, "not a cursor"); !errors.Is(err, session.ErrInvalidCursor) {
+		t.Errorf("List() with malformed cursor error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func testListReindex(t *testing.T, store session.Store) {
+	skipUnlisted(t, store)
+	ctx := context.Background()
+	before, after := newID(t), newID(t)
+	data := create(t, store, &session.SessionData{ID: newID(t), TenantID: before})
+
+	data.TenantID = after
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := listIDs(t, store, session.ListFilter{TenantID: before}); len(got) != 0 {
+		t.Errorf("List() of previous tenant = %v, want none", got)
+	}
+	if got := listIDs(t, store, session.ListFilter{TenantID: after}); len(got) != 1 || got[0] != data.ID {
+		t.Errorf("List() of new tenant = %v, want [%s]", got, data.ID)
+	}
+
+	if err := store.Delete(ctx, data.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got := listIDs(t, store, session.ListFilter{TenantID: after}); len(got) != 0 {
+		t.Errorf("List() after Delete() = %v, want none", got)
+	}
+}
+
+func testScan(t *testing.T, store session.Store) {
+	scanner, ok := store.(session.Scanner)
+	if !ok {
+		t.Skip("store does not implement session.Scanner")
+	}
+	ctx := context.Background()
+
+	want := make(map[string]bool)
+	for i := range 3 {
+		data := create(t, store, &session.SessionData{ID: newID(t), Language: "en"})
+		if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("user", "hello")); err != nil {
+			t.Fatalf("AppendMessages() error = %v", err)
+		}
+		want[data.ID] = i > 0
+		if i == 0 {
+			if err := store.Delete(ctx, data.ID); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+		}
+	}
+
+	// The store may hold sessions of other tests
+	err := scanner.Scan(ctx, func(data *session.SessionData) error {
+		live, ok := want[data.ID]
+		if !ok {
+			return nil
+		}
+		if !live {
+			t.Errorf("Scan() visited deleted session %s", data.ID)
+		}
+		if data.ConversationHistory != nil || data.Language != "en" || data.Version != appendedVersion(store, 1, 1) || data.ExpiresAt.IsZero() {
+			t.Errorf("Scan() session = %+v", data)
+		}
+		delete(want, data.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	for id, live := range want {
+		if live {
+			t.Errorf("Scan() did not visit session %s", id)
+		}
+	}
+
+	stop := errors.New("stop")
+	if err := scanner.Scan(ctx, func(*session.SessionData) error { return stop }); err != stop {
+		t.Errorf("Scan() error = %v, want the error returned by fn", err)
+	}
+}
+
+func testDelete(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+	if err := session.AppendMessages(ctx, store, data.ID, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+
+	if err := store.Delete(ctx, data.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got, err := store.Get(ctx, data.ID); err != nil || got != nil {
+		t.Errorf("Get() after Delete() = %+v, %v, want nil, nil", got, err)
+	}
+	if err := store.Delete(ctx, data.ID); err != nil {
+		t.Errorf("Delete() of missing session error = %v", err)
+	}
+
+	// A recreated session does not inherit appended messages
+	create(t, store, &session.SessionData{ID: data.ID})
+	if got := mustGet(t, store, data.ID); len(got.ConversationHistory) != 0 {
+		t.Errorf("Get() ConversationHistory of recreated session = %+v", got.ConversationHistory)
+	}
+}
+
+func testMutate(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := create(t, store, &session.SessionData{ID: newID(t)})
+
+	updated, err := session.Mutate(ctx, store, data.ID, func(d *session.SessionData) error {
+		d.Language = "fr"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Mutate() error = %v", err)
+	}
+	if updated.Version != 2 || updated.Language != "fr" {
+		t.Errorf("Mutate() = %+v", updated)
+	}
+
+	if _, err := session.Mutate(ctx, store, newID(t), func(*session.SessionData) error { return nil }); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("Mutate() of missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+// extensionState is the typed state of the extension tested by
+// testExtensions.
+type extensionState struct {
+	Count  int64             `json:"count"`
+	Labels map[string]string `json:"labels"`
+}
+
+var testExtension = session.NewExtension[extensionState]("sessiontest")
+
+func testExtensions(t *testing.T, store session.Store) {
+	ctx := context.Background()
+	data := &session.SessionData{ID: newID(t)}
+	if err := testExtension.Set(data, extensionState{Count: 41, Labels: map[string]string{"a": "b"}}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	create(t, store, data)
+
+	got, ok, err := testExtension.Get(mustGet(t, store, data.ID))
+	if err != nil || !ok || got.Count != 41 || got.Labels["a"] != "b" {
+		t.Errorf("Get() = %+v, %v, %v", got, ok, err)
+	}
+
+	// Patching the extensions leaves the rest of the session as stored
+	other := session.NewExtension[string]("sessiontest.other")
+	if err := other.Set(data, "value"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	data.Language = "fr"
+	if err := session.Patch(ctx, store, data, session.FieldExtensions); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	patched := mustGet(t, store, data.ID)
+	if v, ok, err := other.Get(patched); err != nil || !ok || v != "value" || patched.Language != "" {
+		t.Errorf("after Patch() Get() = %q, %v, %v with language %q", v, ok, err, patched.Language)
+	}
+
+	mutated, err := testExtension.Mutate(ctx, store, data.ID, func(state *extensionState) error {
+		state.Count++
+		return nil
+	})
+	if err != nil || mutated.Count != 42 {
+		t.Fatalf("Mutate() = %+v, %v", mutated, err)
+	}
+	if got, _, _ := testExtension.Get(mustGet(t, store, data.ID)); got.Count != 42 {
+		t.Errorf("after Mutate() Get() = %+v", got)
+	}
+
+	other.Delete(patched)
+	if _, ok, _ := other.Get(patched); ok {
+		t.Error("Get() after Delete() found the value")
+	}
+	if _, ok, err := session.NewExtension[int]("sessiontest.missing").Get(patched); ok || err != nil {
+		t.Errorf("Get() of empty slot = %v, %v", ok, err)
+	}
+}
+
+func testEvents(t *testing.T, store session.Store) {
+	notifier, ok := store.(session.Notifier)
+	if !ok {
+		t.Skip("store does not implement session.Notifier")
+	}
+	ctx := context.Background()
+	id := newID(t)
+
+	events := make(chan session.Event, 16)
+	unsubscribe := notifier.Subscribe(func(event session.Event) {
+		if event.ID == id {
+			events <- event
+		}
+	})
+	defer unsubscribe()
+
+	data := create(t, store, &session.SessionData{ID: id})
+	data.Language = "fr"
+	if err := store.Update(ctx, data); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := session.AppendMessages(ctx, store, id, session.NewMessage("user", "hello")); err != nil {
+		t.Fatalf("AppendMessages() error = %v", err)
+	}
+	if err := session.Touch(ctx, store, id); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+	for range 2 {
+		if err := store.Delete(ctx, id); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	want := []session.Event{
+		{Type: session.EventCreated, ID: id, Version: 1},
+		{Type: session.EventUpdated, ID: id, Version: 2},
+		{Type: session.EventUpdated, ID: id, Version: 2},
+		{Type: session.EventDeleted, ID: id, Version: 2},
+	}
+	for _, w := range want {
+		select {
+		case got := <-events:
+			if got.Type != w.Type || got.Version != w.Version || got.Time.IsZero() {
+				t.Errorf("event = %+v, want %s at version %d", got, w.Type, w.Version)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event received", w.Type)
+		}
+	}
+	select {
+	case got := <-events:
+		t.Errorf("unexpected event %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// contents joins message contents with commas, for compact comparisons.
+func contents(msgs []session.Message) string {
+	parts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		parts[i] = msg.Content
+	}
+	return strings.Join(parts, ",")
+}
@@ -1,6 +1,9 @@
 package session
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Message represents a single conversation turn.
 type Message struct {
@@ -16,15 +19,21 @@ type Message struct {
 //
 // PERSISTED TO REDIS:
 // - ID: unique session identifier
+// - TenantID, AssistantID, UserID: optional owners, indexed for listing
 // - CreatedAt, UpdatedAt: timestamps
 // - Version: for optimistic locking in distributed deployments
+// - SchemaVersion: the schema the session was stored with, for upgrades
 // - ConversationHistory: all user/assistant messages with token counts
 // - SystemPrompt: LLM system prompt (from tenant/assistant config)
 // - Keyterms: STT keyterm prompting terms (from tenant config)
 // - Language, TTSEnabled: feature flags (from tenant/assistant config)
 // - AllowedOrigins, RateLimits, Config: tenant settings
+// - Extensions: typed state attached by services (see Extension)
 type SessionData struct {
 	ID                  string         `json:"id"`
+	TenantID            string         `json:"tenant_id,omitempty"`    // Tenant, for listing (see Store.List)
+	AssistantID         string         `json:"assistant_id,omitempty"` // Assistant, for listing
+	UserID              string         `json:"user_id,omitempty"`      // End user, for listing
 	CreatedAt           time.Time      `json:"created_at"`
 	UpdatedAt           time.Time      `json:"updated_at"`
 	Version             int64          `json:"version"` // Monotonically increasing for optimistic locking
@@ -36,4 +45,33 @@ type SessionData struct {
 	AllowedOrigins      []string       `json:"allowed_origins"`      // CORS allowed origins (from tenant)
 	RateLimits          map[string]any `json:"rate_limits"`          // Rate limiting config (from tenant)
 	Config              map[string]any `json:"config"`               // Additional tenant config
+
+	// Extensions holds the JSON state services attach to the session, by
+	// name. Access it through an Extension, which decodes it into its type.
+	Extensions map[string]json.RawMessage `json:"extensions,omitempty"`
+
+	// SchemaVersion is the schema version the session was stored with (see
+	// RegisterUpgrade). Stores upgrade older sessions as they read them,
+	// leaving SchemaVersion as stored, and stamp CurrentSchemaVersion on
+	// the sessions they write in full: Patch leaves it as stored on drivers
+	// that only write the patched fields.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// IdleTTL is how long the session lives without activity; every Get,
+	// Update, AppendMessages or Touch extends it. Zero uses the store default.
+	IdleTTL time.Duration `json:"idle_ttl,omitempty"`
+
+	// MaxLifetime caps the session's lifetime from CreatedAt, regardless of
+	// activity. Zero uses the store default, which is unlimited unless set.
+	MaxLifetime time.Duration `json:"max_lifetime,omitempty"`
+
+	// ExpiresAt is when the session will expire unless accessed again.
+	// It is computed by the store on every read and write.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// AppendedMessages is the number of messages at the end of
+	// ConversationHistory that were added with AppendMessages since the
+	// last Update. Stores set it in Get and check it in Update to detect
+	// messages appended after the read; it is not persisted.
+	AppendedMessages int `json:"-"`
 }
@@ -0,0 +1,94 @@
+package supabase
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Table holding archived sessions (see session_archives.sql)
+const sessionArchivesTable = "session_archives"
+
+// SessionArchive persists snapshots of chat sessions
+type SessionArchive interface {
+	// ArchiveSession stores a snapshot of a session. Writes are idempotent:
+	// snapshots are keyed by session ID and version, storing the same
+	// version again replaces it, and older versions are removed.
+	ArchiveSession(ctx context.Context, session *ArchivedSession) error
+
+	// EndArchivedSession records why and when a session ended, unless an
+	// end was already recorded. Nothing is recorded for a session that was
+	// never archived, and no error is returned.
+	EndArchivedSession(ctx context.Context, sessionID, reason string, at time.Time) error
+}
+
+// ArchivedSession represents an archived chat session, with its transcript
+type ArchivedSession struct {
+	SessionID    string            `json:"session_id"`
+	Version      int64             `json:"version"`
+	TenantID     string            `json:"tenant_id,omitempty"`
+	AssistantID  string            `json:"assistant_id,omitempty"`
+	UserID       string            `json:"user_id,omitempty"`
+	Language     string            `json:"language"`
+	SystemPrompt string            `json:"system_prompt"`
+	Config       map[string]any    `json:"config"`
+	Messages     []ArchivedMessage `json:"messages"`
+	MessageCount int               `json:"message_count"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	ArchivedAt   time.Time         `json:"archived_at"`
+	EndedAt      *time.Time        `json:"ended_at,omitempty"`
+	EndReason    string            `json:"end_reason,omitempty"`
+}
+
+// ArchivedMessage represents a message of an archived session
+type ArchivedMessage struct {
+	Role       string    `json:"role"`
+	Content    string    `json:"content"`
+	TokenCount int       `json:"token_count"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// ArchiveSession stores a snapshot of a session
+func (c *Client) ArchiveSession(ctx context.Context, session *ArchivedSession) error {
+	_, _, err := c.client.From(sessionArchivesTable).
+		Upsert(session, "session_id,version", "minimal", "").
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to archive session: %w", err)
+	}
+
+	// Keep only the latest snapshot
+	_, _, err = c.client.From(sessionArchivesTable).
+		Delete("minimal", "").
+		Eq("session_id", session.SessionID).
+		Lt("version", strconv.FormatInt(session.Version, 10)).
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to remove earlier session snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// EndArchivedSession records the end of an archived session. It updates no
+// rows if the session has no snapshot.
+func (c *Client) EndArchivedSession(ctx context.Context, sessionID, reason string, at time.Time) error {
+	_, _, err := c.client.From(sessionArchivesTable).
+		Update(map[string]any{"ended_at": at, "end_reason": reason}, "minimal", "").
+		Eq("session_id", sessionID).
+		Is("ended_at", "null").
+		Execute()
+
+	if err != nil {
+		return fmt.Errorf("failed to end archived session: %w", err)
+	}
+
+	return nil
+}
+
+// Compile-time check that Client implements SessionArchive
+var _ SessionArchive = (*Client)(nil)
@@ -35,6 +35,24 @@ type cacheEntry[T any] struct {
 	expiresAt time.Time
 }
 
+// CacheObserver is told whether each cache lookup of a request hit
+type CacheObserver func(hit bool)
+
+type cacheObserverKey struct{}
+
+// WithCacheObserver returns a context making the Client report the cache
+// lookups of requests made with it to observer
+func WithCacheObserver(ctx context.Context, observer CacheObserver) context.Context {
+	return context.WithValue(ctx, cacheObserverKey{}, observer)
+}
+
+// observeCache reports a cache lookup to the observer of ctx, if any
+func observeCache(ctx context.Context, hit bool) {
+	if observer, ok := ctx.Value(cacheObserverKey{}).(CacheObserver); ok && observer != nil {
+		observer(hit)
+	}
+}
+
 // New creates a new Supabase client
 func New(cfg Config) (*Client, error) {
 	if cfg.URL == "" {
@@ -66,7 +84,9 @@ func New(cfg Config) (*Client, error) {
 // GetAssistantByToken retrieves an assistant by its public token
 func (c *Client) GetAssistantByToken(ctx context.Context, publicToken string) (*Assistant, error) {
 	// Check cache first
-	if cached := c.getFromCacheByToken(publicToken); cached != nil {
+	cached := c.getFromCacheByToken(publicToken)
+	observeCache(ctx, cached != nil)
+	if cached != nil {
 		return cached, nil
 	}
 
@@ -96,7 +116,9 @@ func (c *Client) GetAssistantByToken(ctx context.Context, publicToken string) (*
 // GetTenant retrieves a tenant by ID
 func (c *Client) GetTenant(ctx context.Context, tenantID string) (*Tenant, error) {
 	// Check cache first
-	if cached, ok := c.getFromCacheByID(tenantID).(*Tenant); ok && cached != nil {
+	cached, ok := c.getFromCacheByID(tenantID).(*Tenant)
+	observeCache(ctx, ok && cached != nil)
+	if ok && cached != nil {
 		return cached, nil
 	}
 
@@ -120,7 +142,9 @@ func (c *Client) GetTenant(ctx context.Context, tenantID string) (*Tenant, error
 // GetSource retrieves a source by ID
 func (c *Client) GetSource(ctx context.Context, sourceID string) (*Source, error) {
 	// Check cache first
-	if cached, ok := c.getFromCacheByID(sourceID).(*Source); ok && cached != nil {
+	cached, ok := c.getFromCacheByID(sourceID).(*Source)
+	observeCache(ctx, ok && cached != nil)
+	if ok && cached != nil {
 		return cached, nil
 	}
 
@@ -165,7 +189,9 @@ func (c *Client) GetSourcesByAssistantID(ctx context.Context, assistantID string
 // GetDocument retrieves a document by ID
 func (c *Client) GetDocument(ctx context.Context, documentID string) (*Document, error) {
 	// Check cache first
-	if cached, ok := c.getFromCacheByID(documentID).(*Document); ok && cached != nil {
+	cached, ok := c.getFromCacheByID(documentID).(*Document)
+	observeCache(ctx, ok && cached != nil)
+	if ok && cached != nil {
 		return cached, nil
 	}
 
@@ -0,0 +1,24 @@
+-- Archived chat sessions, written by Client.ArchiveSession.
+-- Each session keeps its latest snapshot; the primary key makes writes of
+-- the same session version idempotent.
+create table if not exists session_archives (
+    session_id    text        not null,
+    version       bigint      not null,
+    tenant_id     text,
+    assistant_id  text,
+    user_id       text,
+    language      text        not null default '',
+    system_prompt text        not null default '',
+    config        jsonb,
+    messages      jsonb       not null default '[]',
+    message_count integer     not null default 0,
+    created_at    timestamptz not null,
+    updated_at    timestamptz not null,
+    archived_at   timestamptz not null,
+    ended_at      timestamptz,
+    end_reason    text,
+    primary key (session_id, version)
+);
+
+create index if not exists session_archives_tenant_id_idx on session_archives (tenant_id, created_at);
+create index if not exists session_archives_assistant_id_idx on session_archives (assistant_id, created_at);
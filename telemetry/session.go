@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/creastat/storage/session"
+)
+
+// Span attributes of session operations
+const (
+	sessionIDKey       = attribute.Key("session.id")
+	sessionVersionKey  = attribute.Key("session.version")
+	sessionFieldsKey   = attribute.Key("session.fields")
+	sessionMessagesKey = attribute.Key("session.messages")
+	sessionFoundKey    = attribute.Key("session.found")
+	sessionCountKey    = attribute.Key("session.result.count")
+)
+
+// Error types of session operations
+var sessionErrorTypes = []errorType{
+	{session.ErrVersionConflict, "version_conflict"},
+	{session.ErrNotFound, "not_found"},
+	{session.ErrAlreadyExists, "already_exists"},
+	{session.ErrInvalidField, "invalid_field"},
+	{session.ErrInvalidFilter, "invalid_filter"},
+	{session.ErrInvalidCursor, "invalid_cursor"},
+	{session.ErrNoCipher, "no_cipher"},
+	{session.ErrListUnsupported, "list_unsupported"},
+}
+
+// sessionStore instruments a session.Store
+type sessionStore struct {
+	store     session.Store
+	in        *instruments
+	conflicts metric.Int64Counter
+}
+
+// scanningSessionStore instruments a session.Store implementing
+// session.Scanner
+type scanningSessionStore struct {
+	*sessionStore
+}
+
+// NewSessionStore returns store instrumented with spans and metrics. The
+// returned store also implements session.Notifier and session.Scanner if
+// store does; events are passed through as they are. It always implements
+// session.Patcher, session.Appender, session.Toucher and session.Lister,
+// falling back as session.Patch, session.AppendMessages, session.Touch and
+// session.List do if store does not.
+func NewSessionStore(store session.Store, opts ...Option) session.Store {
+	s := &sessionStore{
+		store: store,
+		in:    newInstruments("session", newConfig(opts), sessionErrorTypes),
+	}
+	s.conflicts = s.in.counter("session.version_conflicts",
+		"Number of session writes rejected because the session changed since it was read.", "{conflict}")
+
+	notifier, notifies := store.(session.Notifier)
+	_, scans := store.(session.Scanner)
+	switch {
+	case notifies && scans:
+		return struct {
+			scanningSessionStore
+			session.Notifier
+		}{scanningSessionStore{s}, notifier}
+	case notifies:
+		return struct {
+			*sessionStore
+			session.Notifier
+		}{s, notifier}
+	case scans:
+		return scanningSessionStore{s}
+	default:
+		return s
+	}
+}
+
+// end ends op, counting version conflicts
+func (s *sessionStore) end(op *operation, err error, attrs ...attribute.KeyValue) {
+	if errors.Is(err, session.ErrVersionConflict) {
+		s.conflicts.Add(op.ctx, 1, metric.WithAttributeSet(attribute.NewSet(op.attrs...)))
+	}
+	op.end(err, attrs...)
+}
+
+// Create implements session.Store.
+func (s *sessionStore) Create(ctx context.Context, data *session.SessionData) error {
+	ctx, op := s.in.start(ctx, "Create", nil, sessionIDKey.String(data.ID))
+	err := s.store.Create(ctx, data)
+	s.end(op, err, sessionVersionKey.Int64(data.Version))
+	return err
+}
+
+// Get implements session.Store.
+func (s *sessionStore) Get(ctx context.Context, id string) (*session.SessionData, error) {
+	ctx, op := s.in.start(ctx, "Get", nil, sessionIDKey.String(id))
+	data, err := s.store.Get(ctx, id)
+	if data != nil {
+		s.end(op, err, sessionFoundKey.Bool(true), sessionVersionKey.Int64(data.Version))
+	} else {
+		s.end(op, err, sessionFoundKey.Bool(false))
+	}
+	return data, err
+}
+
+// Update implements session.Store.
+func (s *sessionStore) Update(ctx context.Context, data *session.SessionData) error {
+	ctx, op := s.in.start(ctx, "Update", nil, sessionIDKey.String(data.ID))
+	err := s.store.Update(ctx, data)
+	s.end(op, err, sessionVersionKey.Int64(data.Version))
+	return err
+}
+
+// Patch implements session.Patcher, patching the wrapped store with
+// session.Patch.
+func (s *sessionStore) Patch(ctx context.Context, data *session.SessionData, fields ...session.Field) error {
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		names[i] = string(field)
+	}
+	ctx, op := s.in.start(ctx, "Patch", nil, sessionIDKey.String(data.ID), sessionFieldsKey.StringSlice(names))
+	err := session.Patch(ctx, s.store, data, fields...)
+	s.end(op, err, sessionVersionKey.Int64(data.Version))
+	return err
+}
+
+// AppendMessages implements session.Appender, appending with
+// session.AppendMessages.
+func (s *sessionStore) AppendMessages(ctx context.Context, id string, msgs ...session.Message) error {
+	ctx, op := s.in.start(ctx, "AppendMessages", nil, sessionIDKey.String(id), sessionMessagesKey.Int(len(msgs)))
+	err := session.AppendMessages(ctx, s.store, id, msgs...)
+	s.end(op, err)
+	return err
+}
+
+// Touch implements session.Toucher, touching with session.Touch.
+func (s *sessionStore) Touch(ctx context.Context, id string) error {
+	ctx, op := s.in.start(ctx, "Touch", nil, sessionIDKey.String(id))
+	err := session.Touch(ctx, s.store, id)
+	s.end(op, err)
+	return err
+}
+
+// List implements session.Lister, listing with session.List.
+func (s *sessionStore) List(ctx context.Context, filter session.ListFilter, cursor string) ([]*session.SessionData, string, error) {
+	ctx, op := s.in.start(ctx, "List", nil)
+	sessions, next, err := session.List(ctx, s.store, filter, cursor)
+	s.end(op, err, sessionCountKey.Int(len(sessions)))
+	return sessions, next, err
+}
+
+// Delete implements session.Store.
+func (s *sessionStore) Delete(ctx context.Context, id string) error {
+	ctx, op := s.in.start(ctx, "Delete", nil, sessionIDKey.String(id))
+	err := s.store.Delete(ctx, id)
+	s.end(op, err)
+	return err
+}
+
+// Close closes the wrapped store.
+func (s *sessionStore) Close() error {
+	return s.store.Close()
+}
+
+// Scan scans the wrapped store in a single span, counting the sessions
+// visited.
+func (s scanningSessionStore) Scan(ctx context.Context, fn func(*session.SessionData) error) error {
+	ctx, op := s.in.start(ctx, "Scan", nil)
+	count := 0
+	err := s.store.(session.Scanner).Scan(ctx, func(data *session.SessionData) error {
+		count++
+		return fn(data)
+	})
+	s.end(op, err, sessionCountKey.Int(count))
+	return err
+}
+
+// Compile-time checks that the wrappers implement the session interfaces
+var (
+	_ session.Store    = (*sessionStore)(nil)
+	_ session.Patcher  = (*sessionStore)(nil)
+	_ session.Appender = (*sessionStore)(nil)
+	_ session.Toucher  = (*sessionStore)(nil)
+	_ session.Lister   = (*sessionStore)(nil)
+	_ session.Scanner  = scanningSessionStore{}
+)
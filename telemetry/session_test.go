@@ -0,0 +1,179 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/creastat/storage/session"
+	"github.com/creastat/storage/session/drivers"
+	"github.com/creastat/storage/telemetry"
+)
+
+// basicStore hides the optional interfaces of a store and fails Delete.
+type basicStore struct {
+	session.Store
+}
+
+var errDelete = errors.New("delete failed")
+
+func (basicStore) Delete(context.Context, string) error {
+	return errDelete
+}
+
+func TestSessionStore(t *testing.T) {
+	ctx := context.Background()
+	rec, opts := newRecorder()
+	memory := attribute.String("db.system.name", "memory")
+	store := telemetry.NewSessionStore(drivers.NewInMemoryStore(), append(opts, telemetry.WithAttributes(memory))...)
+
+	data := &session.SessionData{ID: "s1", TenantID: "t1"}
+	if err := store.Create(ctx, data); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "missing"); err != nil {
+		t.Fatal(err)
+	}
+	stale := *got
+	if err := store.Update(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(ctx, &stale); !errors.Is(err, session.ErrVersionConflict) {
+		t.Fatalf("stale Update: err = %v, want ErrVersionConflict", err)
+	}
+	if err := store.Update(ctx, &session.SessionData{ID: "missing"}); !errors.Is(err, session.ErrNotFound) {
+		t.Fatalf("Update of a missing session: err = %v, want ErrNotFound", err)
+	}
+	if err := store.(session.Patcher).Patch(ctx, got, session.FieldLanguage); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.(session.Appender).AppendMessages(ctx, "s1", session.Message{Role: "user"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.(session.Lister).List(ctx, session.ListFilter{TenantID: "t1"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.(session.Scanner).Scan(ctx, func(*session.SessionData) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Spans", func(t *testing.T) {
+		create := rec.ended(t, "session.Create")[0]
+		checkAttributes(t, create, memory, attribute.String("session.id", "s1"), attribute.Int64("session.version", 1))
+
+		gets := rec.ended(t, "session.Get")
+		checkAttributes(t, gets[0], attribute.String("session.id", "s1"), attribute.Bool("session.found", true))
+		checkAttributes(t, gets[1], attribute.String("session.id", "missing"), attribute.Bool("session.found", false))
+
+		updates := rec.ended(t, "session.Update")
+		if len(updates) != 3 {
+			t.Fatalf("%d Update spans, want 3", len(updates))
+		}
+		checkAttributes(t, updates[0], attribute.Int64("session.version", 2))
+		if updates[0].Status().Code != codes.Unset {
+			t.Errorf("Update status = %v, want unset", updates[0].Status())
+		}
+		for i, want := range []string{"version_conflict", "not_found"} {
+			span := updates[i+1]
+			checkAttributes(t, span, attribute.String("error.type", want))
+			if span.Status().Code != codes.Error {
+				t.Errorf("failed Update status = %v, want error", span.Status())
+			}
+		}
+
+		patch := rec.ended(t, "session.Patch")[0]
+		checkAttributes(t, patch, attribute.StringSlice("session.fields", []string{"language"}))
+		appendSpan := rec.ended(t, "session.AppendMessages")[0]
+		checkAttributes(t, appendSpan, attribute.Int("session.messages", 1))
+		checkAttributes(t, rec.ended(t, "session.List")[0], attribute.Int("session.result.count", 1))
+		checkAttributes(t, rec.ended(t, "session.Scan")[0], attribute.Int("session.result.count", 1))
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		update := attribute.String("operation", "Update")
+		if n := rec.count(t, "session.version_conflicts", memory, update); n != 1 {
+			t.Errorf("session.version_conflicts = %d, want 1", n)
+		}
+		for _, errType := range []string{"version_conflict", "not_found"} {
+			if n := rec.count(t, "session.operation.errors", update, attribute.String("error.type", errType)); n != 1 {
+				t.Errorf("session.operation.errors{error.type=%s} = %d, want 1", errType, n)
+			}
+		}
+		if n := rec.durations(t, "session.operation.duration", memory, attribute.String("operation", "Get")); n != 2 {
+			t.Errorf("session.operation.duration{operation=Get} count = %d, want 2", n)
+		}
+	})
+}
+
+func TestSessionStoreErrorTypes(t *testing.T) {
+	ctx := context.Background()
+	rec, opts := newRecorder()
+	store := telemetry.NewSessionStore(basicStore{drivers.NewInMemoryStore()}, opts...)
+
+	if err := store.Delete(ctx, "s1"); !errors.Is(err, errDelete) {
+		t.Fatalf("Delete: err = %v, want %v", err, errDelete)
+	}
+	if _, _, err := store.(session.Lister).List(ctx, session.ListFilter{TenantID: "t1"}, ""); !errors.Is(err, session.ErrListUnsupported) {
+		t.Fatalf("List: err = %v, want ErrListUnsupported", err)
+	}
+
+	checkAttributes(t, rec.ended(t, "session.Delete")[0], attribute.String("error.type", "_OTHER"))
+	checkAttributes(t, rec.ended(t, "session.List")[0], attribute.String("error.type", "list_unsupported"))
+	if n := rec.count(t, "session.operation.errors", attribute.String("error.type", "_OTHER")); n != 1 {
+		t.Errorf("session.operation.errors{error.type=_OTHER} = %d, want 1", n)
+	}
+	if n := rec.count(t, "session.version_conflicts"); n != 0 {
+		t.Errorf("session.version_conflicts = %d, want 0", n)
+	}
+}
+
+func TestSessionStoreInterfaces(t *testing.T) {
+	memory := drivers.NewInMemoryStore()
+	tests := []struct {
+		name            string
+		store           session.Store
+		notifies, scans bool
+	}{
+		{"Basic", basicStore{memory}, false, false},
+		{"Notifier", struct {
+			session.Store
+			session.Notifier
+		}{memory, memory}, true, false},
+		{"Scanner", struct {
+			session.Store
+			session.Scanner
+		}{memory, memory}, false, true},
+		{"Both", memory, true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := telemetry.NewSessionStore(tc.store)
+			if _, ok := store.(session.Notifier); ok != tc.notifies {
+				t.Errorf("implements Notifier = %v, want %v", ok, tc.notifies)
+			}
+			if _, ok := store.(session.Scanner); ok != tc.scans {
+				t.Errorf("implements Scanner = %v, want %v", ok, tc.scans)
+			}
+			// The helpers are always implemented, falling back if needed
+			if _, ok := store.(session.Patcher); !ok {
+				t.Error("does not implement Patcher")
+			}
+			if _, ok := store.(session.Appender); !ok {
+				t.Error("does not implement Appender")
+			}
+			if _, ok := store.(session.Toucher); !ok {
+				t.Error("does not implement Toucher")
+			}
+			if _, ok := store.(session.Lister); !ok {
+				t.Error("does not implement Lister")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/creastat/storage/supabase"
+)
+
+// Attributes of Supabase operations
+const (
+	supabaseTableKey    = attribute.Key("supabase.table")
+	supabaseIDKey       = attribute.Key("supabase.id")
+	supabaseIDsKey      = attribute.Key("supabase.ids")
+	supabaseCountKey    = attribute.Key("supabase.result.count")
+	supabaseCacheHitKey = attribute.Key("supabase.cache.hit")
+)
+
+// Tables read and written by supabase.Client
+var (
+	assistantsTable      = []attribute.KeyValue{supabaseTableKey.String("assistants")}
+	tenantsTable         = []attribute.KeyValue{supabaseTableKey.String("tenants")}
+	sourcesTable         = []attribute.KeyValue{supabaseTableKey.String("sources")}
+	documentsTable       = []attribute.KeyValue{supabaseTableKey.String("documents")}
+	sessionArchivesTable = []attribute.KeyValue{supabaseTableKey.String("session_archives")}
+)
+
+// supabaseStore instruments a supabase.Store
+type supabaseStore struct {
+	store   supabase.Store
+	in      *instruments
+	lookups metric.Int64Counter
+}
+
+// NewSupabaseStore returns store instrumented with spans and metrics. If
+// store is a *supabase.Client, or another store reporting its cache
+// lookups to the supabase.CacheObserver of the context, lookups are
+// recorded as well.
+func NewSupabaseStore(store supabase.Store, opts ...Option) supabase.Store {
+	s := &supabaseStore{
+		store: store,
+		in:    newInstruments("supabase", newConfig(opts), nil),
+	}
+	s.lookups = s.in.counter("supabase.cache.lookups",
+		"Number of Supabase cache lookups, hits and misses.", "{lookup}")
+	return s
+}
+
+// observeCache returns ctx making the store record its cache lookups for op
+func (s *supabaseStore) observeCache(ctx context.Context, op *operation) context.Context {
+	return supabase.WithCacheObserver(ctx, func(hit bool) {
+		op.span.SetAttributes(supabaseCacheHitKey.Bool(hit))
+		attrs := append(op.attrs[:len(op.attrs):len(op.attrs)], supabaseCacheHitKey.Bool(hit))
+		s.lookups.Add(op.ctx, 1, metric.WithAttributeSet(attribute.NewSet(attrs...)))
+	})
+}
+
+// GetAssistantByToken implements supabase.Store.
+func (s *supabaseStore) GetAssistantByToken(ctx context.Context, publicToken string) (*supabase.Assistant, error) {
+	ctx, op := s.in.start(ctx, "GetAssistantByToken", assistantsTable)
+	assistant, err := s.store.GetAssistantByToken(s.observeCache(ctx, op), publicToken)
+	if assistant != nil {
+		op.end(err, supabaseIDKey.String(assistant.ID))
+	} else {
+		op.end(err)
+	}
+	return assistant, err
+}
+
+// GetTenant implements supabase.Store.
+func (s *supabaseStore) GetTenant(ctx context.Context, tenantID string) (*supabase.Tenant, error) {
+	ctx, op := s.in.start(ctx, "GetTenant", tenantsTable, supabaseIDKey.String(tenantID))
+	tenant, err := s.store.GetTenant(s.observeCache(ctx, op), tenantID)
+	op.end(err)
+	return tenant, err
+}
+
+// GetSource implements supabase.Store.
+func (s *supabaseStore) GetSource(ctx context.Context, sourceID string) (*supabase.Source, error) {
+	ctx, op := s.in.start(ctx, "GetSource", sourcesTable, supabaseIDKey.String(sourceID))
+	source, err := s.store.GetSource(s.observeCache(ctx, op), sourceID)
+	op.end(err)
+	return source, err
+}
+
+// GetSourcesByAssistantID implements supabase.Store.
+func (s *supabaseStore) GetSourcesByAssistantID(ctx context.Context, assistantID string) ([]supabase.Source, error) {
+	ctx, op := s.in.start(ctx, "GetSourcesByAssistantID", sourcesTable)
+	sources, err := s.store.GetSourcesByAssistantID(ctx, assistantID)
+	op.end(err, supabaseCountKey.Int(len(sources)))
+	return sources, err
+}
+
+// GetDocument implements supabase.Store.
+func (s *supabaseStore) GetDocument(ctx context.Context, documentID string) (*supabase.Document, error) {
+	ctx, op := s.in.start(ctx, "GetDocument", documentsTable, supabaseIDKey.String(documentID))
+	document, err := s.store.GetDocument(s.observeCache(ctx, op), documentID)
+	op.end(err)
+	return document, err
+}
+
+// GetDocumentsByIDs implements supabase.Store.
+func (s *supabaseStore) GetDocumentsByIDs(ctx context.Context, documentIDs []string) ([]supabase.Document, error) {
+	ctx, op := s.in.start(ctx, "GetDocumentsByIDs", documentsTable, supabaseIDsKey.Int(len(documentIDs)))
+	documents, err := s.store.GetDocumentsByIDs(ctx, documentIDs)
+	op.end(err, supabaseCountKey.Int(len(documents)))
+	return documents, err
+}
+
+// Close closes the wrapped store.
+func (s *supabaseStore) Close() error {
+	return s.store.Close()
+}
+
+// sessionArchive instruments a supabase.SessionArchive
+type sessionArchive struct {
+	archive supabase.SessionArchive
+	in      *instruments
+}
+
+// NewSessionArchive returns archive instrumented with spans and metrics,
+// recorded as Supabase operations.
+func NewSessionArchive(archive supabase.SessionArchive, opts ...Option) supabase.SessionArchive {
+	return &sessionArchive{
+		archive: archive,
+		in:      newInstruments("supabase", newConfig(opts), nil),
+	}
+}
+
+// ArchiveSession implements supabase.SessionArchive.
+func (a *sessionArchive) ArchiveSession(ctx context.Context, session *supabase.ArchivedSession) error {
+	ctx, op := a.in.start(ctx, "ArchiveSession", sessionArchivesTable,
+		sessionIDKey.String(session.SessionID), sessionVersionKey.Int64(session.Version))
+	err := a.archive.ArchiveSession(ctx, session)
+	op.end(err)
+	return err
+}
+
+// EndArchivedSession implements supabase.SessionArchive.
+func (a *sessionArchive) EndArchivedSession(ctx context.Context, sessionID, reason string, at time.Time) error {
+	ctx, op := a.in.start(ctx, "EndArchivedSession", sessionArchivesTable, sessionIDKey.String(sessionID))
+	err := a.archive.EndArchivedSession(ctx, sessionID, reason, at)
+	op.end(err)
+	return err
+}
+
+// Compile-time checks that the wrappers implement the Supabase interfaces
+var (
+	_ supabase.Store          = (*supabaseStore)(nil)
+	_ supabase.SessionArchive = (*sessionArchive)(nil)
+)
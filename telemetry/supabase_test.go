@@ -0,0 +1,60 @@
+package telemetry_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/creastat/storage/supabase"
+	"github.com/creastat/storage/telemetry"
+)
+
+func TestSupabaseStoreCache(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"t1","name":"Tenant"}`))
+	}))
+	defer server.Close()
+	client, err := supabase.New(supabase.Config{URL: server.URL, APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	rec, opts := newRecorder()
+	store := telemetry.NewSupabaseStore(client, opts...)
+	for range 3 {
+		if _, err := store.GetTenant(ctx, "t1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("%d requests, want 1", n)
+	}
+
+	spans := rec.ended(t, "supabase.GetTenant")
+	if len(spans) != 3 {
+		t.Fatalf("%d GetTenant spans, want 3", len(spans))
+	}
+	for i, span := range spans {
+		checkAttributes(t, span, attribute.String("supabase.table", "tenants"), attribute.String("supabase.id", "t1"),
+			attribute.Bool("supabase.cache.hit", i > 0))
+	}
+
+	tenants := attribute.String("supabase.table", "tenants")
+	if n := rec.count(t, "supabase.cache.lookups", tenants, attribute.Bool("supabase.cache.hit", false)); n != 1 {
+		t.Errorf("supabase.cache.lookups{supabase.cache.hit=false} = %d, want 1", n)
+	}
+	if n := rec.count(t, "supabase.cache.lookups", tenants, attribute.Bool("supabase.cache.hit", true)); n != 2 {
+		t.Errorf("supabase.cache.lookups{supabase.cache.hit=true} = %d, want 2", n)
+	}
+	if n := rec.durations(t, "supabase.operation.duration", attribute.String("operation", "GetTenant")); n != 3 {
+		t.Errorf("supabase.operation.duration{operation=GetTenant} count = %d, want 3", n)
+	}
+}
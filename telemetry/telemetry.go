@@ -0,0 +1,214 @@
+// Package telemetry instruments the storage clients with OpenTelemetry.
+//
+// Each wrapper implements the interface of the client it wraps and, for
+// every call, starts a client span named after the operation (e.g.
+// "session.Get" or "vectorstore.Search") and records its duration and, on
+// failure, its error type:
+//
+//	store = telemetry.NewSessionStore(store)
+//	vectors = telemetry.NewVectorStore(vectors, "documents")
+//	client = telemetry.NewSupabaseStore(client)
+//
+// Spans carry the attributes identifying what was accessed (session ID,
+// collection or table) and how much (result and item counts). Metrics are
+// recorded per component and operation:
+//
+//	session.operation.duration        Histogram of operation durations, in seconds
+//	session.operation.errors          Count of failed operations, by error.type
+//	session.version_conflicts         Count of writes rejected with session.ErrVersionConflict
+//	vectorstore.operation.duration    Histogram of operation durations, in seconds
+//	vectorstore.operation.errors      Count of failed operations, by error.type
+//	supabase.operation.duration       Histogram of operation durations, in seconds
+//	supabase.operation.errors         Count of failed operations, by error.type
+//	supabase.cache.lookups            Count of cache lookups, by supabase.cache.hit
+//
+// By default, the wrappers use the global TracerProvider and MeterProvider
+// registered with the otel package.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Instrumentation scope of the tracers and meters
+const scopeName = "github.com/creastat/storage/telemetry"
+
+// Attribute keys shared by every component
+const (
+	operationKey = attribute.Key("operation")
+	errorTypeKey = attribute.Key("error.type")
+)
+
+// Error type of errors no component recognizes
+const otherErrorType = "_OTHER"
+
+// Bucket boundaries of duration histograms, in seconds
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Option is a functional option for configuring a wrapper.
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	attributes     []attribute.KeyValue
+}
+
+// WithTracerProvider sets the TracerProvider creating the spans (default:
+// the global TracerProvider).
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider sets the MeterProvider recording the metrics (default:
+// the global MeterProvider).
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// WithAttributes adds attributes to every span and measurement, such as
+// the driver (e.g. db.system.name) when several stores are instrumented.
+// Measurements are aggregated by attribute, so values must not vary much.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.attributes = append(c.attributes, attrs...)
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.tracerProvider == nil {
+		c.tracerProvider = otel.GetTracerProvider()
+	}
+	if c.meterProvider == nil {
+		c.meterProvider = otel.GetMeterProvider()
+	}
+	return c
+}
+
+// errorType names an error known to a component
+type errorType struct {
+	err  error
+	name string
+}
+
+// Error types of context errors, known to every component
+var contextErrorTypes = []errorType{
+	{context.Canceled, "canceled"},
+	{context.DeadlineExceeded, "deadline_exceeded"},
+}
+
+// instruments holds the tracer and the operation metrics of a component
+type instruments struct {
+	component  string
+	tracer     trace.Tracer
+	meter      metric.Meter
+	duration   metric.Float64Histogram
+	errors     metric.Int64Counter
+	attributes []attribute.KeyValue
+	errorTypes []errorType
+}
+
+// newInstruments creates the tracer and the operation metrics of
+// component. Errors creating metrics are reported to the global error
+// handler; the metrics returned with them are still usable.
+func newInstruments(component string, cfg *config, errorTypes []errorType) *instruments {
+	in := &instruments{
+		component:  component,
+		tracer:     cfg.tracerProvider.Tracer(scopeName),
+		meter:      cfg.meterProvider.Meter(scopeName),
+		attributes: cfg.attributes,
+		errorTypes: slices.Concat(errorTypes, contextErrorTypes),
+	}
+
+	var err error
+	in.duration, err = in.meter.Float64Histogram(component+".operation.duration",
+		metric.WithDescription("Duration of "+component+" operations."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		otel.Handle(err)
+	}
+	in.errors = in.counter(component+".operation.errors", "Number of failed "+component+" operations.", "{error}")
+	return in
+}
+
+// counter creates a counter of the component
+func (in *instruments) counter(name, description, unit string) metric.Int64Counter {
+	counter, err := in.meter.Int64Counter(name, metric.WithDescription(description), metric.WithUnit(unit))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+}
+
+// operation is a call being instrumented
+type operation struct {
+	in    *instruments
+	ctx   context.Context
+	span  trace.Span
+	start time.Time
+	attrs []attribute.KeyValue // Metric attributes
+}
+
+// start starts the span of the operation name, with attrs and the
+// attributes of the component. metricAttrs are also recorded with its
+// metrics.
+func (in *instruments) start(ctx context.Context, name string, metricAttrs []attribute.KeyValue, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	op := &operation{
+		in:    in,
+		start: time.Now(),
+		attrs: slices.Concat(in.attributes, metricAttrs, []attribute.KeyValue{operationKey.String(name)}),
+	}
+	op.ctx, op.span = in.tracer.Start(ctx, in.component+"."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(slices.Concat(in.attributes, metricAttrs, attrs)...))
+	return op.ctx, op
+}
+
+// end ends the operation with the error it returned, setting attrs on its
+// span.
+func (op *operation) end(err error, attrs ...attribute.KeyValue) {
+	op.span.SetAttributes(attrs...)
+	metricAttrs := op.attrs
+	if err != nil {
+		errType := errorTypeKey.String(op.in.errorType(err))
+		metricAttrs = append(metricAttrs, errType)
+		op.span.SetAttributes(errType)
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	set := metric.WithAttributeSet(attribute.NewSet(metricAttrs...))
+	op.in.duration.Record(op.ctx, time.Since(op.start).Seconds(), set)
+	if err != nil {
+		op.in.errors.Add(op.ctx, 1, set)
+	}
+	op.span.End()
+}
+
+// errorType returns the error.type of err: the name of the first error
+// type of the component it matches, or _OTHER.
+func (in *instruments) errorType(err error) string {
+	for _, t := range in.errorTypes {
+		if errors.Is(err, t.err) {
+			return t.name
+		}
+	}
+	return otherErrorType
+}
@@ -0,0 +1,126 @@
+package telemetry_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/creastat/storage/telemetry"
+)
+
+// recorder records the spans and metrics of a wrapper.
+type recorder struct {
+	spans   *tracetest.SpanRecorder
+	metrics *sdkmetric.ManualReader
+}
+
+// newRecorder returns a recorder and the options making a wrapper record
+// to it.
+func newRecorder() (*recorder, []telemetry.Option) {
+	r := &recorder{spans: tracetest.NewSpanRecorder(), metrics: sdkmetric.NewManualReader()}
+	return r, []telemetry.Option{
+		telemetry.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(r.spans))),
+		telemetry.WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(r.metrics))),
+	}
+}
+
+// ended returns the ended spans named name, in the order they ended.
+func (r *recorder) ended(t *testing.T, name string) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range r.spans.Ended() {
+		if span.Name() == name {
+			if span.SpanKind() != trace.SpanKindClient {
+				t.Errorf("%s span kind = %v, want client", name, span.SpanKind())
+			}
+			spans = append(spans, span)
+		}
+	}
+	if len(spans) == 0 {
+		t.Fatalf("no %s span", name)
+	}
+	return spans
+}
+
+// collect returns the metrics recorded, by name.
+func (r *recorder) collect(t *testing.T) map[string]metricdata.Metrics {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := r.metrics.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := make(map[string]metricdata.Metrics)
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+// count returns the sum of the data points of the counter name having all
+// of attrs.
+func (r *recorder) count(t *testing.T, name string, attrs ...attribute.KeyValue) int64 {
+	t.Helper()
+	m, ok := r.collect(t)[name]
+	if !ok {
+		return 0
+	}
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	if !ok {
+		t.Fatalf("%s is a %T, want a counter", name, m.Data)
+	}
+	var total int64
+	for _, point := range sum.DataPoints {
+		if hasAttributes(point.Attributes.ToSlice(), attrs) {
+			total += point.Value
+		}
+	}
+	return total
+}
+
+// durations returns the number of durations recorded by the histogram
+// name having all of attrs.
+func (r *recorder) durations(t *testing.T, name string, attrs ...attribute.KeyValue) uint64 {
+	t.Helper()
+	m, ok := r.collect(t)[name]
+	if !ok {
+		return 0
+	}
+	histogram, ok := m.Data.(metricdata.Histogram[float64])
+	if !ok {
+		t.Fatalf("%s is a %T, want a histogram", name, m.Data)
+	}
+	var total uint64
+	for _, point := range histogram.DataPoints {
+		if hasAttributes(point.Attributes.ToSlice(), attrs) {
+			total += point.Count
+		}
+	}
+	return total
+}
+
+// hasAttributes reports whether got includes all of want.
+func hasAttributes(got, want []attribute.KeyValue) bool {
+	for _, kv := range want {
+		if !slices.Contains(got, kv) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAttributes fails if span does not have all of want.
+func checkAttributes(t *testing.T, span sdktrace.ReadOnlySpan, want ...attribute.KeyValue) {
+	t.Helper()
+	if !hasAttributes(span.Attributes(), want) {
+		t.Errorf("%s attributes = %v, want %v", span.Name(), span.Attributes(), want)
+	}
+}
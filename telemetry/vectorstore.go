@@ -0,0 +1,128 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// Attributes of vector store operations
+const (
+	vectorCollectionKey = attribute.Key("vectorstore.collection")
+	vectorLimitKey      = attribute.Key("vectorstore.limit")
+	vectorCountKey      = attribute.Key("vectorstore.result.count")
+	vectorPointsKey     = attribute.Key("vectorstore.points")
+	vectorIDsKey        = attribute.Key("vectorstore.ids")
+	vectorDimensionKey  = attribute.Key("vectorstore.dimension")
+	vectorFusionKey     = attribute.Key("vectorstore.fusion")
+)
+
+// Error types of vector store operations
+var vectorErrorTypes = []errorType{
+	{vectorstore.ErrEmptyFilter, "empty_filter"},
+	{vectorstore.ErrInvalidFilter, "invalid_filter"},
+	{vectorstore.ErrInvalidDimension, "invalid_dimension"},
+	{vectorstore.ErrEmptyQuery, "empty_query"},
+	{vectorstore.ErrSparseDisabled, "sparse_disabled"},
+}
+
+// vectorStore instruments a vectorstore.VectorStore
+type vectorStore struct {
+	store vectorstore.VectorStore
+	in    *instruments
+}
+
+// hybridVectorStore instruments a vectorstore.VectorStore implementing
+// vectorstore.HybridSearcher
+type hybridVectorStore struct {
+	*vectorStore
+}
+
+// NewVectorStore returns store, holding the collection named collection,
+// instrumented with spans and metrics. The collection is recorded with
+// both, as the interface does not expose it. The returned store also
+// implements vectorstore.HybridSearcher if store does.
+func NewVectorStore(store vectorstore.VectorStore, collection string, opts ...Option) vectorstore.VectorStore {
+	opts = append(opts[:len(opts):len(opts)], WithAttributes(vectorCollectionKey.String(collection)))
+	v := &vectorStore{
+		store: store,
+		in:    newInstruments("vectorstore", newConfig(opts), vectorErrorTypes),
+	}
+	if _, ok := store.(vectorstore.HybridSearcher); ok {
+		return hybridVectorStore{v}
+	}
+	return v
+}
+
+// Search implements vectorstore.VectorStore.
+func (v *vectorStore) Search(ctx context.Context, vector []float32, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	ctx, op := v.in.start(ctx, "Search", nil, vectorLimitKey.Int(limit))
+	results, err := v.store.Search(ctx, vector, filter, limit)
+	op.end(err, vectorCountKey.Int(len(results)))
+	return results, err
+}
+
+// Upsert implements vectorstore.VectorStore.
+func (v *vectorStore) Upsert(ctx context.Context, points []vectorstore.Point) error {
+	ctx, op := v.in.start(ctx, "Upsert", nil, vectorPointsKey.Int(len(points)))
+	err := v.store.Upsert(ctx, points)
+	op.end(err)
+	return err
+}
+
+// Delete implements vectorstore.VectorStore.
+func (v *vectorStore) Delete(ctx context.Context, ids []string) error {
+	ctx, op := v.in.start(ctx, "Delete", nil, vectorIDsKey.Int(len(ids)))
+	err := v.store.Delete(ctx, ids)
+	op.end(err)
+	return err
+}
+
+// DeleteByFilter implements vectorstore.VectorStore.
+func (v *vectorStore) DeleteByFilter(ctx context.Context, filter vectorstore.SearchFilter) error {
+	ctx, op := v.in.start(ctx, "DeleteByFilter", nil)
+	err := v.store.DeleteByFilter(ctx, filter)
+	op.end(err)
+	return err
+}
+
+// EnsureCollection implements vectorstore.VectorStore.
+func (v *vectorStore) EnsureCollection(ctx context.Context, cfg vectorstore.CollectionConfig) error {
+	ctx, op := v.in.start(ctx, "EnsureCollection", nil, vectorDimensionKey.Int(cfg.Dimension))
+	err := v.store.EnsureCollection(ctx, cfg)
+	op.end(err)
+	return err
+}
+
+// DeleteCollection implements vectorstore.VectorStore.
+func (v *vectorStore) DeleteCollection(ctx context.Context) error {
+	ctx, op := v.in.start(ctx, "DeleteCollection", nil)
+	err := v.store.DeleteCollection(ctx)
+	op.end(err)
+	return err
+}
+
+// Close closes the wrapped store.
+func (v *vectorStore) Close() error {
+	return v.store.Close()
+}
+
+// HybridSearch implements vectorstore.HybridSearcher.
+func (v hybridVectorStore) HybridSearch(ctx context.Context, query vectorstore.HybridQuery, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	fusion := query.Fusion
+	if fusion == "" {
+		fusion = vectorstore.FusionRRF
+	}
+	ctx, op := v.in.start(ctx, "HybridSearch", nil, vectorLimitKey.Int(limit), vectorFusionKey.String(string(fusion)))
+	results, err := v.store.(vectorstore.HybridSearcher).HybridSearch(ctx, query, filter, limit)
+	op.end(err, vectorCountKey.Int(len(results)))
+	return results, err
+}
+
+// Compile-time checks that the wrappers implement the vector store interfaces
+var (
+	_ vectorstore.VectorStore    = (*vectorStore)(nil)
+	_ vectorstore.HybridSearcher = hybridVectorStore{}
+)
@@ -0,0 +1,64 @@
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/creastat/storage/telemetry"
+	"github.com/creastat/storage/vectorstore"
+	"github.com/creastat/storage/vectorstore/memory"
+)
+
+func TestVectorStore(t *testing.T) {
+	ctx := context.Background()
+	rec, opts := newRecorder()
+	store := telemetry.NewVectorStore(memory.New(), "documents", opts...)
+
+	if err := store.EnsureCollection(ctx, vectorstore.CollectionConfig{Dimension: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Upsert(ctx, []vectorstore.Point{{ID: "p1", Vector: []float32{1, 0}, Content: "hello"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 5); err != nil {
+		t.Fatal(err)
+	}
+	hybrid, ok := store.(vectorstore.HybridSearcher)
+	if !ok {
+		t.Fatal("does not implement HybridSearcher")
+	}
+	// The span is recorded whether or not the store can search hybridly
+	_, _ = hybrid.HybridSearch(ctx, vectorstore.HybridQuery{Dense: []float32{1, 0}, Text: "hello"}, vectorstore.SearchFilter{}, 5)
+	if err := store.DeleteByFilter(ctx, vectorstore.SearchFilter{}); !errors.Is(err, vectorstore.ErrEmptyFilter) {
+		t.Fatalf("DeleteByFilter: err = %v, want ErrEmptyFilter", err)
+	}
+
+	collection := attribute.String("vectorstore.collection", "documents")
+	checkAttributes(t, rec.ended(t, "vectorstore.EnsureCollection")[0], collection, attribute.Int("vectorstore.dimension", 2))
+	checkAttributes(t, rec.ended(t, "vectorstore.Upsert")[0], collection, attribute.Int("vectorstore.points", 1))
+	checkAttributes(t, rec.ended(t, "vectorstore.Search")[0], collection,
+		attribute.Int("vectorstore.limit", 5), attribute.Int("vectorstore.result.count", 1))
+	checkAttributes(t, rec.ended(t, "vectorstore.HybridSearch")[0], collection, attribute.String("vectorstore.fusion", "rrf"))
+	checkAttributes(t, rec.ended(t, "vectorstore.DeleteByFilter")[0], collection, attribute.String("error.type", "empty_filter"))
+
+	if n := rec.count(t, "vectorstore.operation.errors", collection, attribute.String("error.type", "empty_filter")); n != 1 {
+		t.Errorf("vectorstore.operation.errors{error.type=empty_filter} = %d, want 1", n)
+	}
+	if n := rec.durations(t, "vectorstore.operation.duration", collection, attribute.String("operation", "Search")); n != 1 {
+		t.Errorf("vectorstore.operation.duration{operation=Search} count = %d, want 1", n)
+	}
+}
+
+func TestVectorStoreInterfaces(t *testing.T) {
+	// Embedding the interface hides HybridSearch
+	plain := struct{ vectorstore.VectorStore }{memory.New()}
+	if _, ok := telemetry.NewVectorStore(plain, "documents").(vectorstore.HybridSearcher); ok {
+		t.Error("wrapper of a store without HybridSearch implements HybridSearcher")
+	}
+	if _, ok := telemetry.NewVectorStore(memory.New(), "documents").(vectorstore.HybridSearcher); !ok {
+		t.Error("wrapper of a HybridSearcher does not implement HybridSearcher")
+	}
+}
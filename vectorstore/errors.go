@@ -0,0 +1,12 @@
+package vectorstore
+
+import "errors"
+
+// Common errors for vector store operations.
+var (
+	ErrEmptyFilter      = errors.New("empty filter")
+	ErrInvalidFilter    = errors.New("invalid filter")
+	ErrInvalidDimension = errors.New("invalid vector dimension")
+	ErrEmptyQuery       = errors.New("empty query")
+	ErrSparseDisabled   = errors.New("sparse vectors are not configured")
+)
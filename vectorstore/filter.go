@@ -0,0 +1,188 @@
+package vectorstore
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Condition is a node of a filter expression.
+// It is implemented by Filter, Match, MatchAny, MatchExcept, Range,
+// DatetimeRange, IsNull, IsEmpty and Nested.
+//
+// Keys address payload fields; dots descend into nested objects
+// ("author.name") and arrays are matched element-wise, so a condition on an
+// array field holds if any element satisfies it.
+type Condition interface {
+	condition()
+}
+
+// Filter combines conditions. It matches when all Must conditions match,
+// at least one Should condition matches (if any are given), and no MustNot
+// condition matches. A Filter is itself a Condition, so filters nest.
+type Filter struct {
+	Must    []Condition
+	Should  []Condition
+	MustNot []Condition
+}
+
+// Match matches when the value under Key equals Value.
+// Value may be a string, integer, bool, float or time.Time, of any integer
+// or float kind (see NormalizeMatchValue); floats and times are compared
+// numerically and chronologically.
+type Match struct {
+	Key   string
+	Value any
+}
+
+// MatchAny matches when the value under Key equals one of Values.
+// Values must be all strings or all integers.
+type MatchAny struct {
+	Key    string
+	Values []any
+}
+
+// MatchExcept matches when the value under Key is present and is none of
+// Values. Values must be all strings or all integers.
+type MatchExcept struct {
+	Key    string
+	Values []any
+}
+
+// Range matches numeric values within the given bounds.
+// Nil bounds are ignored.
+type Range struct {
+	Key string
+	GT  *float64
+	GTE *float64
+	LT  *float64
+	LTE *float64
+}
+
+// DatetimeRange matches RFC 3339 timestamps within the given bounds.
+// Nil bounds are ignored.
+type DatetimeRange struct {
+	Key string
+	GT  *time.Time
+	GTE *time.Time
+	LT  *time.Time
+	LTE *time.Time
+}
+
+// IsNull matches when the field under Key exists and is null.
+type IsNull struct {
+	Key string
+}
+
+// IsEmpty matches when the field under Key is missing, null or an empty array.
+type IsEmpty struct {
+	Key string
+}
+
+// Nested matches when at least one object of the array under Key satisfies
+// Filter as a whole. Keys inside Filter are relative to the array element.
+type Nested struct {
+	Key    string
+	Filter Filter
+}
+
+func (Filter) condition()        {}
+func (Match) condition()         {}
+func (MatchAny) condition()      {}
+func (MatchExcept) condition()   {}
+func (Range) condition()         {}
+func (DatetimeRange) condition() {}
+func (IsNull) condition()        {}
+func (IsEmpty) condition()       {}
+func (Nested) condition()        {}
+
+// IsEmpty reports whether the filter has no conditions.
+func (f Filter) IsEmpty() bool {
+	return len(f.Must) == 0 && len(f.Should) == 0 && len(f.MustNot) == 0
+}
+
+// MetadataConditions converts a SearchFilter's Metadata map into Match
+// conditions, in a stable order.
+func MetadataConditions(metadata map[string]any) []Condition {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	conditions := make([]Condition, len(keys))
+	for i, k := range keys {
+		conditions[i] = Match{Key: k, Value: metadata[k]}
+	}
+	return conditions
+}
+
+// NormalizeMatchValue converts a Match value to the type it is matched as:
+// int64 for every integer kind, float64 for both float kinds, and bool,
+// string or time.Time, including named types based on them and pointers to
+// them. Any other value is matched as the keyword of its %v form.
+func NormalizeMatchValue(value any) any {
+	if t, ok := value.(time.Time); ok {
+		return t
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		// Wraps above math.MaxInt64 like NormalizeValue, so it matches the stored value
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			return NormalizeMatchValue(rv.Elem().Interface())
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// MatchValues splits MatchAny/MatchExcept values into keywords or integers.
+// Exactly one of the returned slices is non-nil on success.
+// Returns ErrInvalidFilter if values are empty or of mixed or other types.
+func MatchValues(values []any) (keywords []string, integers []int64, err error) {
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("%w: no values to match", ErrInvalidFilter)
+	}
+
+	for _, v := range values {
+		normalized, err := NormalizeValue(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		switch val := normalized.(type) {
+		case string:
+			keywords = append(keywords, val)
+		case int64:
+			integers = append(integers, val)
+		default:
+			return nil, nil, fmt.Errorf("%w: cannot match %T values", ErrInvalidFilter, v)
+		}
+	}
+
+	if keywords != nil && integers != nil {
+		return nil, nil, fmt.Errorf("%w: mixed string and integer values", ErrInvalidFilter)
+	}
+	return keywords, integers, nil
+}
+
+// Float returns a pointer to f, for Range bounds.
+func Float(f float64) *float64 {
+	return &f
+}
+
+// Time returns a pointer to t, for DatetimeRange bounds.
+func Time(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,52 @@
+package vectorstore
+
+import (
+	"testing"
+	"time"
+)
+
+type language string
+
+type level int32
+
+func TestNormalizeMatchValue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	n := int16(7)
+	var nilPtr *int
+
+	tests := []struct {
+		name  string
+		value any
+		want  any
+	}{
+		{"string", "en", "en"},
+		{"named string", language("de"), "de"},
+		{"int", 1, int64(1)},
+		{"int8", int8(-2), int64(-2)},
+		{"int16", int16(3), int64(3)},
+		{"int32", int32(4), int64(4)},
+		{"int64", int64(5), int64(5)},
+		{"named int32", level(6), int64(6)},
+		{"uint", uint(7), int64(7)},
+		{"uint8", uint8(8), int64(8)},
+		{"uint16", uint16(9), int64(9)},
+		{"uint32", uint32(10), int64(10)},
+		{"uint64", uint64(11), int64(11)},
+		{"float32", float32(0.5), float64(0.5)},
+		{"float64", 1.25, 1.25},
+		{"bool", true, true},
+		{"time", now, now},
+		{"pointer", &n, int64(7)},
+		{"nil pointer", nilPtr, "<nil>"},
+		{"nil", nil, "<nil>"},
+		{"struct", struct{ A int }{1}, "{1}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NormalizeMatchValue(tt.value)
+			if got != tt.want {
+				t.Errorf("NormalizeMatchValue(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
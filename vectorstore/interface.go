@@ -8,6 +8,23 @@ type VectorStore interface {
 	// Search performs vector similarity search with optional filtering.
 	Search(ctx context.Context, vector []float32, filter SearchFilter, limit int) ([]SearchResult, error)
 
+	// Upsert inserts or replaces points by ID.
+	Upsert(ctx context.Context, points []Point) error
+
+	// Delete removes points by ID. Unknown IDs are ignored.
+	Delete(ctx context.Context, ids []string) error
+
+	// DeleteByFilter removes every point matching the filter.
+	// MinScore is ignored. Returns ErrEmptyFilter if the filter matches everything.
+	DeleteByFilter(ctx context.Context, filter SearchFilter) error
+
+	// EnsureCollection creates the collection if it does not exist yet.
+	// An existing collection is left untouched.
+	EnsureCollection(ctx context.Context, cfg CollectionConfig) error
+
+	// DeleteCollection drops the collection and all of its points.
+	DeleteCollection(ctx context.Context) error
+
 	// Close releases any resources held by the vector store.
 	Close() error
 }
@@ -22,9 +39,16 @@ type SearchFilter struct {
 	// If both SourceID and SourceIDs are set, SourceIDs takes precedence.
 	SourceIDs []string
 
+	// DocumentIDs filters results to chunks of the given documents.
+	DocumentIDs []string
+
 	// Metadata filters results by metadata key-value pairs.
+	// Each pair is equivalent to a Match condition.
 	Metadata map[string]any
 
+	// Where is an optional filter expression ANDed with the fields above.
+	Where *Filter
+
 	// MinScore filters results below this similarity threshold (0.0-1.0).
 	MinScore float32
 }
@@ -49,3 +73,109 @@ type SearchResult struct {
 	// Metadata contains additional key-value pairs.
 	Metadata map[string]any
 }
+
+// Point is a vector with its payload, as written by Upsert.
+// Content, SourceID and DocumentID are stored under the same payload keys
+// that Search decodes into SearchResult.
+type Point struct {
+	// ID is the unique identifier of the point.
+	ID string
+
+	// Vector is the dense embedding.
+	Vector []float32
+
+	// Sparse is an optional sparse embedding (e.g. BM25 or SPLADE weights)
+	// used by HybridSearch. Stores that embed text server-side derive it
+	// from Content when nil.
+	Sparse *SparseVector
+
+	// Content is the text content associated with this vector.
+	Content string
+
+	// SourceID identifies the source/collection this point belongs to.
+	SourceID string
+
+	// DocumentID identifies the document this chunk belongs to.
+	DocumentID string
+
+	// Metadata contains additional key-value pairs.
+	// Keys colliding with content, source_id or document_id are ignored.
+	Metadata map[string]any
+}
+
+// HybridSearcher is implemented by vector stores that can fuse dense and
+// sparse retrieval in a single query.
+type HybridSearcher interface {
+	// HybridSearch runs a dense and a sparse query with the same filter and
+	// fuses both rankings. Fused scores are rank-based and not comparable
+	// to Search scores, so MinScore should be chosen accordingly.
+	HybridSearch(ctx context.Context, query HybridQuery, filter SearchFilter, limit int) ([]SearchResult, error)
+}
+
+// HybridQuery describes the inputs of a hybrid search.
+// At least one of Dense, Sparse or Text must be set.
+type HybridQuery struct {
+	// Dense is the dense query embedding.
+	Dense []float32
+
+	// Sparse is a precomputed sparse query vector.
+	Sparse *SparseVector
+
+	// Text is the raw query text, embedded by the store into the sparse
+	// space (e.g. server-side BM25). Ignored if Sparse is set.
+	Text string
+
+	// Fusion selects how the rankings are combined (default: FusionRRF).
+	Fusion Fusion
+
+	// PrefetchLimit is the number of candidates fetched per ranking
+	// before fusion (default: 4x limit).
+	PrefetchLimit int
+}
+
+// SparseVector is a sparse embedding in index/value form.
+type SparseVector struct {
+	Indices []uint32
+	Values  []float32
+}
+
+// Fusion is the method used to merge rankings in a hybrid search.
+type Fusion string
+
+const (
+	// FusionRRF is Reciprocal Rank Fusion.
+	FusionRRF Fusion = "rrf"
+	// FusionDBSF is Distribution-Based Score Fusion.
+	FusionDBSF Fusion = "dbsf"
+)
+
+// Distance is the similarity function used to compare vectors.
+type Distance string
+
+const (
+	DistanceCosine    Distance = "cosine"
+	DistanceDot       Distance = "dot"
+	DistanceEuclidean Distance = "euclidean"
+)
+
+// CollectionConfig describes the vector layout of a collection.
+type CollectionConfig struct {
+	// Dimension is the size of the dense vectors.
+	Dimension int
+
+	// Distance is the similarity function (default: DistanceCosine).
+	Distance Distance
+}
+
+// Payload keys shared by all implementations.
+const (
+	PayloadContent    = "content"
+	PayloadSourceID   = "source_id"
+	PayloadDocumentID = "document_id"
+)
+
+// IsEmpty reports whether the filter has no conditions (MinScore aside).
+func (f SearchFilter) IsEmpty() bool {
+	return f.SourceID == "" && len(f.SourceIDs) == 0 && len(f.DocumentIDs) == 0 && len(f.Metadata) == 0 &&
+		(f.Where == nil || f.Where.IsEmpty())
+}
@@ -0,0 +1,343 @@
+package memory
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// predicate reports whether a payload satisfies a condition.
+type predicate func(payload map[string]any) bool
+
+// compileFilter converts a SearchFilter into a predicate with the same
+// semantics as the Qdrant driver's buildQdrantFilter: all conditions are
+// ANDed, SourceIDs takes precedence over SourceID, and metadata values are
+// matched the way buildMatchCondition does.
+func compileFilter(filter vectorstore.SearchFilter) (predicate, error) {
+	var conditions []predicate
+
+	if len(filter.SourceIDs) > 0 {
+		conditions = append(conditions, matchKeywords(vectorstore.PayloadSourceID, filter.SourceIDs))
+	} else if filter.SourceID != "" {
+		conditions = append(conditions, matchKeywords(vectorstore.PayloadSourceID, []string{filter.SourceID}))
+	}
+
+	if len(filter.DocumentIDs) > 0 {
+		conditions = append(conditions, matchKeywords(vectorstore.PayloadDocumentID, filter.DocumentIDs))
+	}
+
+	for key, value := range filter.Metadata {
+		conditions = append(conditions, matchValue(key, value))
+	}
+
+	if filter.Where != nil {
+		where, err := compileExpr(*filter.Where)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, where)
+	}
+
+	return all(conditions), nil
+}
+
+// compileExpr converts a filter expression into a predicate.
+func compileExpr(filter vectorstore.Filter) (predicate, error) {
+	must, err := compileConditions(filter.Must)
+	if err != nil {
+		return nil, err
+	}
+	should, err := compileConditions(filter.Should)
+	if err != nil {
+		return nil, err
+	}
+	mustNot, err := compileConditions(filter.MustNot)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(payload map[string]any) bool {
+		for _, cond := range must {
+			if !cond(payload) {
+				return false
+			}
+		}
+		for _, cond := range mustNot {
+			if cond(payload) {
+				return false
+			}
+		}
+		if len(should) == 0 {
+			return true
+		}
+		for _, cond := range should {
+			if cond(payload) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// compileConditions converts a list of conditions into predicates.
+func compileConditions(conditions []vectorstore.Condition) ([]predicate, error) {
+	out := make([]predicate, len(conditions))
+	for i, cond := range conditions {
+		p, err := compileCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = p
+	}
+	return out, nil
+}
+
+// compileCondition converts a single condition into a predicate, following
+// Qdrant's semantics for each condition type.
+func compileCondition(cond vectorstore.Condition) (predicate, error) {
+	switch c := cond.(type) {
+	case vectorstore.Filter:
+		return compileExpr(c)
+	case vectorstore.Match:
+		return matchValue(c.Key, c.Value), nil
+	case vectorstore.MatchAny:
+		keywords, integers, err := vectorstore.MatchValues(c.Values)
+		if err != nil {
+			return nil, fmt.Errorf("match any %q: %w", c.Key, err)
+		}
+		if keywords != nil {
+			return matchKeywords(c.Key, keywords), nil
+		}
+		set := make(map[int64]struct{}, len(integers))
+		for _, i := range integers {
+			set[i] = struct{}{}
+		}
+		return anyValue(c.Key, func(v any) bool {
+			i, ok := v.(int64)
+			_, found := set[i]
+			return ok && found
+		}), nil
+	case vectorstore.MatchExcept:
+		keywords, integers, err := vectorstore.MatchValues(c.Values)
+		if err != nil {
+			return nil, fmt.Errorf("match except %q: %w", c.Key, err)
+		}
+		// At least one value of the same type outside the excluded set
+		if keywords != nil {
+			set := make(map[string]struct{}, len(keywords))
+			for _, k := range keywords {
+				set[k] = struct{}{}
+			}
+			return anyValue(c.Key, func(v any) bool {
+				s, ok := v.(string)
+				_, found := set[s]
+				return ok && !found
+			}), nil
+		}
+		set := make(map[int64]struct{}, len(integers))
+		for _, i := range integers {
+			set[i] = struct{}{}
+		}
+		return anyValue(c.Key, func(v any) bool {
+			i, ok := v.(int64)
+			_, found := set[i]
+			return ok && !found
+		}), nil
+	case vectorstore.Range:
+		return anyValue(c.Key, func(v any) bool {
+			f, ok := number(v)
+			return ok && inRange(f, c.GT, c.GTE, c.LT, c.LTE)
+		}), nil
+	case vectorstore.DatetimeRange:
+		return anyValue(c.Key, func(v any) bool {
+			t, ok := datetime(v)
+			return ok &&
+				(c.GT == nil || t.After(*c.GT)) &&
+				(c.GTE == nil || !t.Before(*c.GTE)) &&
+				(c.LT == nil || t.Before(*c.LT)) &&
+				(c.LTE == nil || !t.After(*c.LTE))
+		}), nil
+	case vectorstore.IsNull:
+		return func(payload map[string]any) bool {
+			for _, v := range lookupRaw(payload, c.Key) {
+				if v == nil {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case vectorstore.IsEmpty:
+		return func(payload map[string]any) bool {
+			for _, v := range lookup(payload, c.Key) {
+				if v != nil {
+					return false
+				}
+			}
+			return true
+		}, nil
+	case vectorstore.Nested:
+		inner, err := compileExpr(c.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return anyValue(c.Key, func(v any) bool {
+			obj, ok := v.(map[string]any)
+			return ok && inner(obj)
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported condition %T", vectorstore.ErrInvalidFilter, cond)
+	}
+}
+
+// all combines predicates with AND.
+func all(conditions []predicate) predicate {
+	return func(payload map[string]any) bool {
+		for _, cond := range conditions {
+			if !cond(payload) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// matchKeywords matches if any value under key equals one of the keywords.
+func matchKeywords(key string, keywords []string) predicate {
+	set := make(map[string]struct{}, len(keywords))
+	for _, k := range keywords {
+		set[k] = struct{}{}
+	}
+	return anyValue(key, func(v any) bool {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		_, found := set[s]
+		return found
+	})
+}
+
+// matchValue mirrors the Qdrant driver's buildMatchCondition: values are
+// normalized with vectorstore.NormalizeMatchValue, then strings match
+// keywords, integers match integers, bools match booleans, and floats and
+// times match as closed ranges.
+func matchValue(key string, value any) predicate {
+	switch v := vectorstore.NormalizeMatchValue(value).(type) {
+	case float64:
+		return anyValue(key, func(x any) bool {
+			n, ok := number(x)
+			return ok && n == v
+		})
+	case time.Time:
+		return anyValue(key, func(x any) bool {
+			t, ok := datetime(x)
+			return ok && t.Equal(v)
+		})
+	case int64:
+		return matchInteger(key, v)
+	case bool:
+		return anyValue(key, func(x any) bool {
+			b, ok := x.(bool)
+			return ok && b == v
+		})
+	default:
+		return matchKeywords(key, []string{fmt.Sprint(v)})
+	}
+}
+
+// matchInteger matches if any value under key is the given integer.
+func matchInteger(key string, want int64) predicate {
+	return anyValue(key, func(x any) bool {
+		i, ok := x.(int64)
+		return ok && i == want
+	})
+}
+
+// anyValue matches if fn holds for at least one value found under key.
+func anyValue(key string, fn func(any) bool) predicate {
+	return func(payload map[string]any) bool {
+		for _, v := range lookup(payload, key) {
+			if fn(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// number returns the numeric value of an integer or float payload value.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+// datetime parses a payload string as an RFC 3339 timestamp or a date.
+func datetime(v any) (time.Time, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// inRange checks f against optional bounds.
+func inRange(f float64, gt, gte, lt, lte *float64) bool {
+	return (gt == nil || f > *gt) &&
+		(gte == nil || f >= *gte) &&
+		(lt == nil || f < *lt) &&
+		(lte == nil || f <= *lte)
+}
+
+// lookup resolves a payload key the way Qdrant does: dots descend into
+// nested objects, a "[]" suffix (or any array on the way) fans out over
+// array elements, and arrays at the leaf are flattened into their elements.
+func lookup(payload map[string]any, key string) []any {
+	var values []any
+	for _, v := range lookupRaw(payload, key) {
+		values = append(values, flatten(v)...)
+	}
+	return values
+}
+
+// lookupRaw is like lookup but leaves arrays at the leaf intact.
+func lookupRaw(payload map[string]any, key string) []any {
+	current := []any{payload}
+	for _, part := range strings.Split(key, ".") {
+		part = strings.TrimSuffix(part, "[]")
+		var next []any
+		for _, node := range current {
+			for _, obj := range flatten(node) {
+				fields, ok := obj.(map[string]any)
+				if !ok {
+					continue
+				}
+				if v, ok := fields[part]; ok {
+					next = append(next, v)
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// flatten expands an array into its elements; other values are returned as is.
+func flatten(v any) []any {
+	if list, ok := v.([]any); ok {
+		return list
+	}
+	return []any{v}
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+func TestMatchValueNumericKinds(t *testing.T) {
+	payload, err := vectorstore.NormalizeMetadata(map[string]any{
+		"year":  2024,
+		"score": 0.5,
+		"lang":  "en",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key   string
+		value any
+		want  bool
+	}{
+		{"year", 2024, true},
+		{"year", int32(2024), true},
+		{"year", uint(2024), true},
+		{"year", uint64(2024), true},
+		{"year", int8(24), false},
+		{"year", "2024", false},
+		{"score", float32(0.5), true},
+		{"score", 0.5, true},
+		{"lang", "en", true},
+	}
+	for _, tt := range tests {
+		if got := matchValue(tt.key, tt.value)(payload); got != tt.want {
+			t.Errorf("match %s = %#v: got %v, want %v", tt.key, tt.value, got, tt.want)
+		}
+	}
+}
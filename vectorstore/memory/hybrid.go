@@ -0,0 +1,279 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+const (
+	// rrfK is the Reciprocal Rank Fusion constant, Qdrant's default.
+	rrfK = 2
+
+	// BM25 parameters used for text queries.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// HybridSearch implements vectorstore.HybridSearcher.
+// Text queries are scored with BM25 over point Content, standing in for
+// server-side sparse embedding.
+func (s *Store) HybridSearch(ctx context.Context, query vectorstore.HybridQuery, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	prefetchLimit := query.PrefetchLimit
+	if prefetchLimit <= 0 {
+		prefetchLimit = limit * 4
+	}
+
+	match, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*point, 0, len(s.points))
+	for _, p := range s.points {
+		if match(p.payload) {
+			candidates = append(candidates, p)
+		}
+	}
+
+	var rankings [][]scoredPoint
+	if len(query.Dense) > 0 {
+		if err := s.checkDimension(query.Dense); err != nil {
+			return nil, err
+		}
+		ranking := make([]scoredPoint, 0, len(candidates))
+		for _, p := range candidates {
+			if len(p.vector) != len(query.Dense) {
+				return nil, fmt.Errorf("%w: point %s has %d, query has %d", vectorstore.ErrInvalidDimension, p.id, len(p.vector), len(query.Dense))
+			}
+			ranking = append(ranking, scoredPoint{point: p, score: score(s.cfg.Distance, query.Dense, p.vector)})
+		}
+		sortScored(ranking, s.cfg.Distance)
+		rankings = append(rankings, truncate(ranking, prefetchLimit))
+	}
+
+	switch {
+	case query.Sparse != nil:
+		sparse, err := buildSparse(query.Sparse)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sparse query: %w", err)
+		}
+		ranking := make([]scoredPoint, 0, len(candidates))
+		for _, p := range candidates {
+			if sc, ok := sparseDot(sparse, p.sparse); ok {
+				ranking = append(ranking, scoredPoint{point: p, score: sc})
+			}
+		}
+		sortScored(ranking, vectorstore.DistanceDot)
+		rankings = append(rankings, truncate(ranking, prefetchLimit))
+	case query.Text != "":
+		ranking := s.bm25(query.Text, candidates)
+		sortScored(ranking, vectorstore.DistanceDot)
+		rankings = append(rankings, truncate(ranking, prefetchLimit))
+	}
+
+	if len(rankings) == 0 {
+		return nil, vectorstore.ErrEmptyQuery
+	}
+
+	var fused []scoredPoint
+	switch query.Fusion {
+	case "", vectorstore.FusionRRF:
+		fused = fuseRRF(rankings)
+	case vectorstore.FusionDBSF:
+		fused = fuseDBSF(rankings, s.cfg.Distance == vectorstore.DistanceEuclidean && len(query.Dense) > 0)
+	default:
+		return nil, fmt.Errorf("unsupported fusion: %s", query.Fusion)
+	}
+
+	sortScored(fused, vectorstore.DistanceDot)
+	fused = truncate(fused, limit)
+
+	results := make([]vectorstore.SearchResult, 0, len(fused))
+	for _, sp := range fused {
+		if filter.MinScore > 0 && sp.score < filter.MinScore {
+			continue
+		}
+		results = append(results, toResult(sp))
+	}
+	return results, nil
+}
+
+// buildSparse converts a sparse vector to a map, rejecting malformed input.
+func buildSparse(v *vectorstore.SparseVector) (map[uint32]float32, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if len(v.Indices) != len(v.Values) {
+		return nil, fmt.Errorf("%d indices for %d values", len(v.Indices), len(v.Values))
+	}
+	sparse := make(map[uint32]float32, len(v.Indices))
+	for i, idx := range v.Indices {
+		if _, dup := sparse[idx]; dup {
+			return nil, fmt.Errorf("duplicate index %d", idx)
+		}
+		sparse[idx] = v.Values[i]
+	}
+	return sparse, nil
+}
+
+// sparseDot returns the dot product of two sparse vectors, and whether they
+// share any index (points without overlap are not returned, as in Qdrant).
+func sparseDot(query, doc map[uint32]float32) (float32, bool) {
+	var sum float32
+	overlap := false
+	for idx, q := range query {
+		if d, ok := doc[idx]; ok {
+			sum += q * d
+			overlap = true
+		}
+	}
+	return sum, overlap
+}
+
+// bm25 scores candidates against the query text. Document frequencies are
+// computed over the whole collection, like Qdrant's IDF modifier.
+func (s *Store) bm25(text string, candidates []*point) []scoredPoint {
+	terms := tokenize(text)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	docFreq := make(map[string]int, len(terms))
+	for _, term := range terms {
+		docFreq[term] = 0
+	}
+	var totalLen int
+	for _, p := range s.points {
+		tokens := tokenize(contentOf(p))
+		totalLen += len(tokens)
+		seen := make(map[string]bool)
+		for _, tok := range tokens {
+			if _, ok := docFreq[tok]; ok && !seen[tok] {
+				docFreq[tok]++
+				seen[tok] = true
+			}
+		}
+	}
+	n := float64(len(s.points))
+	avgLen := float64(totalLen) / math.Max(n, 1)
+
+	ranking := make([]scoredPoint, 0, len(candidates))
+	for _, p := range candidates {
+		tokens := tokenize(contentOf(p))
+		freq := make(map[string]int)
+		for _, tok := range tokens {
+			freq[tok]++
+		}
+
+		var sum float64
+		for _, term := range terms {
+			tf := float64(freq[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			sum += idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(len(tokens))/math.Max(avgLen, 1)))
+		}
+		if sum > 0 {
+			ranking = append(ranking, scoredPoint{point: p, score: float32(sum)})
+		}
+	}
+	return ranking
+}
+
+// fuseRRF merges rankings with Reciprocal Rank Fusion: a point scores
+// 1/(rrfK+rank) in each ranking it appears in, with 1-based ranks, so the
+// first of a ranking scores 1/3 and the second 1/4.
+func fuseRRF(rankings [][]scoredPoint) []scoredPoint {
+	scores := make(map[*point]float32)
+	for _, ranking := range rankings {
+		for rank, sp := range ranking {
+			scores[sp.point] += 1 / float32(rrfK+rank+1)
+		}
+	}
+	return collect(scores)
+}
+
+// fuseDBSF merges rankings with Distribution-Based Score Fusion: each
+// ranking is normalized to [0, 1] using mean +/- 3 standard deviations,
+// then scores are summed. If invertFirst is set, the first ranking holds
+// distances and is inverted before normalization.
+func fuseDBSF(rankings [][]scoredPoint, invertFirst bool) []scoredPoint {
+	scores := make(map[*point]float32)
+	for i, ranking := range rankings {
+		if len(ranking) == 0 {
+			continue
+		}
+		values := make([]float64, len(ranking))
+		for j, sp := range ranking {
+			values[j] = float64(sp.score)
+			if i == 0 && invertFirst {
+				values[j] = -values[j]
+			}
+		}
+
+		var mean, variance float64
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+		std := math.Sqrt(variance / float64(len(values)))
+		low, high := mean-3*std, mean+3*std
+
+		for j, sp := range ranking {
+			normalized := 0.5
+			if high > low {
+				normalized = math.Min(math.Max((values[j]-low)/(high-low), 0), 1)
+			}
+			scores[sp.point] += float32(normalized)
+		}
+	}
+	return collect(scores)
+}
+
+// collect converts a score map back to a slice.
+func collect(scores map[*point]float32) []scoredPoint {
+	fused := make([]scoredPoint, 0, len(scores))
+	for p, sc := range scores {
+		fused = append(fused, scoredPoint{point: p, score: sc})
+	}
+	sort.Slice(fused, func(i, j int) bool { return fused[i].point.id < fused[j].point.id })
+	return fused
+}
+
+// truncate limits a ranking to n entries.
+func truncate(ranking []scoredPoint, n int) []scoredPoint {
+	if len(ranking) > n {
+		return ranking[:n]
+	}
+	return ranking
+}
+
+// contentOf returns the content payload of a point.
+func contentOf(p *point) string {
+	content, _ := p.payload[vectorstore.PayloadContent].(string)
+	return content
+}
+
+// tokenize lowercases text and splits it on anything that is not a letter
+// or digit, so SKUs like "AB-1234" yield "ab" and "1234".
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,174 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// hybridPoints are ranked a, b, c by the dense query [1, 0], and c, b by
+// the sparse query {1: 1}; a has no sparse vector.
+var hybridPoints = []vectorstore.Point{
+	{ID: "a", Vector: []float32{1, 0}},
+	{ID: "b", Vector: []float32{0.8, 0.6}, Sparse: &vectorstore.SparseVector{Indices: []uint32{1}, Values: []float32{2}}},
+	{ID: "c", Vector: []float32{0, 1}, Sparse: &vectorstore.SparseVector{Indices: []uint32{1, 2}, Values: []float32{3, 1}}},
+}
+
+// hybridQuery is the dense and sparse query of hybridPoints.
+var hybridQuery = vectorstore.HybridQuery{
+	Dense:  []float32{1, 0},
+	Sparse: &vectorstore.SparseVector{Indices: []uint32{1}, Values: []float32{1}},
+}
+
+// checkScores fails unless results are the IDs in want, in order, with
+// scores within 1e-4 of scores.
+func checkScores(t *testing.T, results []vectorstore.SearchResult, want []string, scores []float64) {
+	t.Helper()
+	if got := resultIDs(results); !slices.Equal(got, want) {
+		t.Fatalf("results = %v, want %v", got, want)
+	}
+	for i, r := range results {
+		if math.Abs(float64(r.Score)-scores[i]) > 1e-4 {
+			t.Errorf("%s score = %v, want %v", r.ID, r.Score, scores[i])
+		}
+	}
+}
+
+func TestHybridSearchRRF(t *testing.T) {
+	s := newTestStore(t, vectorstore.DistanceCosine, hybridPoints...)
+	results, err := s.HybridSearch(context.Background(), hybridQuery, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// With rrfK = 2, ranks 1, 2 and 3 score 1/3, 1/4 and 1/5
+	checkScores(t, results, []string{"c", "b", "a"}, []float64{1.0/5 + 1.0/3, 1.0/4 + 1.0/4, 1.0 / 3})
+
+	// Fusion is the default
+	query := hybridQuery
+	query.Fusion = vectorstore.FusionRRF
+	explicit, err := s.HybridSearch(context.Background(), query, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resultIDs(explicit), resultIDs(results)) {
+		t.Errorf("FusionRRF results = %v, want %v", resultIDs(explicit), resultIDs(results))
+	}
+
+	// The limit applies after fusion, the prefetch limit to each ranking
+	query.PrefetchLimit = 1
+	limited, err := s.HybridSearch(context.Background(), query, vectorstore.SearchFilter{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScores(t, limited, []string{"a"}, []float64{1.0 / 3}) // a and c tie on 1/3, broken by ID
+}
+
+func TestHybridSearchDBSF(t *testing.T) {
+	s := newTestStore(t, vectorstore.DistanceCosine, hybridPoints...)
+	query := hybridQuery
+	query.Fusion = vectorstore.FusionDBSF
+	results, err := s.HybridSearch(context.Background(), query, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Dense scores 1, 0.8, 0 normalize over 0.6 +/- 3*0.4320 to 0.6543,
+	// 0.5772, 0.2685; sparse scores 3, 2 over 2.5 +/- 1.5 to 0.6667, 0.3333
+	checkScores(t, results, []string{"c", "b", "a"}, []float64{0.2685 + 0.6667, 0.5772 + 0.3333, 0.6543})
+
+	if _, err := s.HybridSearch(context.Background(), vectorstore.HybridQuery{Dense: []float32{1, 0}, Fusion: "max"},
+		vectorstore.SearchFilter{}, 10); err == nil {
+		t.Error("unsupported fusion accepted")
+	}
+}
+
+func TestFuseDBSF(t *testing.T) {
+	a, b, c := &point{id: "a"}, &point{id: "b"}, &point{id: "c"}
+	scores := func(fused []scoredPoint) map[string]float32 {
+		m := make(map[string]float32)
+		for _, sp := range fused {
+			m[sp.point.id] = sp.score
+		}
+		return m
+	}
+
+	// Equal scores have no spread, and all normalize to 0.5
+	fused := scores(fuseDBSF([][]scoredPoint{{{a, 7}, {b, 7}, {c, 7}}}, false))
+	for id, score := range fused {
+		if score != 0.5 {
+			t.Errorf("%s score = %v, want 0.5", id, score)
+		}
+	}
+
+	// Distances are inverted: the closest point scores highest
+	fused = scores(fuseDBSF([][]scoredPoint{{{a, 0}, {b, 1}, {c, 2}}}, true))
+	if !(fused["a"] > fused["b"] && fused["b"] > fused["c"]) {
+		t.Errorf("scores = %v, want a > b > c", fused)
+	}
+	// Only the first ranking holds distances
+	fused = scores(fuseDBSF([][]scoredPoint{{}, {{a, 0}, {b, 1}, {c, 2}}}, true))
+	if !(fused["c"] > fused["b"] && fused["b"] > fused["a"]) {
+		t.Errorf("scores = %v, want c > b > a", fused)
+	}
+}
+
+func TestHybridSearchBM25(t *testing.T) {
+	s := New()
+	err := s.Upsert(context.Background(), []vectorstore.Point{
+		{ID: "p1", Content: "red shoes"},
+		{ID: "p2", Content: "Red, red and red hat"},
+		{ID: "p3", Content: "a blue hat with a much longer description"},
+		{ID: "p4", Content: "green scarf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.HybridSearch(context.Background(), vectorstore.HybridQuery{Text: "RED hat!"}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// p2 has both terms; p1 and p3 one each, p3 in a longer text; p4 none.
+	// Text-only results are ranked by RRF of the BM25 ranking.
+	checkScores(t, results, []string{"p2", "p1", "p3"}, []float64{1.0 / 3, 1.0 / 4, 1.0 / 5})
+
+	// Text without terms matches nothing
+	if results, err = s.HybridSearch(context.Background(), vectorstore.HybridQuery{Text: "?!"}, vectorstore.SearchFilter{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 0 {
+		t.Errorf("results = %v, want none", resultIDs(results))
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	if got, want := tokenize("SKU AB-1234, Größe 42!"), []string{"sku", "ab", "1234", "größe", "42"}; !slices.Equal(got, want) {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestHybridSearchSparseOnly(t *testing.T) {
+	s := newTestStore(t, vectorstore.DistanceCosine, hybridPoints...)
+	query := vectorstore.HybridQuery{Sparse: &vectorstore.SparseVector{Indices: []uint32{2}, Values: []float32{1}}}
+	results, err := s.HybridSearch(context.Background(), query, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only points sharing an index with the query are returned
+	checkScores(t, results, []string{"c"}, []float64{1.0 / 3})
+
+	query.Sparse = &vectorstore.SparseVector{Indices: []uint32{1, 1}, Values: []float32{1, 2}}
+	if _, err := s.HybridSearch(context.Background(), query, vectorstore.SearchFilter{}, 10); err == nil {
+		t.Error("sparse query with a duplicate index accepted")
+	}
+}
+
+func TestHybridSearchEmptyQuery(t *testing.T) {
+	s := newTestStore(t, vectorstore.DistanceCosine, hybridPoints...)
+	if _, err := s.HybridSearch(context.Background(), vectorstore.HybridQuery{}, vectorstore.SearchFilter{}, 10); !errors.Is(err, vectorstore.ErrEmptyQuery) {
+		t.Errorf("HybridSearch(empty) = %v, want ErrEmptyQuery", err)
+	}
+}
@@ -0,0 +1,302 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// defaultLimit matches Qdrant's default result count.
+const defaultLimit = 10
+
+// Store implements vectorstore.VectorStore using brute-force search over an
+// in-memory map. It follows the same payload and filter semantics as the
+// Qdrant driver, so it can be used as a drop-in fake in tests.
+type Store struct {
+	mu     sync.RWMutex
+	cfg    vectorstore.CollectionConfig
+	points map[string]*point
+}
+
+// point is a stored vector with its normalized payload.
+type point struct {
+	id      string
+	vector  []float32
+	sparse  map[uint32]float32
+	payload map[string]any
+}
+
+// New creates a new in-memory vector store using cosine similarity.
+// The dimension is not enforced until EnsureCollection is called.
+func New() *Store {
+	return &Store{
+		cfg:    vectorstore.CollectionConfig{Distance: vectorstore.DistanceCosine},
+		points: make(map[string]*point),
+	}
+}
+
+// Search implements vectorstore.VectorStore.
+func (s *Store) Search(ctx context.Context, vector []float32, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.checkDimension(vector); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	match, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	scored := make([]scoredPoint, 0, len(s.points))
+	for _, p := range s.points {
+		if !match(p.payload) {
+			continue
+		}
+		if len(p.vector) != len(vector) {
+			return nil, fmt.Errorf("%w: point %s has %d, query has %d", vectorstore.ErrInvalidDimension, p.id, len(p.vector), len(vector))
+		}
+		scored = append(scored, scoredPoint{point: p, score: score(s.cfg.Distance, vector, p.vector)})
+	}
+
+	sortScored(scored, s.cfg.Distance)
+	if len(scored) > limit {
+		scored = scored[:limit]
+	}
+
+	results := make([]vectorstore.SearchResult, 0, len(scored))
+	for _, sp := range scored {
+		// Same post-limit threshold as the Qdrant driver
+		if filter.MinScore > 0 && sp.score < filter.MinScore {
+			continue
+		}
+		results = append(results, toResult(sp))
+	}
+
+	return results, nil
+}
+
+// Upsert implements vectorstore.VectorStore.
+func (s *Store) Upsert(ctx context.Context, points []vectorstore.Point) error {
+	stored := make([]*point, 0, len(points))
+	for _, p := range points {
+		payload, err := buildPayload(p)
+		if err != nil {
+			return fmt.Errorf("invalid payload for point %s: %w", p.ID, err)
+		}
+		vector := make([]float32, len(p.Vector))
+		copy(vector, p.Vector)
+		sparse, err := buildSparse(p.Sparse)
+		if err != nil {
+			return fmt.Errorf("invalid sparse vector for point %s: %w", p.ID, err)
+		}
+		stored = append(stored, &point{id: p.ID, vector: vector, sparse: sparse, payload: payload})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range stored {
+		if err := s.checkDimension(p.vector); err != nil {
+			return err
+		}
+	}
+	for _, p := range stored {
+		s.points[p.id] = p
+	}
+	return nil
+}
+
+// Delete implements vectorstore.VectorStore.
+func (s *Store) Delete(ctx context.Context, ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		delete(s.points, id)
+	}
+	return nil
+}
+
+// DeleteByFilter implements vectorstore.VectorStore.
+func (s *Store) DeleteByFilter(ctx context.Context, filter vectorstore.SearchFilter) error {
+	if filter.IsEmpty() {
+		return vectorstore.ErrEmptyFilter
+	}
+
+	match, err := compileFilter(filter)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, p := range s.points {
+		if match(p.payload) {
+			delete(s.points, id)
+		}
+	}
+	return nil
+}
+
+// EnsureCollection implements vectorstore.VectorStore.
+// The configuration is only applied if no dimension has been set yet.
+func (s *Store) EnsureCollection(ctx context.Context, cfg vectorstore.CollectionConfig) error {
+	if cfg.Dimension <= 0 {
+		return vectorstore.ErrInvalidDimension
+	}
+	switch cfg.Distance {
+	case "":
+		cfg.Distance = vectorstore.DistanceCosine
+	case vectorstore.DistanceCosine, vectorstore.DistanceDot, vectorstore.DistanceEuclidean:
+	default:
+		return fmt.Errorf("unsupported distance: %s", cfg.Distance)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cfg.Dimension == 0 {
+		s.cfg = cfg
+	}
+	return nil
+}
+
+// DeleteCollection implements vectorstore.VectorStore.
+func (s *Store) DeleteCollection(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg = vectorstore.CollectionConfig{Distance: vectorstore.DistanceCosine}
+	s.points = make(map[string]*point)
+	return nil
+}
+
+// Close implements vectorstore.VectorStore.
+func (s *Store) Close() error {
+	return nil
+}
+
+// checkDimension verifies a vector against the configured dimension.
+func (s *Store) checkDimension(vector []float32) error {
+	if s.cfg.Dimension > 0 && len(vector) != s.cfg.Dimension {
+		return fmt.Errorf("%w: expected %d, got %d", vectorstore.ErrInvalidDimension, s.cfg.Dimension, len(vector))
+	}
+	return nil
+}
+
+// scoredPoint pairs a stored point with its similarity score.
+type scoredPoint struct {
+	point *point
+	score float32
+}
+
+// score computes the similarity between two vectors.
+// Like Qdrant, euclidean returns the distance itself (lower is closer).
+func score(distance vectorstore.Distance, a, b []float32) float32 {
+	switch distance {
+	case vectorstore.DistanceDot:
+		return dot(a, b)
+	case vectorstore.DistanceEuclidean:
+		var sum float64
+		for i := range a {
+			d := float64(a[i]) - float64(b[i])
+			sum += d * d
+		}
+		return float32(math.Sqrt(sum))
+	default:
+		na, nb := norm(a), norm(b)
+		if na == 0 || nb == 0 {
+			return 0
+		}
+		return float32(float64(dot(a, b)) / (na * nb))
+	}
+}
+
+func dot(a, b []float32) float32 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return float32(sum)
+}
+
+func norm(v []float32) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	return math.Sqrt(sum)
+}
+
+// sortScored orders points best first, breaking ties by ID.
+func sortScored(scored []scoredPoint, distance vectorstore.Distance) {
+	ascending := distance == vectorstore.DistanceEuclidean
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].score != scored[j].score {
+			if ascending {
+				return scored[i].score < scored[j].score
+			}
+			return scored[i].score > scored[j].score
+		}
+		return scored[i].point.id < scored[j].point.id
+	})
+}
+
+// buildPayload converts a point to its normalized payload, using the same
+// top-level layout as the Qdrant driver.
+func buildPayload(p vectorstore.Point) (map[string]any, error) {
+	payload, err := vectorstore.NormalizeMetadata(p.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	payload[vectorstore.PayloadContent] = p.Content
+	if p.SourceID != "" {
+		payload[vectorstore.PayloadSourceID] = p.SourceID
+	}
+	if p.DocumentID != "" {
+		payload[vectorstore.PayloadDocumentID] = p.DocumentID
+	}
+	return payload, nil
+}
+
+// toResult converts a scored point to a SearchResult.
+// Metadata is copied so callers cannot mutate stored payloads.
+func toResult(sp scoredPoint) vectorstore.SearchResult {
+	result := vectorstore.SearchResult{
+		ID:       sp.point.id,
+		Score:    sp.score,
+		Metadata: make(map[string]any),
+	}
+
+	for k, v := range sp.point.payload {
+		switch k {
+		case vectorstore.PayloadContent:
+			result.Content, _ = v.(string)
+		case vectorstore.PayloadSourceID:
+			result.SourceID, _ = v.(string)
+		case vectorstore.PayloadDocumentID:
+			result.DocumentID, _ = v.(string)
+		default:
+			// Payload values are already normalized, so this only copies
+			result.Metadata[k], _ = vectorstore.NormalizeValue(v)
+		}
+	}
+
+	return result
+}
+
+// Compile-time checks that Store implements VectorStore and HybridSearcher.
+var (
+	_ vectorstore.VectorStore    = (*Store)(nil)
+	_ vectorstore.HybridSearcher = (*Store)(nil)
+)
@@ -0,0 +1,229 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// newTestStore returns a store of 2-dimensional vectors with distance,
+// holding points.
+func newTestStore(t *testing.T, distance vectorstore.Distance, points ...vectorstore.Point) *Store {
+	t.Helper()
+	s := New()
+	if err := s.EnsureCollection(context.Background(), vectorstore.CollectionConfig{Dimension: 2, Distance: distance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(context.Background(), points); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// resultIDs returns the IDs of results, in order.
+func resultIDs(results []vectorstore.SearchResult) []string {
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	return ids
+}
+
+func TestSearchDistances(t *testing.T) {
+	// a points the same way as the query, b is longer but at 45 degrees
+	points := []vectorstore.Point{
+		{ID: "a", Vector: []float32{1, 0}},
+		{ID: "b", Vector: []float32{3, 3}},
+		{ID: "c", Vector: []float32{0, 1}},
+	}
+	tests := []struct {
+		distance vectorstore.Distance
+		want     []string
+		scores   []float32
+	}{
+		{vectorstore.DistanceCosine, []string{"a", "b", "c"}, []float32{1, 0.70710677, 0}},
+		{vectorstore.DistanceDot, []string{"b", "a", "c"}, []float32{3, 1, 0}},
+		// Euclidean scores are distances, closest first
+		{vectorstore.DistanceEuclidean, []string{"a", "c", "b"}, []float32{0, 1.4142135, 3.6055512}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.distance), func(t *testing.T) {
+			s := newTestStore(t, tt.distance, points...)
+			results, err := s.Search(context.Background(), []float32{1, 0}, vectorstore.SearchFilter{}, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultIDs(results); !slices.Equal(got, tt.want) {
+				t.Fatalf("Search = %v, want %v", got, tt.want)
+			}
+			for i, r := range results {
+				if r.Score != tt.scores[i] {
+					t.Errorf("%s score = %v, want %v", r.ID, r.Score, tt.scores[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchLimitAndMinScore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, vectorstore.DistanceCosine,
+		vectorstore.Point{ID: "a", Vector: []float32{1, 0}},
+		vectorstore.Point{ID: "b", Vector: []float32{1, 1}},
+		vectorstore.Point{ID: "c", Vector: []float32{0, 1}},
+	)
+
+	results, err := s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Search with limit 2 = %v, want [a b]", got)
+	}
+
+	// A zero limit uses the default
+	if results, err = s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Search with limit 0 = %d results, want 3", len(results))
+	}
+
+	if results, err = s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{MinScore: 0.5}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Search with MinScore 0.5 = %v, want [a b]", got)
+	}
+
+	// MinScore applies after the limit, as in the Qdrant driver
+	if results, err = s.Search(ctx, []float32{0, 1}, vectorstore.SearchFilter{MinScore: 0.5}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("Search with limit 1 and MinScore 0.5 = %v, want [c]", got)
+	}
+}
+
+func TestDimensionMismatch(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, vectorstore.DistanceCosine, vectorstore.Point{ID: "a", Vector: []float32{1, 0}})
+
+	// No point of a batch is stored if one has the wrong dimension
+	err := s.Upsert(ctx, []vectorstore.Point{
+		{ID: "b", Vector: []float32{0, 1}},
+		{ID: "c", Vector: []float32{1, 2, 3}},
+	})
+	if !errors.Is(err, vectorstore.ErrInvalidDimension) {
+		t.Errorf("Upsert with 3 dimensions = %v, want ErrInvalidDimension", err)
+	}
+	if len(s.points) != 1 {
+		t.Errorf("%d points stored, want 1", len(s.points))
+	}
+
+	if _, err := s.Search(ctx, []float32{1, 2, 3}, vectorstore.SearchFilter{}, 10); !errors.Is(err, vectorstore.ErrInvalidDimension) {
+		t.Errorf("Search with 3 dimensions = %v, want ErrInvalidDimension", err)
+	}
+
+	// The first configuration is kept
+	if err := s.EnsureCollection(ctx, vectorstore.CollectionConfig{Dimension: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(ctx, []vectorstore.Point{{ID: "c", Vector: []float32{1, 2, 3}}}); !errors.Is(err, vectorstore.ErrInvalidDimension) {
+		t.Errorf("Upsert after a second EnsureCollection = %v, want ErrInvalidDimension", err)
+	}
+
+	if err := s.EnsureCollection(ctx, vectorstore.CollectionConfig{}); !errors.Is(err, vectorstore.ErrInvalidDimension) {
+		t.Errorf("EnsureCollection without dimension = %v, want ErrInvalidDimension", err)
+	}
+}
+
+func TestUpsertOverwrites(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, vectorstore.DistanceCosine,
+		vectorstore.Point{ID: "a", Vector: []float32{1, 0}, Content: "old", Metadata: map[string]any{"lang": "en"}})
+	if err := s.Upsert(ctx, []vectorstore.Point{{ID: "a", Vector: []float32{0, 1}, Content: "new"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Search(ctx, []float32{0, 1}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Search = %d results, want 1", len(results))
+	}
+	// The whole point is replaced, metadata included
+	if r := results[0]; r.Content != "new" || r.Score != 1 || len(r.Metadata) != 0 {
+		t.Errorf("Search = %+v, want the new point", r)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, vectorstore.DistanceCosine,
+		vectorstore.Point{ID: "a", Vector: []float32{1, 0}, SourceID: "s1"},
+		vectorstore.Point{ID: "b", Vector: []float32{1, 0}, SourceID: "s1"},
+		vectorstore.Point{ID: "c", Vector: []float32{1, 0}, SourceID: "s2"},
+		vectorstore.Point{ID: "d", Vector: []float32{1, 0}, SourceID: "s2"},
+	)
+
+	// Missing IDs are ignored
+	if err := s.Delete(ctx, []string{"a", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteByFilter(ctx, vectorstore.SearchFilter{SourceID: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteByFilter(ctx, vectorstore.SearchFilter{}); !errors.Is(err, vectorstore.ErrEmptyFilter) {
+		t.Errorf("DeleteByFilter(empty) = %v, want ErrEmptyFilter", err)
+	}
+
+	results, err := s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultIDs(results); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Search after deleting = %v, want [b]", got)
+	}
+}
+
+func TestResultsAreCopies(t *testing.T) {
+	ctx := context.Background()
+	vector := []float32{1, 0}
+	metadata := map[string]any{"tags": []string{"a"}, "author": map[string]any{"name": "x"}}
+	s := newTestStore(t, vectorstore.DistanceCosine, vectorstore.Point{ID: "a", Vector: vector, Metadata: metadata})
+
+	// Changing the upserted point does not change the stored one
+	vector[0], vector[1] = 0, 1
+	metadata["tags"].([]string)[0] = "changed"
+	metadata["lang"] = "en"
+
+	results, err := s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := results[0]
+	if r.Score != 1 {
+		t.Errorf("score = %v, want 1 for the vector as upserted", r.Score)
+	}
+	if _, ok := r.Metadata["lang"]; ok || r.Metadata["tags"].([]any)[0] != "a" {
+		t.Errorf("metadata = %v, want it as upserted", r.Metadata)
+	}
+
+	// Neither does changing a result
+	r.Metadata["tags"].([]any)[0] = "changed"
+	r.Metadata["author"].(map[string]any)["name"] = "changed"
+	delete(r.Metadata, "tags")
+
+	if results, err = s.Search(ctx, []float32{1, 0}, vectorstore.SearchFilter{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	r = results[0]
+	if tags, ok := r.Metadata["tags"].([]any); !ok || tags[0] != "a" || r.Metadata["author"].(map[string]any)["name"] != "x" {
+		t.Errorf("metadata = %v, want it as upserted", r.Metadata)
+	}
+}
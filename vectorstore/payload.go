@@ -0,0 +1,91 @@
+package vectorstore
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// TimeFormat is the layout used to store time.Time payload values: RFC 3339
+// in UTC with fixed microsecond precision, so stored timestamps also sort
+// correctly as strings.
+const TimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// NormalizeValue converts a metadata value to the canonical form returned in
+// SearchResult.Metadata: nil, bool, int64, float64, string, []any or
+// map[string]any. Typed slices and maps are converted element by element and
+// time.Time is formatted with TimeFormat.
+// Returns an error for values that cannot be stored as payload.
+func NormalizeValue(v any) (any, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, nil
+	case bool, int64, float64, string:
+		return val, nil
+	case time.Time:
+		return val.UTC().Format(TimeFormat), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Slice, reflect.Array:
+		list := make([]any, rv.Len())
+		for i := range list {
+			item, err := NormalizeValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type: %s", rv.Type().Key())
+		}
+		fields := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			item, err := NormalizeValue(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			fields[iter.Key().String()] = item
+		}
+		return fields, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, nil
+		}
+		return NormalizeValue(rv.Elem().Interface())
+	default:
+		return nil, fmt.Errorf("unsupported value type: %T", v)
+	}
+}
+
+// NormalizeMetadata applies NormalizeValue to every entry of a metadata map.
+// Entries using a reserved payload key (content, source_id, document_id)
+// are dropped so they cannot shadow the Point fields.
+func NormalizeMetadata(metadata map[string]any) (map[string]any, error) {
+	normalized := make(map[string]any, len(metadata))
+	for k, v := range metadata {
+		if k == PayloadContent || k == PayloadSourceID || k == PayloadDocumentID {
+			continue
+		}
+		value, err := NormalizeValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("metadata %q: %w", k, err)
+		}
+		normalized[k] = value
+	}
+	return normalized, nil
+}
@@ -0,0 +1,403 @@
+package pgvector
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// defaultTable is used when Config.Table is empty.
+const defaultTable = "vector_chunks"
+
+// Config holds pgvector configuration.
+type Config struct {
+	// DB is an open connection to a Postgres database with the pgvector
+	// extension available (e.g. the Supabase database). Any database/sql
+	// driver works, such as github.com/jackc/pgx/v5/stdlib.
+	// The connection is owned by the caller and is not closed by Close.
+	DB *sql.DB
+
+	// Table is the (optionally schema-qualified) table holding the chunks.
+	// Default: "vector_chunks".
+	Table string
+
+	// Distance is the similarity function used by Search (default: cosine).
+	Distance vectorstore.Distance
+}
+
+// Client implements vectorstore.VectorStore on top of Postgres and pgvector.
+type Client struct {
+	db       *sql.DB
+	table    string
+	name     string
+	distance vectorstore.Distance
+}
+
+// New creates a new pgvector client.
+func New(cfg Config) (*Client, error) {
+	if cfg.DB == nil {
+		return nil, fmt.Errorf("pgvector db is required")
+	}
+	if cfg.Table == "" {
+		cfg.Table = defaultTable
+	}
+
+	switch cfg.Distance {
+	case "":
+		cfg.Distance = vectorstore.DistanceCosine
+	case vectorstore.DistanceCosine, vectorstore.DistanceDot, vectorstore.DistanceEuclidean:
+	default:
+		return nil, fmt.Errorf("unsupported distance: %s", cfg.Distance)
+	}
+
+	parts := strings.Split(cfg.Table, ".")
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid table name: %q", cfg.Table)
+		}
+		quoted[i] = quoteIdent(part)
+	}
+
+	return &Client{
+		db:       cfg.DB,
+		table:    strings.Join(quoted, "."),
+		name:     parts[len(parts)-1],
+		distance: cfg.Distance,
+	}, nil
+}
+
+// Search implements vectorstore.VectorStore.
+func (c *Client) Search(ctx context.Context, vector []float32, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	q := &query{}
+	vec := q.arg(formatVector(vector))
+	distanceExpr := fmt.Sprintf("embedding %s %s::vector", c.operator(), vec)
+	where, err := buildWhere(q, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := fmt.Sprintf(
+		"SELECT id, content, source_id, document_id, metadata, %s AS score FROM %s%s ORDER BY %s LIMIT %d",
+		c.scoreExpr(distanceExpr), c.table, where, distanceExpr, limit,
+	)
+
+	rows, err := c.db.QueryContext(ctx, stmt, q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("pgvector search failed: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]vectorstore.SearchResult, 0, limit)
+	for rows.Next() {
+		var (
+			result     vectorstore.SearchResult
+			sourceID   sql.NullString
+			documentID sql.NullString
+			metadata   []byte
+			score      float64
+		)
+		if err := rows.Scan(&result.ID, &result.Content, &sourceID, &documentID, &metadata, &score); err != nil {
+			return nil, fmt.Errorf("pgvector scan failed: %w", err)
+		}
+
+		result.Score = float32(score)
+
+		// Apply min score filter
+		if filter.MinScore > 0 && result.Score < filter.MinScore {
+			continue
+		}
+
+		result.SourceID = sourceID.String
+		result.DocumentID = documentID.String
+		result.Metadata, err = decodeMetadata(metadata)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata for %s: %w", result.ID, err)
+		}
+
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("pgvector search failed: %w", err)
+	}
+
+	return results, nil
+}
+
+// Upsert implements vectorstore.VectorStore.
+func (c *Client) Upsert(ctx context.Context, points []vectorstore.Point) (err error) {
+	if len(points) == 0 {
+		return nil
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("pgvector begin failed: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		`INSERT INTO %s (id, embedding, content, source_id, document_id, metadata)
+VALUES ($1, $2::vector, $3, $4, $5, $6::jsonb)
+ON CONFLICT (id) DO UPDATE SET
+	embedding = EXCLUDED.embedding,
+	content = EXCLUDED.content,
+	source_id = EXCLUDED.source_id,
+	document_id = EXCLUDED.document_id,
+	metadata = EXCLUDED.metadata`, c.table))
+	if err != nil {
+		return fmt.Errorf("pgvector prepare failed: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		metadata, err := vectorstore.NormalizeMetadata(p.Metadata)
+		if err != nil {
+			return fmt.Errorf("invalid payload for point %s: %w", p.ID, err)
+		}
+		metadataJSON, err := json.Marshal(metadata)
+		if err != nil {
+			return fmt.Errorf("invalid payload for point %s: %w", p.ID, err)
+		}
+
+		_, err = stmt.ExecContext(ctx,
+			p.ID,
+			formatVector(p.Vector),
+			p.Content,
+			nullString(p.SourceID),
+			nullString(p.DocumentID),
+			string(metadataJSON),
+		)
+		if err != nil {
+			return fmt.Errorf("pgvector upsert failed: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("pgvector commit failed: %w", err)
+	}
+	return nil
+}
+
+// Delete implements vectorstore.VectorStore.
+func (c *Client) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	q := &query{}
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", c.table, q.list(ids))
+	if _, err := c.db.ExecContext(ctx, stmt, q.args...); err != nil {
+		return fmt.Errorf("pgvector delete failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteByFilter implements vectorstore.VectorStore.
+func (c *Client) DeleteByFilter(ctx context.Context, filter vectorstore.SearchFilter) error {
+	q := &query{}
+	where, err := buildWhere(q, filter)
+	if err != nil {
+		return err
+	}
+	if where == "" {
+		return vectorstore.ErrEmptyFilter
+	}
+
+	stmt := fmt.Sprintf("DELETE FROM %s%s", c.table, where)
+	if _, err := c.db.ExecContext(ctx, stmt, q.args...); err != nil {
+		return fmt.Errorf("pgvector delete by filter failed: %w", err)
+	}
+	return nil
+}
+
+// EnsureCollection implements vectorstore.VectorStore.
+// Creates the vector extension, the table, B-tree indexes on source_id and
+// document_id, and an HNSW index for the configured distance.
+// cfg.Distance must be empty or match Config.Distance.
+func (c *Client) EnsureCollection(ctx context.Context, cfg vectorstore.CollectionConfig) error {
+	if cfg.Dimension <= 0 {
+		return vectorstore.ErrInvalidDimension
+	}
+	if cfg.Distance != "" && cfg.Distance != c.distance {
+		return fmt.Errorf("distance %s does not match client distance %s", cfg.Distance, c.distance)
+	}
+
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id text PRIMARY KEY,
+	embedding vector(%d) NOT NULL,
+	content text NOT NULL DEFAULT '',
+	source_id text,
+	document_id text,
+	metadata jsonb NOT NULL DEFAULT '{}'::jsonb
+)`, c.table, cfg.Dimension),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (source_id)", quoteIdent(c.name+"_source_id_idx"), c.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (document_id)", quoteIdent(c.name+"_document_id_idx"), c.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (embedding %s)", quoteIdent(c.name+"_embedding_idx"), c.table, c.opclass()),
+	}
+
+	for _, stmt := range statements {
+		if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("pgvector ensure collection failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// DeleteCollection implements vectorstore.VectorStore.
+func (c *Client) DeleteCollection(ctx context.Context) error {
+	if _, err := c.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+c.table); err != nil {
+		return fmt.Errorf("pgvector delete collection failed: %w", err)
+	}
+	return nil
+}
+
+// Close implements vectorstore.VectorStore.
+// The underlying *sql.DB is owned by the caller and left open.
+func (c *Client) Close() error {
+	return nil
+}
+
+// operator returns the pgvector distance operator for the configured distance.
+func (c *Client) operator() string {
+	switch c.distance {
+	case vectorstore.DistanceDot:
+		return "<#>"
+	case vectorstore.DistanceEuclidean:
+		return "<->"
+	default:
+		return "<=>"
+	}
+}
+
+// opclass returns the HNSW operator class for the configured distance.
+func (c *Client) opclass() string {
+	switch c.distance {
+	case vectorstore.DistanceDot:
+		return "vector_ip_ops"
+	case vectorstore.DistanceEuclidean:
+		return "vector_l2_ops"
+	default:
+		return "vector_cosine_ops"
+	}
+}
+
+// scoreExpr converts a pgvector distance into the score Qdrant would report:
+// cosine similarity, raw dot product, or euclidean distance.
+func (c *Client) scoreExpr(distanceExpr string) string {
+	switch c.distance {
+	case vectorstore.DistanceDot:
+		return fmt.Sprintf("(%s) * -1", distanceExpr)
+	case vectorstore.DistanceEuclidean:
+		return distanceExpr
+	default:
+		return fmt.Sprintf("1 - (%s)", distanceExpr)
+	}
+}
+
+// query accumulates positional arguments for a statement.
+type query struct {
+	args []any
+}
+
+// arg appends an argument and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// list appends each value as an argument and returns a comma-separated
+// placeholder list, avoiding driver-specific array types.
+func (q *query) list(values []string) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = q.arg(v)
+	}
+	return strings.Join(placeholders, ", ")
+}
+
+// formatVector renders a vector in pgvector's text format.
+func formatVector(vector []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range vector {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// decodeMetadata decodes a JSONB payload, keeping integers as int64 like the
+// Qdrant driver does.
+func decodeMetadata(raw []byte) (map[string]any, error) {
+	metadata := make(map[string]any)
+	if len(raw) == 0 {
+		return metadata, nil
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	var decoded map[string]any
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	for k, v := range decoded {
+		metadata[k] = convertNumbers(v)
+	}
+	return metadata, nil
+}
+
+// convertNumbers replaces json.Number with int64 or float64.
+func convertNumbers(v any) any {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case []any:
+		for i, item := range val {
+			val[i] = convertNumbers(item)
+		}
+		return val
+	case map[string]any:
+		for k, item := range val {
+			val[k] = convertNumbers(item)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// nullString maps an empty string to NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// quoteIdent quotes a Postgres identifier.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Compile-time check that Client implements VectorStore.
+var _ vectorstore.VectorStore = (*Client)(nil)
@@ -0,0 +1,263 @@
+package pgvector
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+
+	"github.com/creastat/storage/vectorstore"
+	"github.com/creastat/storage/vectorstore/memory"
+)
+
+// openTestDB opens the database in TEST_DATABASE_URL, which must have the
+// pgvector extension available (e.g. the pgvector/pgvector container), or
+// skips the test.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("ping test database: %v", err)
+	}
+	return db
+}
+
+// newTestClient returns a client on a fresh 3-dimensional table, dropped
+// when the test ends.
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	db := openTestDB(t)
+	c, err := New(Config{DB: db, Table: fmt.Sprintf("vector_chunks_test_%d", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := c.EnsureCollection(ctx, vectorstore.CollectionConfig{Dimension: 3}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := c.DeleteCollection(context.Background()); err != nil {
+			t.Errorf("DeleteCollection: %v", err)
+		}
+	})
+	return c
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Config{}); err == nil {
+		t.Error("New without DB: expected an error")
+	}
+	db := &sql.DB{}
+	if _, err := New(Config{DB: db, Distance: "manhattan"}); err == nil {
+		t.Error("New with unknown distance: expected an error")
+	}
+	if _, err := New(Config{DB: db, Table: "public..chunks"}); err == nil {
+		t.Error("New with empty table name part: expected an error")
+	}
+
+	c, err := New(Config{DB: db, Table: `public.my"chunks`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `"public"."my""chunks"`; c.table != want {
+		t.Errorf("table = %s, want %s", c.table, want)
+	}
+	if c.distance != vectorstore.DistanceCosine {
+		t.Errorf("distance = %s, want cosine", c.distance)
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	points := []vectorstore.Point{
+		{ID: "a", Vector: []float32{1, 0, 0}, Content: "alpha", SourceID: "s1", DocumentID: "d1", Metadata: map[string]any{"lang": "en", "page": 1}},
+		{ID: "b", Vector: []float32{0, 1, 0}, Content: "beta", SourceID: "s1", DocumentID: "d2", Metadata: map[string]any{"lang": "de", "page": 2}},
+		{ID: "c", Vector: []float32{0, 0, 1}, Content: "gamma", SourceID: "s2", DocumentID: "d3", Metadata: map[string]any{"lang": "en", "page": 3}},
+	}
+	if err := c.Upsert(ctx, points); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := c.Search(ctx, []float32{1, 0.1, 0}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].ID != "a" {
+		t.Fatalf("Search = %v, want a first of 3", ids(results))
+	}
+	if results[0].Content != "alpha" || results[0].SourceID != "s1" || results[0].DocumentID != "d1" {
+		t.Errorf("Search result fields = %+v", results[0])
+	}
+	if page, ok := results[0].Metadata["page"].(int64); !ok || page != 1 {
+		t.Errorf("Search metadata page = %#v, want int64(1)", results[0].Metadata["page"])
+	}
+	if results[0].Score < 0.99 {
+		t.Errorf("Search score = %v, want cosine similarity close to 1", results[0].Score)
+	}
+
+	results, err = c.Search(ctx, []float32{1, 0, 0}, vectorstore.SearchFilter{
+		SourceIDs: []string{"s1"},
+		Metadata:  map[string]any{"lang": "de"},
+	}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(results); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Search with filter = %v, want [b]", got)
+	}
+
+	// Upsert replaces by ID
+	points[1].Content = "beta v2"
+	if err := c.Upsert(ctx, points[1:2]); err != nil {
+		t.Fatal(err)
+	}
+	results, err = c.Search(ctx, []float32{0, 1, 0}, vectorstore.SearchFilter{DocumentIDs: []string{"d2"}}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Content != "beta v2" {
+		t.Errorf("Search after replace = %+v", results)
+	}
+
+	if err := c.Delete(ctx, []string{"a", "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DeleteByFilter(ctx, vectorstore.SearchFilter{}); !errors.Is(err, vectorstore.ErrEmptyFilter) {
+		t.Errorf("DeleteByFilter with empty filter = %v, want ErrEmptyFilter", err)
+	}
+	if err := c.DeleteByFilter(ctx, vectorstore.SearchFilter{SourceID: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	results, err = c.Search(ctx, []float32{1, 1, 1}, vectorstore.SearchFilter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(results); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Search after deletes = %v, want [b]", got)
+	}
+}
+
+// filterPoints are shared by the filter tests; every point has the same
+// vector so only the filter decides what matches.
+var filterPoints = []vectorstore.Point{
+	{ID: "1", SourceID: "s1", Metadata: map[string]any{"lang": "en", "year": 2023, "score": 0.5, "tags": []string{"a", "b"}}},
+	{ID: "2", SourceID: "s1", Metadata: map[string]any{"lang": "de", "year": 2024, "score": 1.5, "author": map[string]any{"name": "Ann"}}},
+	{ID: "3", SourceID: "s2", Metadata: map[string]any{"lang": "fr", "year": 2025, "note": nil, "tags": []string{}}},
+	{ID: "4", SourceID: "s2", Content: "plain", Metadata: map[string]any{"year": int32(2024), "refs": []map[string]any{{"kind": "book", "n": 1}, {"kind": "web", "n": 2}}}},
+}
+
+// filterCases are checked against the memory driver's results.
+var filterCases = map[string]vectorstore.Filter{
+	"match":        {Must: []vectorstore.Condition{vectorstore.Match{Key: "lang", Value: "en"}}},
+	"match int":    {Must: []vectorstore.Condition{vectorstore.Match{Key: "year", Value: 2024}}},
+	"match int32":  {Must: []vectorstore.Condition{vectorstore.Match{Key: "year", Value: int32(2024)}}},
+	"match uint":   {Must: []vectorstore.Condition{vectorstore.Match{Key: "year", Value: uint(2023)}}},
+	"match column": {Must: []vectorstore.Condition{vectorstore.Match{Key: "source_id", Value: "s2"}}},
+	"should":       {Should: []vectorstore.Condition{vectorstore.Match{Key: "lang", Value: "en"}, vectorstore.Match{Key: "lang", Value: "fr"}}},
+	"must not":     {MustNot: []vectorstore.Condition{vectorstore.Match{Key: "lang", Value: "en"}}},
+	"match any":    {Must: []vectorstore.Condition{vectorstore.MatchAny{Key: "tags", Values: []any{"b", "c"}}}},
+	"match except": {Must: []vectorstore.Condition{vectorstore.MatchExcept{Key: "lang", Values: []any{"en"}}}},
+	"range":        {Must: []vectorstore.Condition{vectorstore.Range{Key: "score", GT: vectorstore.Float(0.5)}}},
+	"range int":    {Must: []vectorstore.Condition{vectorstore.Range{Key: "year", GTE: vectorstore.Float(2024), LT: vectorstore.Float(2025)}}},
+	"is null":      {Must: []vectorstore.Condition{vectorstore.IsNull{Key: "note"}}},
+	"is empty":     {Must: []vectorstore.Condition{vectorstore.IsEmpty{Key: "tags"}}},
+	"nested key":   {Must: []vectorstore.Condition{vectorstore.Match{Key: "author.name", Value: "Ann"}}},
+	"nested": {Must: []vectorstore.Condition{vectorstore.Nested{Key: "refs", Filter: vectorstore.Filter{
+		Must: []vectorstore.Condition{vectorstore.Match{Key: "kind", Value: "web"}, vectorstore.Range{Key: "n", GTE: vectorstore.Float(2)}},
+	}}}},
+}
+
+func TestFilterMatchesMemory(t *testing.T) {
+	compareWithMemory(t, filterPoints, filterCases)
+}
+
+// datetimePoints hold timestamps in every format datetime conditions
+// accept, which do not sort as strings.
+var datetimePoints = []vectorstore.Point{
+	{ID: "date", Metadata: map[string]any{"published": "2024-05-01"}},
+	{ID: "offset", Metadata: map[string]any{"published": "2024-05-01T10:00:00+02:00"}},
+	{ID: "utc", Metadata: map[string]any{"published": time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}},
+	{ID: "zulu", Metadata: map[string]any{"published": "2024-05-01T08:30:00Z"}},
+	{ID: "local", Metadata: map[string]any{"published": "2024-05-01T07:30:00"}},
+	{ID: "invalid", Metadata: map[string]any{"published": "yesterday"}},
+}
+
+func TestDatetimeMatchesMemory(t *testing.T) {
+	cest := time.FixedZone("CEST", 2*60*60)
+	eight := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	compareWithMemory(t, datetimePoints, map[string]vectorstore.Filter{
+		"gte": {Must: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published", GTE: &eight}}},
+		"gt":  {Must: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published", GT: &eight}}},
+		"lt in other zone": {Must: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published",
+			LT: vectorstore.Time(time.Date(2024, 5, 1, 10, 0, 0, 0, cest))}}},
+		"between": {Must: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published",
+			GTE: vectorstore.Time(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+			LTE: vectorstore.Time(time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC))}}},
+		"unbounded":  {Must: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published"}}},
+		"match time": {Must: []vectorstore.Condition{vectorstore.Match{Key: "published", Value: eight}}},
+		"not before": {MustNot: []vectorstore.Condition{vectorstore.DatetimeRange{Key: "published", LT: &eight}}},
+	})
+}
+
+// compareWithMemory stores points in a pgvector and a memory store and
+// checks that each filter selects the same points in both.
+func compareWithMemory(t *testing.T, points []vectorstore.Point, filters map[string]vectorstore.Filter) {
+	t.Helper()
+	c := newTestClient(t)
+	mem := memory.New()
+	ctx := context.Background()
+
+	points = slices.Clone(points)
+	for i := range points {
+		points[i].Vector = []float32{1, 1, 1}
+	}
+	if err := c.Upsert(ctx, points); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Upsert(ctx, points); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, filter := range filters {
+		t.Run(name, func(t *testing.T) {
+			search := vectorstore.SearchFilter{Where: &filter}
+			want, err := mem.Search(ctx, []float32{1, 1, 1}, search, len(points))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := c.Search(ctx, []float32{1, 1, 1}, search, len(points))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(ids(got), ids(want)) {
+				t.Errorf("pgvector = %v, memory = %v", ids(got), ids(want))
+			}
+		})
+	}
+}
+
+// ids returns the sorted IDs of results.
+func ids(results []vectorstore.SearchResult) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	slices.Sort(out)
+	return out
+}
@@ -0,0 +1,354 @@
+package pgvector
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+// mergedPayload rebuilds the Qdrant payload layout for filters that
+// reference the content, source_id or document_id columns.
+const mergedPayload = "(metadata || jsonb_strip_nulls(jsonb_build_object('content', content, 'source_id', source_id, 'document_id', document_id)))"
+
+// buildWhere converts SearchFilter to a WHERE clause with the same semantics
+// as the Qdrant driver. Returns an empty string if there are no conditions.
+func buildWhere(q *query, filter vectorstore.SearchFilter) (string, error) {
+	var conditions []string
+
+	// Filter by source_id(s)
+	if len(filter.SourceIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("source_id IN (%s)", q.list(filter.SourceIDs)))
+	} else if filter.SourceID != "" {
+		// Backward compatibility: single source ID
+		conditions = append(conditions, "source_id = "+q.arg(filter.SourceID))
+	}
+
+	// Filter by document_id(s)
+	if len(filter.DocumentIDs) > 0 {
+		conditions = append(conditions, fmt.Sprintf("document_id IN (%s)", q.list(filter.DocumentIDs)))
+	}
+
+	// Filter by metadata and expression, as a single SQL/JSON path predicate
+	expr := vectorstore.Filter{Must: vectorstore.MetadataConditions(filter.Metadata)}
+	if filter.Where != nil && !filter.Where.IsEmpty() {
+		expr.Must = append(expr.Must, *filter.Where)
+	}
+	if !expr.IsEmpty() {
+		b := &pathBuilder{vars: make(map[string]any)}
+		pred, err := b.filter(expr)
+		if err != nil {
+			return "", err
+		}
+		vars, err := json.Marshal(b.vars)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", vectorstore.ErrInvalidFilter, err)
+		}
+
+		payload := "metadata"
+		if referencesColumns(expr) {
+			payload = mergedPayload
+		}
+		conditions = append(conditions, fmt.Sprintf("jsonb_path_exists(%s, %s::jsonpath, %s::jsonb)",
+			payload, q.arg("$ ? ("+pred+")"), q.arg(string(vars))))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), nil
+}
+
+// pathBuilder compiles filter expressions into SQL/JSON path predicates
+// relative to "@", collecting literal values as path variables.
+//
+// Every leaf is wrapped in exists() or a type check, so it evaluates to
+// true or false and never to unknown; negation then behaves like Qdrant's
+// must_not. Lax mode unwraps arrays, giving Qdrant's any-element semantics.
+type pathBuilder struct {
+	vars map[string]any
+}
+
+// bind registers a variable and returns its reference.
+func (b *pathBuilder) bind(v any) string {
+	name := "v" + strconv.Itoa(len(b.vars)+1)
+	b.vars[name] = v
+	return "$" + name
+}
+
+// filter compiles a Filter.
+func (b *pathBuilder) filter(f vectorstore.Filter) (string, error) {
+	var parts []string
+
+	for _, cond := range f.Must {
+		pred, err := b.condition(cond)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, pred)
+	}
+
+	if len(f.Should) > 0 {
+		should := make([]string, len(f.Should))
+		for i, cond := range f.Should {
+			pred, err := b.condition(cond)
+			if err != nil {
+				return "", err
+			}
+			should[i] = pred
+		}
+		parts = append(parts, "("+strings.Join(should, " || ")+")")
+	}
+
+	for _, cond := range f.MustNot {
+		pred, err := b.condition(cond)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "!("+pred+")")
+	}
+
+	if len(parts) == 0 {
+		return "(1 == 1)", nil
+	}
+	return "(" + strings.Join(parts, " && ") + ")", nil
+}
+
+// condition compiles a single condition.
+func (b *pathBuilder) condition(cond vectorstore.Condition) (string, error) {
+	switch c := cond.(type) {
+	case vectorstore.Filter:
+		return b.filter(c)
+	case vectorstore.Match:
+		return b.match(c.Key, c.Value), nil
+	case vectorstore.MatchAny:
+		typ, refs, err := b.matchValues(c.Values)
+		if err != nil {
+			return "", fmt.Errorf("match any %q: %w", c.Key, err)
+		}
+		eq := make([]string, len(refs))
+		for i, ref := range refs {
+			eq[i] = "@ == " + ref
+		}
+		return b.typed(c.Key, typ, "("+strings.Join(eq, " || ")+")"), nil
+	case vectorstore.MatchExcept:
+		typ, refs, err := b.matchValues(c.Values)
+		if err != nil {
+			return "", fmt.Errorf("match except %q: %w", c.Key, err)
+		}
+		ne := make([]string, len(refs))
+		for i, ref := range refs {
+			ne[i] = "@ != " + ref
+		}
+		return b.typed(c.Key, typ, strings.Join(ne, " && ")), nil
+	case vectorstore.Range:
+		return b.typed(c.Key, "number", b.bounds(
+			floatBound(c.GT), floatBound(c.GTE), floatBound(c.LT), floatBound(c.LTE),
+		)), nil
+	case vectorstore.DatetimeRange:
+		return b.datetime(c.Key, c.GT, c.GTE, c.LT, c.LTE), nil
+	case vectorstore.IsNull:
+		// type() is exempt from array unwrapping, so [null] does not match
+		return fmt.Sprintf(`(%s.type() == "null")`, relPath(c.Key)), nil
+	case vectorstore.IsEmpty:
+		return fmt.Sprintf(`!exists(%s ? (@.type() != "null"))`, relPath(c.Key)), nil
+	case vectorstore.Nested:
+		inner, err := b.filter(c.Filter)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`exists(%s ? (@.type() == "object" && %s))`, relPath(c.Key), inner), nil
+	default:
+		return "", fmt.Errorf("%w: unsupported condition %T", vectorstore.ErrInvalidFilter, cond)
+	}
+}
+
+// match compiles an equality condition, normalized and typed like the
+// Qdrant driver's buildMatchCondition.
+func (b *pathBuilder) match(key string, value any) string {
+	switch v := vectorstore.NormalizeMatchValue(value).(type) {
+	case int64:
+		return b.typed(key, "number", "@ == "+b.bind(v))
+	case float64:
+		return b.typed(key, "number", "@ == "+b.bind(v))
+	case bool:
+		return b.typed(key, "boolean", "@ == "+b.bind(v))
+	case time.Time:
+		return b.datetime(key, nil, &v, nil, &v)
+	default:
+		return b.typed(key, "string", "@ == "+b.bind(fmt.Sprint(v)))
+	}
+}
+
+// matchValues binds MatchAny/MatchExcept values and returns their JSON type.
+func (b *pathBuilder) matchValues(values []any) (string, []string, error) {
+	keywords, integers, err := vectorstore.MatchValues(values)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var refs []string
+	if keywords != nil {
+		for _, k := range keywords {
+			refs = append(refs, b.bind(k))
+		}
+		return "string", refs, nil
+	}
+	for _, i := range integers {
+		refs = append(refs, b.bind(i))
+	}
+	return "number", refs, nil
+}
+
+// bounds compiles optional range bounds; nil bounds are skipped.
+func (b *pathBuilder) bounds(gt, gte, lt, lte any) string {
+	var parts []string
+	for _, bound := range []struct {
+		op    string
+		value any
+	}{{">", gt}, {">=", gte}, {"<", lt}, {"<=", lte}} {
+		if bound.value != nil {
+			parts = append(parts, "@ "+bound.op+" "+b.bind(bound.value))
+		}
+	}
+	if len(parts) == 0 {
+		return "(1 == 1)"
+	}
+	return strings.Join(parts, " && ")
+}
+
+// datetimeTemplates are the .datetime() templates of the timestamps
+// datetime conditions accept, as the memory driver parses them: RFC 3339
+// with an offset, compared to timestamptz bounds, and RFC 3339 in UTC
+// ("Z"), timestamps without offset (taken as UTC) and dates, compared to
+// timestamp bounds in UTC. Comparing timestamps with and without time zone
+// would depend on the session time zone. A value matching no template
+// makes the comparison unknown, which the filter treats as false.
+var datetimeTemplates = []struct {
+	template string
+	zoned    bool
+}{
+	{`yyyy-mm-dd"T"HH24:MI:SS.USTZH:TZM`, true},
+	{`yyyy-mm-dd"T"HH24:MI:SSTZH:TZM`, true},
+	{`yyyy-mm-dd"T"HH24:MI:SS.US"Z"`, false},
+	{`yyyy-mm-dd"T"HH24:MI:SS"Z"`, false},
+	{`yyyy-mm-dd"T"HH24:MI:SS`, false},
+	{`yyyy-mm-dd`, false},
+}
+
+// Layouts and templates of the bounds of datetime conditions, bound once
+// with an offset and once in UTC without
+const (
+	zonedBoundLayout   = "2006-01-02T15:04:05.000000-07:00"
+	zonedBoundTemplate = `yyyy-mm-dd"T"HH24:MI:SS.USTZH:TZM`
+	utcBoundLayout     = "2006-01-02T15:04:05.000000"
+	utcBoundTemplate   = `yyyy-mm-dd"T"HH24:MI:SS.US`
+)
+
+// datetime compiles a comparison of the timestamps under key with optional
+// bounds, on parsed timestamps rather than strings; nil bounds are skipped.
+func (b *pathBuilder) datetime(key string, gt, gte, lt, lte *time.Time) string {
+	type bound struct {
+		op         string
+		zoned, utc string // Variable references
+	}
+	var bounds []bound
+	for _, bd := range []struct {
+		op string
+		t  *time.Time
+	}{{">", gt}, {">=", gte}, {"<", lt}, {"<=", lte}} {
+		if bd.t != nil {
+			t := bd.t.UTC()
+			bounds = append(bounds, bound{bd.op, b.bind(t.Format(zonedBoundLayout)), b.bind(t.Format(utcBoundLayout))})
+		}
+	}
+
+	alternatives := make([]string, len(datetimeTemplates))
+	for i, tmpl := range datetimeTemplates {
+		value := fmt.Sprintf("@.datetime(%q)", tmpl.template)
+		if len(bounds) == 0 {
+			alternatives[i] = "exists(" + value + ")"
+			continue
+		}
+		parts := make([]string, len(bounds))
+		for j, bd := range bounds {
+			if tmpl.zoned {
+				parts[j] = fmt.Sprintf("%s %s %s.datetime(%q)", value, bd.op, bd.zoned, zonedBoundTemplate)
+			} else {
+				parts[j] = fmt.Sprintf("%s %s %s.datetime(%q)", value, bd.op, bd.utc, utcBoundTemplate)
+			}
+		}
+		alternatives[i] = "(" + strings.Join(parts, " && ") + ")"
+	}
+	return b.typed(key, "string", "("+strings.Join(alternatives, " || ")+")")
+}
+
+// typed wraps a predicate on the values under key, restricted to a JSON type.
+func (b *pathBuilder) typed(key, typ, pred string) string {
+	return fmt.Sprintf(`exists(%s ? (@.type() == %q && %s))`, relPath(key), typ, pred)
+}
+
+// floatBound returns the bound value, or nil (untyped) if unset.
+func floatBound(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// relPath converts a dotted payload key into a quoted path relative to "@".
+// A "[]" suffix on a segment is dropped since lax mode unwraps arrays.
+func relPath(key string) string {
+	var b strings.Builder
+	b.WriteString("@")
+	for _, part := range strings.Split(key, ".") {
+		part = strings.TrimSuffix(part, "[]")
+		b.WriteString(`."`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(part))
+		b.WriteString(`"`)
+	}
+	return b.String()
+}
+
+// referencesColumns reports whether any top-level key of the expression
+// refers to a payload field stored in its own column.
+func referencesColumns(f vectorstore.Filter) bool {
+	for _, list := range [][]vectorstore.Condition{f.Must, f.Should, f.MustNot} {
+		for _, cond := range list {
+			var key string
+			switch c := cond.(type) {
+			case vectorstore.Filter:
+				if referencesColumns(c) {
+					return true
+				}
+				continue
+			case vectorstore.Match:
+				key = c.Key
+			case vectorstore.MatchAny:
+				key = c.Key
+			case vectorstore.MatchExcept:
+				key = c.Key
+			case vectorstore.Range:
+				key = c.Key
+			case vectorstore.DatetimeRange:
+				key = c.Key
+			case vectorstore.IsNull:
+				key = c.Key
+			case vectorstore.IsEmpty:
+				key = c.Key
+			case vectorstore.Nested:
+				key = c.Key
+			}
+
+			root, _, _ := strings.Cut(key, ".")
+			switch strings.TrimSuffix(root, "[]") {
+			case vectorstore.PayloadContent, vectorstore.PayloadSourceID, vectorstore.PayloadDocumentID:
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package pgvector
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/vectorstore"
+)
+
+func TestMatchNumericKinds(t *testing.T) {
+	tests := []struct {
+		value any
+		typ   string
+		want  any
+	}{
+		{42, "number", int64(42)},
+		{int32(42), "number", int64(42)},
+		{uint(42), "number", int64(42)},
+		{uint64(42), "number", int64(42)},
+		{float32(0.5), "number", 0.5},
+		{true, "boolean", true},
+		{"en", "string", "en"},
+	}
+	for _, tt := range tests {
+		b := &pathBuilder{vars: make(map[string]any)}
+		pred := b.match("key", tt.value)
+		if want := `exists(@."key" ? (@.type() == "` + tt.typ + `" && @ == $v1))`; pred != want {
+			t.Errorf("match(%#v) = %s, want %s", tt.value, pred, want)
+		}
+		if got := b.vars["v1"]; got != tt.want {
+			t.Errorf("match(%#v) binds %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBuildWhereMetadata(t *testing.T) {
+	q := &query{}
+	where, err := buildWhere(q, vectorstore.SearchFilter{
+		SourceIDs: []string{"s1", "s2"},
+		Metadata:  map[string]any{"year": int32(2024)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ` WHERE source_id IN ($1, $2) AND jsonb_path_exists(metadata, $3::jsonpath, $4::jsonb)`
+	if where != want {
+		t.Errorf("where = %s, want %s", where, want)
+	}
+	if vars := q.args[3]; vars != `{"v1":2024}` {
+		t.Errorf("vars = %v", vars)
+	}
+}
+
+func TestDatetimeRange(t *testing.T) {
+	from := time.Date(2024, 5, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	b := &pathBuilder{vars: make(map[string]any)}
+	pred, err := b.condition(vectorstore.DatetimeRange{Key: "published", GTE: &from})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bounds are bound in UTC, with and without offset
+	if got := b.vars["v1"]; got != "2024-05-01T08:00:00.000000+00:00" {
+		t.Errorf("zoned bound = %v", got)
+	}
+	if got := b.vars["v2"]; got != "2024-05-01T08:00:00.000000" {
+		t.Errorf("UTC bound = %v", got)
+	}
+
+	// Every template is compared to the bound of the same kind
+	for _, tmpl := range datetimeTemplates {
+		ref, boundTemplate := "$v2", utcBoundTemplate
+		if tmpl.zoned {
+			ref, boundTemplate = "$v1", zonedBoundTemplate
+		}
+		want := fmt.Sprintf("@.datetime(%q) >= %s.datetime(%q)", tmpl.template, ref, boundTemplate)
+		if !strings.Contains(pred, want) {
+			t.Errorf("predicate %s does not contain %s", pred, want)
+		}
+	}
+	if !strings.HasPrefix(pred, `exists(@."published" ? (@.type() == "string" && (`) {
+		t.Errorf("predicate = %s", pred)
+	}
+}
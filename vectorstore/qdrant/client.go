@@ -6,9 +6,11 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/creastat/storage/vectorstore"
 	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 // Config holds Qdrant connection configuration.
@@ -21,12 +23,29 @@ type Config struct {
 
 	// APIKey is optional API key for authentication.
 	APIKey string
+
+	// DenseVectorName is the named dense vector to query and write.
+	// Empty uses the collection's default unnamed vector.
+	DenseVectorName string
+
+	// SparseVectorName is the named sparse vector used by HybridSearch.
+	// Empty disables hybrid search.
+	SparseVectorName string
+
+	// SparseModel is the Qdrant inference model used to embed text into the
+	// sparse vector server-side (e.g., "qdrant/bm25"). When set, points
+	// without a Sparse vector are embedded from their Content, HybridQuery.Text
+	// is accepted, and EnsureCollection enables the IDF modifier.
+	SparseModel string
 }
 
 // Client implements vectorstore.VectorStore for Qdrant.
 type Client struct {
-	client         *qdrant.Client
-	collectionName string
+	client           *qdrant.Client
+	collectionName   string
+	denseVectorName  string
+	sparseVectorName string
+	sparseModel      string
 }
 
 // New creates a new Qdrant client.
@@ -71,22 +90,29 @@ func New(cfg Config) (*Client, error) {
 	}
 
 	return &Client{
-		client:         qdrantClient,
-		collectionName: cfg.CollectionName,
+		client:           qdrantClient,
+		collectionName:   cfg.CollectionName,
+		denseVectorName:  cfg.DenseVectorName,
+		sparseVectorName: cfg.SparseVectorName,
+		sparseModel:      cfg.SparseModel,
 	}, nil
 }
 
 // Search implements vectorstore.VectorStore.
 func (c *Client) Search(ctx context.Context, vector []float32, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
 	// Build Qdrant filter
-	qdrantFilter := buildQdrantFilter(filter)
+	qdrantFilter, err := buildQdrantFilter(filter)
+	if err != nil {
+		return nil, err
+	}
 
-    // Perform search using Query method
-    limitUint64 := uint64(limit)
-    points, err := c.client.Query(ctx, &qdrant.QueryPoints{
+	// Perform search using Query method
+	limitUint64 := uint64(limit)
+	points, err := c.client.Query(ctx, &qdrant.QueryPoints{
 		CollectionName: c.collectionName,
 		Query:          qdrant.NewQuery(vector...),
-        Limit:          &limitUint64,
+		Using:          c.denseUsing(),
+		Limit:          &limitUint64,
 		Filter:         qdrantFilter,
 		WithPayload:    qdrant.NewWithPayload(true),
 	})
@@ -94,11 +120,101 @@ func (c *Client) Search(ctx context.Context, vector []float32, filter vectorstor
 		return nil, fmt.Errorf("qdrant search failed: %w", err)
 	}
 
-	// Convert results
+	return toSearchResults(points, filter.MinScore), nil
+}
+
+// HybridSearch implements vectorstore.HybridSearcher.
+// Dense and sparse candidates are fetched as prefetch queries sharing the
+// filter, then fused server-side with RRF or DBSF.
+func (c *Client) HybridSearch(ctx context.Context, query vectorstore.HybridQuery, filter vectorstore.SearchFilter, limit int) ([]vectorstore.SearchResult, error) {
+	request, err := c.buildHybridQuery(query, filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := c.client.Query(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("qdrant hybrid search failed: %w", err)
+	}
+
+	return toSearchResults(points, filter.MinScore), nil
+}
+
+// buildHybridQuery converts a hybrid query to a Qdrant query fusing a dense
+// and a sparse prefetch query.
+func (c *Client) buildHybridQuery(query vectorstore.HybridQuery, filter vectorstore.SearchFilter, limit int) (*qdrant.QueryPoints, error) {
+	qdrantFilter, err := buildQdrantFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	prefetchLimit := uint64(query.PrefetchLimit)
+	if prefetchLimit == 0 {
+		prefetchLimit = uint64(limit) * 4
+	}
+
+	var prefetch []*qdrant.PrefetchQuery
+	if len(query.Dense) > 0 {
+		prefetch = append(prefetch, &qdrant.PrefetchQuery{
+			Query:  qdrant.NewQueryDense(query.Dense),
+			Using:  c.denseUsing(),
+			Filter: qdrantFilter,
+			Limit:  &prefetchLimit,
+		})
+	}
+
+	if query.Sparse != nil || query.Text != "" {
+		if c.sparseVectorName == "" {
+			return nil, vectorstore.ErrSparseDisabled
+		}
+
+		var sparseQuery *qdrant.Query
+		switch {
+		case query.Sparse != nil:
+			sparseQuery = qdrant.NewQuerySparse(query.Sparse.Indices, query.Sparse.Values)
+		case c.sparseModel != "":
+			sparseQuery = qdrant.NewQueryNearest(qdrant.NewVectorInputDocument(&qdrant.Document{
+				Text:  query.Text,
+				Model: c.sparseModel,
+			}))
+		default:
+			return nil, fmt.Errorf("%w: text queries require a sparse model", vectorstore.ErrSparseDisabled)
+		}
+
+		prefetch = append(prefetch, &qdrant.PrefetchQuery{
+			Query:  sparseQuery,
+			Using:  qdrant.PtrOf(c.sparseVectorName),
+			Filter: qdrantFilter,
+			Limit:  &prefetchLimit,
+		})
+	}
+
+	if len(prefetch) == 0 {
+		return nil, vectorstore.ErrEmptyQuery
+	}
+
+	fusion, err := qdrantFusion(query.Fusion)
+	if err != nil {
+		return nil, err
+	}
+
+	limitUint64 := uint64(limit)
+	return &qdrant.QueryPoints{
+		CollectionName: c.collectionName,
+		Prefetch:       prefetch,
+		Query:          qdrant.NewQueryFusion(fusion),
+		Limit:          &limitUint64,
+		WithPayload:    qdrant.NewWithPayload(true),
+	}, nil
+}
+
+// toSearchResults converts scored points to search results, dropping those
+// below minScore.
+func toSearchResults(points []*qdrant.ScoredPoint, minScore float32) []vectorstore.SearchResult {
 	results := make([]vectorstore.SearchResult, 0, len(points))
 	for _, point := range points {
 		// Apply min score filter
-		if filter.MinScore > 0 && point.Score < filter.MinScore {
+		if minScore > 0 && point.Score < minScore {
 			continue
 		}
 
@@ -120,15 +236,15 @@ func (c *Client) Search(ctx context.Context, vector []float32, filter vectorstor
 		if point.Payload != nil {
 			for k, v := range point.Payload {
 				switch k {
-				case "content":
+				case vectorstore.PayloadContent:
 					if str := v.GetStringValue(); str != "" {
 						result.Content = str
 					}
-				case "source_id":
+				case vectorstore.PayloadSourceID:
 					if str := v.GetStringValue(); str != "" {
 						result.SourceID = str
 					}
-				case "document_id":
+				case vectorstore.PayloadDocumentID:
 					if str := v.GetStringValue(); str != "" {
 						result.DocumentID = str
 					}
@@ -141,7 +257,130 @@ func (c *Client) Search(ctx context.Context, vector []float32, filter vectorstor
 		results = append(results, result)
 	}
 
-	return results, nil
+	return results
+}
+
+// Upsert implements vectorstore.VectorStore.
+// IDs must be unsigned integers or UUIDs, as required by Qdrant.
+func (c *Client) Upsert(ctx context.Context, points []vectorstore.Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+
+	qdrantPoints := make([]*qdrant.PointStruct, 0, len(points))
+	for _, p := range points {
+		payload, err := buildPayload(p)
+		if err != nil {
+			return fmt.Errorf("invalid payload for point %s: %w", p.ID, err)
+		}
+		qdrantPoints = append(qdrantPoints, &qdrant.PointStruct{
+			Id:      pointID(p.ID),
+			Vectors: c.buildVectors(p),
+			Payload: payload,
+		})
+	}
+
+	_, err := c.client.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: c.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Points:         qdrantPoints,
+	})
+	if err != nil {
+		return fmt.Errorf("qdrant upsert failed: %w", err)
+	}
+	return nil
+}
+
+// Delete implements vectorstore.VectorStore.
+func (c *Client) Delete(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	pointIDs := make([]*qdrant.PointId, len(ids))
+	for i, id := range ids {
+		pointIDs[i] = pointID(id)
+	}
+
+	_, err := c.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: c.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Points:         qdrant.NewPointsSelectorIDs(pointIDs),
+	})
+	if err != nil {
+		return fmt.Errorf("qdrant delete failed: %w", err)
+	}
+	return nil
+}
+
+// DeleteByFilter implements vectorstore.VectorStore.
+func (c *Client) DeleteByFilter(ctx context.Context, filter vectorstore.SearchFilter) error {
+	qdrantFilter, err := buildQdrantFilter(filter)
+	if err != nil {
+		return err
+	}
+	if qdrantFilter == nil {
+		return vectorstore.ErrEmptyFilter
+	}
+
+	_, err = c.client.Delete(ctx, &qdrant.DeletePoints{
+		CollectionName: c.collectionName,
+		Wait:           qdrant.PtrOf(true),
+		Points:         qdrant.NewPointsSelectorFilter(qdrantFilter),
+	})
+	if err != nil {
+		return fmt.Errorf("qdrant delete by filter failed: %w", err)
+	}
+	return nil
+}
+
+// EnsureCollection implements vectorstore.VectorStore.
+// Uses the configured dense and sparse vector names, and also creates
+// keyword payload indexes on source_id and document_id.
+func (c *Client) EnsureCollection(ctx context.Context, cfg vectorstore.CollectionConfig) error {
+	if cfg.Dimension <= 0 {
+		return vectorstore.ErrInvalidDimension
+	}
+
+	exists, err := c.client.CollectionExists(ctx, c.collectionName)
+	if err != nil {
+		return fmt.Errorf("qdrant collection check failed: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	create, err := c.buildCreateCollection(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = c.client.CreateCollection(ctx, create)
+	if err != nil {
+		return fmt.Errorf("qdrant create collection failed: %w", err)
+	}
+
+	for _, field := range []string{vectorstore.PayloadSourceID, vectorstore.PayloadDocumentID} {
+		_, err := c.client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: c.collectionName,
+			Wait:           qdrant.PtrOf(true),
+			FieldName:      field,
+			FieldType:      qdrant.FieldType_FieldTypeKeyword.Enum(),
+		})
+		if err != nil {
+			return fmt.Errorf("qdrant create index on %s failed: %w", field, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteCollection implements vectorstore.VectorStore.
+func (c *Client) DeleteCollection(ctx context.Context) error {
+	if err := c.client.DeleteCollection(ctx, c.collectionName); err != nil {
+		return fmt.Errorf("qdrant delete collection failed: %w", err)
+	}
+	return nil
 }
 
 // Close implements vectorstore.VectorStore.
@@ -150,48 +389,21 @@ func (c *Client) Close() error {
 }
 
 // buildQdrantFilter converts SearchFilter to Qdrant Filter.
-func buildQdrantFilter(filter vectorstore.SearchFilter) *qdrant.Filter {
+// Returns nil if the filter has no conditions.
+func buildQdrantFilter(filter vectorstore.SearchFilter) (*qdrant.Filter, error) {
 	var conditions []*qdrant.Condition
 
 	// Filter by source_id(s)
 	if len(filter.SourceIDs) > 0 {
-		if len(filter.SourceIDs) == 1 {
-			// Single source ID
-			conditions = append(conditions, &qdrant.Condition{
-				ConditionOneOf: &qdrant.Condition_Field{
-					Field: &qdrant.FieldCondition{
-						Key:   "source_id",
-						Match: &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: filter.SourceIDs[0]}},
-					},
-				},
-			})
-		} else {
-			// Multiple source IDs
-			keywords := make([]string, len(filter.SourceIDs))
-			copy(keywords, filter.SourceIDs)
-			conditions = append(conditions, &qdrant.Condition{
-				ConditionOneOf: &qdrant.Condition_Field{
-					Field: &qdrant.FieldCondition{
-						Key: "source_id",
-						Match: &qdrant.Match{
-							MatchValue: &qdrant.Match_Keywords{
-								Keywords: &qdrant.RepeatedStrings{Strings: keywords},
-							},
-						},
-					},
-				},
-			})
-		}
+		conditions = append(conditions, buildKeywordsCondition(vectorstore.PayloadSourceID, filter.SourceIDs))
 	} else if filter.SourceID != "" {
 		// Backward compatibility: single source ID
-		conditions = append(conditions, &qdrant.Condition{
-			ConditionOneOf: &qdrant.Condition_Field{
-				Field: &qdrant.FieldCondition{
-					Key:   "source_id",
-					Match: &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: filter.SourceID}},
-				},
-			},
-		})
+		conditions = append(conditions, buildKeywordsCondition(vectorstore.PayloadSourceID, []string{filter.SourceID}))
+	}
+
+	// Filter by document_id(s)
+	if len(filter.DocumentIDs) > 0 {
+		conditions = append(conditions, buildKeywordsCondition(vectorstore.PayloadDocumentID, filter.DocumentIDs))
 	}
 
 	// Filter by metadata
@@ -199,28 +411,162 @@ func buildQdrantFilter(filter vectorstore.SearchFilter) *qdrant.Filter {
 		conditions = append(conditions, buildMatchCondition(key, value))
 	}
 
+	// Filter by expression
+	if filter.Where != nil && !filter.Where.IsEmpty() {
+		where, err := buildFilter(*filter.Where)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, qdrant.NewFilterAsCondition(where))
+	}
+
 	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	return &qdrant.Filter{Must: conditions}, nil
+}
+
+// buildFilter translates a filter expression to a Qdrant Filter.
+func buildFilter(filter vectorstore.Filter) (*qdrant.Filter, error) {
+	var err error
+	out := &qdrant.Filter{}
+	if out.Must, err = buildConditions(filter.Must); err != nil {
+		return nil, err
+	}
+	if out.Should, err = buildConditions(filter.Should); err != nil {
+		return nil, err
+	}
+	if out.MustNot, err = buildConditions(filter.MustNot); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// buildConditions translates a list of filter conditions.
+func buildConditions(conditions []vectorstore.Condition) ([]*qdrant.Condition, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	out := make([]*qdrant.Condition, len(conditions))
+	for i, cond := range conditions {
+		c, err := buildCondition(cond)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = c
+	}
+	return out, nil
+}
+
+// buildCondition translates a single filter condition.
+func buildCondition(cond vectorstore.Condition) (*qdrant.Condition, error) {
+	switch c := cond.(type) {
+	case vectorstore.Filter:
+		f, err := buildFilter(c)
+		if err != nil {
+			return nil, err
+		}
+		return qdrant.NewFilterAsCondition(f), nil
+	case vectorstore.Match:
+		return buildMatchCondition(c.Key, c.Value), nil
+	case vectorstore.MatchAny:
+		keywords, integers, err := vectorstore.MatchValues(c.Values)
+		if err != nil {
+			return nil, fmt.Errorf("match any %q: %w", c.Key, err)
+		}
+		if keywords != nil {
+			return qdrant.NewMatchKeywords(c.Key, keywords...), nil
+		}
+		return qdrant.NewMatchInts(c.Key, integers...), nil
+	case vectorstore.MatchExcept:
+		keywords, integers, err := vectorstore.MatchValues(c.Values)
+		if err != nil {
+			return nil, fmt.Errorf("match except %q: %w", c.Key, err)
+		}
+		if keywords != nil {
+			return qdrant.NewMatchExceptKeywords(c.Key, keywords...), nil
+		}
+		return qdrant.NewMatchExceptInts(c.Key, integers...), nil
+	case vectorstore.Range:
+		return qdrant.NewRange(c.Key, &qdrant.Range{Gt: c.GT, Gte: c.GTE, Lt: c.LT, Lte: c.LTE}), nil
+	case vectorstore.DatetimeRange:
+		return qdrant.NewDatetimeRange(c.Key, &qdrant.DatetimeRange{
+			Gt:  timestamp(c.GT),
+			Gte: timestamp(c.GTE),
+			Lt:  timestamp(c.LT),
+			Lte: timestamp(c.LTE),
+		}), nil
+	case vectorstore.IsNull:
+		return qdrant.NewIsNull(c.Key), nil
+	case vectorstore.IsEmpty:
+		return qdrant.NewIsEmpty(c.Key), nil
+	case vectorstore.Nested:
+		f, err := buildFilter(c.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return qdrant.NewNestedFilter(c.Key, f), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported condition %T", vectorstore.ErrInvalidFilter, cond)
+	}
+}
+
+// timestamp converts an optional time to a protobuf timestamp.
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
 		return nil
 	}
+	return timestamppb.New(*t)
+}
 
-	return &qdrant.Filter{Must: conditions}
+// buildKeywordsCondition matches a payload key against one or more keywords.
+func buildKeywordsCondition(key string, values []string) *qdrant.Condition {
+	if len(values) == 1 {
+		return &qdrant.Condition{
+			ConditionOneOf: &qdrant.Condition_Field{
+				Field: &qdrant.FieldCondition{
+					Key:   key,
+					Match: &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: values[0]}},
+				},
+			},
+		}
+	}
+
+	keywords := make([]string, len(values))
+	copy(keywords, values)
+	return &qdrant.Condition{
+		ConditionOneOf: &qdrant.Condition_Field{
+			Field: &qdrant.FieldCondition{
+				Key: key,
+				Match: &qdrant.Match{
+					MatchValue: &qdrant.Match_Keywords{
+						Keywords: &qdrant.RepeatedStrings{Strings: keywords},
+					},
+				},
+			},
+		},
+	}
 }
 
-// buildMatchCondition creates a match condition for a key-value pair.
+// buildMatchCondition creates a match condition for a key-value pair,
+// normalized with vectorstore.NormalizeMatchValue.
+// Qdrant has no float or datetime match, so those become closed ranges.
 func buildMatchCondition(key string, value any) *qdrant.Condition {
 	var match *qdrant.Match
 
-	switch v := value.(type) {
-	case string:
-		match = &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: v}}
-	case int:
-		match = &qdrant.Match{MatchValue: &qdrant.Match_Integer{Integer: int64(v)}}
+	switch v := vectorstore.NormalizeMatchValue(value).(type) {
+	case float64:
+		return qdrant.NewRange(key, &qdrant.Range{Gte: &v, Lte: &v})
+	case time.Time:
+		return qdrant.NewDatetimeRange(key, &qdrant.DatetimeRange{Gte: timestamppb.New(v), Lte: timestamppb.New(v)})
 	case int64:
 		match = &qdrant.Match{MatchValue: &qdrant.Match_Integer{Integer: v}}
 	case bool:
 		match = &qdrant.Match{MatchValue: &qdrant.Match_Boolean{Boolean: v}}
 	default:
-		match = &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: fmt.Sprintf("%v", v)}}
+		match = &qdrant.Match{MatchValue: &qdrant.Match_Keyword{Keyword: fmt.Sprint(v)}}
 	}
 
 	return &qdrant.Condition{
@@ -233,6 +579,135 @@ func buildMatchCondition(key string, value any) *qdrant.Condition {
 	}
 }
 
+// pointID converts a string ID to a Qdrant point ID.
+// Numeric strings become numeric IDs; anything else is sent as a UUID.
+func pointID(id string) *qdrant.PointId {
+	if num, err := strconv.ParseUint(id, 10, 64); err == nil {
+		return qdrant.NewIDNum(num)
+	}
+	return qdrant.NewID(id)
+}
+
+// denseUsing returns the vector name for dense queries, or nil for the
+// default unnamed vector.
+func (c *Client) denseUsing() *string {
+	if c.denseVectorName == "" {
+		return nil
+	}
+	return qdrant.PtrOf(c.denseVectorName)
+}
+
+// buildVectors converts a point's embeddings to Qdrant vectors.
+// The sparse vector is either the point's own or, with a sparse model,
+// a document embedded server-side from Content.
+func (c *Client) buildVectors(p vectorstore.Point) *qdrant.Vectors {
+	if c.denseVectorName == "" && c.sparseVectorName == "" {
+		return qdrant.NewVectorsDense(p.Vector)
+	}
+
+	vectors := make(map[string]*qdrant.Vector, 2)
+	if c.denseVectorName != "" {
+		vectors[c.denseVectorName] = qdrant.NewVectorDense(p.Vector)
+	} else {
+		vectors[""] = qdrant.NewVectorDense(p.Vector)
+	}
+	if c.sparseVectorName != "" {
+		switch {
+		case p.Sparse != nil:
+			vectors[c.sparseVectorName] = qdrant.NewVectorSparse(p.Sparse.Indices, p.Sparse.Values)
+		case c.sparseModel != "":
+			vectors[c.sparseVectorName] = qdrant.NewVectorDocument(&qdrant.Document{
+				Text:  p.Content,
+				Model: c.sparseModel,
+			})
+		}
+	}
+	return qdrant.NewVectorsMap(vectors)
+}
+
+// buildCreateCollection converts a collection config to the request
+// creating the collection, with the configured dense and sparse vector
+// names. Sparse vectors embedded by a model use the IDF modifier.
+func (c *Client) buildCreateCollection(cfg vectorstore.CollectionConfig) (*qdrant.CreateCollection, error) {
+	distance, err := qdrantDistance(cfg.Distance)
+	if err != nil {
+		return nil, err
+	}
+
+	create := &qdrant.CreateCollection{CollectionName: c.collectionName}
+	vectorParams := &qdrant.VectorParams{
+		Size:     uint64(cfg.Dimension),
+		Distance: distance,
+	}
+	if c.denseVectorName != "" {
+		create.VectorsConfig = qdrant.NewVectorsConfigMap(map[string]*qdrant.VectorParams{
+			c.denseVectorName: vectorParams,
+		})
+	} else {
+		create.VectorsConfig = qdrant.NewVectorsConfig(vectorParams)
+	}
+	if c.sparseVectorName != "" {
+		sparseParams := &qdrant.SparseVectorParams{}
+		if c.sparseModel != "" {
+			sparseParams.Modifier = qdrant.Modifier_Idf.Enum()
+		}
+		create.SparseVectorsConfig = qdrant.NewSparseVectorsConfig(map[string]*qdrant.SparseVectorParams{
+			c.sparseVectorName: sparseParams,
+		})
+	}
+	return create, nil
+}
+
+// qdrantFusion maps a vectorstore.Fusion to its Qdrant equivalent.
+func qdrantFusion(f vectorstore.Fusion) (qdrant.Fusion, error) {
+	switch f {
+	case "", vectorstore.FusionRRF:
+		return qdrant.Fusion_RRF, nil
+	case vectorstore.FusionDBSF:
+		return qdrant.Fusion_DBSF, nil
+	default:
+		return qdrant.Fusion_RRF, fmt.Errorf("unsupported fusion: %s", f)
+	}
+}
+
+// qdrantDistance maps a vectorstore.Distance to its Qdrant equivalent.
+func qdrantDistance(d vectorstore.Distance) (qdrant.Distance, error) {
+	switch d {
+	case "", vectorstore.DistanceCosine:
+		return qdrant.Distance_Cosine, nil
+	case vectorstore.DistanceDot:
+		return qdrant.Distance_Dot, nil
+	case vectorstore.DistanceEuclidean:
+		return qdrant.Distance_Euclid, nil
+	default:
+		return qdrant.Distance_UnknownDistance, fmt.Errorf("unsupported distance: %s", d)
+	}
+}
+
+// buildPayload converts a point to a Qdrant payload.
+// Metadata is stored at the top level so Search returns it unchanged.
+func buildPayload(p vectorstore.Point) (map[string]*qdrant.Value, error) {
+	metadata, err := vectorstore.NormalizeMetadata(p.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := qdrant.TryValueMap(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	payload[vectorstore.PayloadContent] = qdrant.NewValueString(p.Content)
+	if p.SourceID != "" {
+		payload[vectorstore.PayloadSourceID] = qdrant.NewValueString(p.SourceID)
+	}
+	if p.DocumentID != "" {
+		payload[vectorstore.PayloadDocumentID] = qdrant.NewValueString(p.DocumentID)
+	}
+
+	return payload, nil
+}
+
 // extractValue extracts a Go value from a Qdrant Value.
 func extractValue(v *qdrant.Value) any {
 	if v == nil {
@@ -248,10 +723,25 @@ func extractValue(v *qdrant.Value) any {
 		return val.DoubleValue
 	case *qdrant.Value_BoolValue:
 		return val.BoolValue
+	case *qdrant.Value_ListValue:
+		list := make([]any, 0, len(val.ListValue.GetValues()))
+		for _, item := range val.ListValue.GetValues() {
+			list = append(list, extractValue(item))
+		}
+		return list
+	case *qdrant.Value_StructValue:
+		fields := make(map[string]any, len(val.StructValue.GetFields()))
+		for k, item := range val.StructValue.GetFields() {
+			fields[k] = extractValue(item)
+		}
+		return fields
 	default:
 		return nil
 	}
 }
 
-// Compile-time check that Client implements VectorStore.
-var _ vectorstore.VectorStore = (*Client)(nil)
+// Compile-time checks that Client implements VectorStore and HybridSearcher.
+var (
+	_ vectorstore.VectorStore    = (*Client)(nil)
+	_ vectorstore.HybridSearcher = (*Client)(nil)
+)
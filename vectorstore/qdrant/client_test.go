@@ -0,0 +1,349 @@
+package qdrant
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/creastat/storage/vectorstore"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestBuildMatchCondition(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value any
+		check func(*qdrant.FieldCondition) bool
+	}{
+		{"int", 42, isInteger(42)},
+		{"int32", int32(42), isInteger(42)},
+		{"uint", uint(42), isInteger(42)},
+		{"uint64", uint64(42), isInteger(42)},
+		{"string", "en", isKeyword("en")},
+		{"bool", true, func(f *qdrant.FieldCondition) bool { return f.GetMatch().GetBoolean() }},
+		{"float32", float32(0.5), func(f *qdrant.FieldCondition) bool {
+			return f.GetRange().GetGte() == 0.5 && f.GetRange().GetLte() == 0.5
+		}},
+		{"time", day, func(f *qdrant.FieldCondition) bool {
+			return f.GetDatetimeRange().GetGte().AsTime().Equal(day) && f.GetDatetimeRange().GetLte().AsTime().Equal(day)
+		}},
+		{"other", struct{ A int }{1}, isKeyword("{1}")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := buildMatchCondition("key", tt.value).GetField()
+			if field == nil || field.GetKey() != "key" || !tt.check(field) {
+				t.Errorf("buildMatchCondition(%#v) = %v", tt.value, field)
+			}
+		})
+	}
+}
+
+func isInteger(want int64) func(*qdrant.FieldCondition) bool {
+	return func(f *qdrant.FieldCondition) bool {
+		i, ok := f.GetMatch().GetMatchValue().(*qdrant.Match_Integer)
+		return ok && i.Integer == want
+	}
+}
+
+func isKeyword(want string) func(*qdrant.FieldCondition) bool {
+	return func(f *qdrant.FieldCondition) bool {
+		k, ok := f.GetMatch().GetMatchValue().(*qdrant.Match_Keyword)
+		return ok && k.Keyword == want
+	}
+}
+
+func TestBuildPayload(t *testing.T) {
+	payload, err := buildPayload(vectorstore.Point{
+		ID:      "1",
+		Content: "hello",
+		Metadata: map[string]any{
+			"lang":                        "en",
+			"page":                        3,
+			vectorstore.PayloadContent:    "shadowed",
+			vectorstore.PayloadSourceID:   "shadowed",
+			vectorstore.PayloadDocumentID: "shadowed",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Metadata is stored at the top level; reserved keys are dropped, and
+	// source_id and document_id only set from the point
+	if len(payload) != 3 {
+		t.Errorf("payload keys = %v, want content, lang and page", payload)
+	}
+	if got := payload[vectorstore.PayloadContent].GetStringValue(); got != "hello" {
+		t.Errorf("content = %q, want hello", got)
+	}
+	if got := payload["lang"].GetStringValue(); got != "en" {
+		t.Errorf("lang = %q, want en", got)
+	}
+	if got := payload["page"].GetIntegerValue(); got != 3 {
+		t.Errorf("page = %d, want 3", got)
+	}
+
+	payload, err = buildPayload(vectorstore.Point{ID: "1", SourceID: "s1", DocumentID: "d1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload[vectorstore.PayloadSourceID].GetStringValue() != "s1" || payload[vectorstore.PayloadDocumentID].GetStringValue() != "d1" {
+		t.Errorf("payload = %v, want source_id s1 and document_id d1", payload)
+	}
+	// Content is always set, even when empty
+	if _, ok := payload[vectorstore.PayloadContent]; !ok {
+		t.Error("payload has no content")
+	}
+
+	if _, err := buildPayload(vectorstore.Point{ID: "1", Metadata: map[string]any{"ch": make(chan int)}}); err == nil {
+		t.Error("buildPayload with an unsupported metadata value succeeded")
+	}
+}
+
+func TestBuildVectors(t *testing.T) {
+	dense := []float32{0.1, 0.2}
+	sparse := &vectorstore.SparseVector{Indices: []uint32{1, 7}, Values: []float32{0.5, 0.25}}
+
+	t.Run("Unnamed", func(t *testing.T) {
+		vectors := (&Client{}).buildVectors(vectorstore.Point{Vector: dense, Sparse: sparse})
+		if got := vectors.GetVector().GetDense().GetData(); !slices.Equal(got, dense) {
+			t.Errorf("dense = %v, want %v", got, dense)
+		}
+		if vectors.GetVectors() != nil {
+			t.Error("unnamed vectors sent as named vectors")
+		}
+	})
+
+	t.Run("Named", func(t *testing.T) {
+		c := &Client{denseVectorName: "dense", sparseVectorName: "sparse"}
+		named := c.buildVectors(vectorstore.Point{Vector: dense, Sparse: sparse}).GetVectors().GetVectors()
+		if got := named["dense"].GetDense().GetData(); !slices.Equal(got, dense) {
+			t.Errorf("dense = %v, want %v", got, dense)
+		}
+		got := named["sparse"].GetSparse()
+		if !slices.Equal(got.GetIndices(), sparse.Indices) || !slices.Equal(got.GetValues(), sparse.Values) {
+			t.Errorf("sparse = %v, want %v", got, sparse)
+		}
+
+		// Without a sparse vector or model, only the dense vector is sent
+		named = c.buildVectors(vectorstore.Point{Vector: dense}).GetVectors().GetVectors()
+		if _, ok := named["sparse"]; ok || len(named) != 1 {
+			t.Errorf("vectors = %v, want only dense", named)
+		}
+	})
+
+	t.Run("UnnamedDenseWithSparse", func(t *testing.T) {
+		c := &Client{sparseVectorName: "sparse"}
+		named := c.buildVectors(vectorstore.Point{Vector: dense, Sparse: sparse}).GetVectors().GetVectors()
+		if got := named[""].GetDense().GetData(); !slices.Equal(got, dense) {
+			t.Errorf("default dense = %v, want %v", got, dense)
+		}
+		if named["sparse"].GetSparse() == nil {
+			t.Error("no sparse vector")
+		}
+	})
+
+	t.Run("SparseModel", func(t *testing.T) {
+		c := &Client{sparseVectorName: "sparse", sparseModel: "qdrant/bm25"}
+		named := c.buildVectors(vectorstore.Point{Vector: dense, Content: "hello"}).GetVectors().GetVectors()
+		doc := named["sparse"].GetDocument()
+		if doc.GetText() != "hello" || doc.GetModel() != "qdrant/bm25" {
+			t.Errorf("sparse document = %v, want hello embedded by qdrant/bm25", doc)
+		}
+
+		// A point's own sparse vector takes precedence over the model
+		named = c.buildVectors(vectorstore.Point{Vector: dense, Sparse: sparse, Content: "hello"}).GetVectors().GetVectors()
+		if named["sparse"].GetSparse() == nil {
+			t.Errorf("sparse = %v, want the point's sparse vector", named["sparse"])
+		}
+	})
+}
+
+func TestPointID(t *testing.T) {
+	if got := pointID("42"); got.GetNum() != 42 || got.GetUuid() != "" {
+		t.Errorf("pointID(42) = %v, want numeric 42", got)
+	}
+	const uuid = "5c56c793-69f3-4fbf-87e6-c4bf54c28c26"
+	if got := pointID(uuid); got.GetUuid() != uuid {
+		t.Errorf("pointID(%s) = %v, want UUID", uuid, got)
+	}
+	// Negative and overflowing numbers are not unsigned integers
+	for _, id := range []string{"-1", "18446744073709551616"} {
+		if got := pointID(id); got.GetUuid() != id {
+			t.Errorf("pointID(%s) = %v, want sent as a UUID", id, got)
+		}
+	}
+}
+
+func TestDeleteByFilterEmpty(t *testing.T) {
+	// The filter is checked before any request is made
+	err := (&Client{}).DeleteByFilter(context.Background(), vectorstore.SearchFilter{})
+	if !errors.Is(err, vectorstore.ErrEmptyFilter) {
+		t.Errorf("DeleteByFilter(empty) = %v, want ErrEmptyFilter", err)
+	}
+}
+
+func TestBuildCreateCollection(t *testing.T) {
+	t.Run("Unnamed", func(t *testing.T) {
+		c := &Client{collectionName: "docs"}
+		create, err := c.buildCreateCollection(vectorstore.CollectionConfig{Dimension: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := create.GetVectorsConfig().GetParams()
+		if create.GetCollectionName() != "docs" || params.GetSize() != 3 || params.GetDistance() != qdrant.Distance_Cosine {
+			t.Errorf("create = %v, want docs with 3 cosine dimensions", create)
+		}
+		if create.GetSparseVectorsConfig() != nil {
+			t.Error("sparse vectors configured without a sparse vector name")
+		}
+	})
+
+	t.Run("Distances", func(t *testing.T) {
+		for distance, want := range map[vectorstore.Distance]qdrant.Distance{
+			vectorstore.DistanceCosine:    qdrant.Distance_Cosine,
+			vectorstore.DistanceDot:       qdrant.Distance_Dot,
+			vectorstore.DistanceEuclidean: qdrant.Distance_Euclid,
+		} {
+			create, err := (&Client{}).buildCreateCollection(vectorstore.CollectionConfig{Dimension: 3, Distance: distance})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := create.GetVectorsConfig().GetParams().GetDistance(); got != want {
+				t.Errorf("%s distance = %v, want %v", distance, got, want)
+			}
+		}
+		if _, err := (&Client{}).buildCreateCollection(vectorstore.CollectionConfig{Dimension: 3, Distance: "manhattan"}); err == nil {
+			t.Error("unsupported distance accepted")
+		}
+	})
+
+	t.Run("Named", func(t *testing.T) {
+		c := &Client{denseVectorName: "dense", sparseVectorName: "sparse"}
+		create, err := c.buildCreateCollection(vectorstore.CollectionConfig{Dimension: 3, Distance: vectorstore.DistanceDot})
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := create.GetVectorsConfig().GetParamsMap().GetMap()["dense"]
+		if params.GetSize() != 3 || params.GetDistance() != qdrant.Distance_Dot {
+			t.Errorf("dense params = %v, want 3 dot dimensions", params)
+		}
+		sparse, ok := create.GetSparseVectorsConfig().GetMap()["sparse"]
+		if !ok {
+			t.Fatal("no sparse vector config")
+		}
+		// Precomputed sparse vectors are used as is
+		if sparse.Modifier != nil {
+			t.Errorf("sparse modifier = %v, want none", sparse.GetModifier())
+		}
+	})
+
+	t.Run("SparseModel", func(t *testing.T) {
+		c := &Client{sparseVectorName: "sparse", sparseModel: "qdrant/bm25"}
+		create, err := c.buildCreateCollection(vectorstore.CollectionConfig{Dimension: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := create.GetSparseVectorsConfig().GetMap()["sparse"].GetModifier(); got != qdrant.Modifier_Idf {
+			t.Errorf("sparse modifier = %v, want IDF", got)
+		}
+	})
+}
+
+func TestBuildHybridQuery(t *testing.T) {
+	c := &Client{collectionName: "docs", denseVectorName: "dense", sparseVectorName: "sparse"}
+	filter := vectorstore.SearchFilter{SourceID: "s1"}
+	query := vectorstore.HybridQuery{
+		Dense:  []float32{0.1, 0.2},
+		Sparse: &vectorstore.SparseVector{Indices: []uint32{3}, Values: []float32{0.5}},
+	}
+
+	request, err := c.buildHybridQuery(query, filter, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.GetCollectionName() != "docs" || request.GetLimit() != 5 || request.GetQuery().GetFusion() != qdrant.Fusion_RRF {
+		t.Errorf("request = %v, want an RRF fusion of docs limited to 5", request)
+	}
+	// The filter applies to the prefetch queries, not the fusion
+	if request.GetFilter() != nil {
+		t.Errorf("fusion filter = %v, want none", request.GetFilter())
+	}
+
+	prefetch := request.GetPrefetch()
+	if len(prefetch) != 2 {
+		t.Fatalf("%d prefetch queries, want 2", len(prefetch))
+	}
+	dense, sparse := prefetch[0], prefetch[1]
+	if dense.GetUsing() != "dense" || !slices.Equal(dense.GetQuery().GetNearest().GetDense().GetData(), query.Dense) {
+		t.Errorf("dense prefetch = %v", dense)
+	}
+	if got := sparse.GetQuery().GetNearest().GetSparse(); sparse.GetUsing() != "sparse" || !slices.Equal(got.GetIndices(), []uint32{3}) {
+		t.Errorf("sparse prefetch = %v", sparse)
+	}
+	for _, p := range prefetch {
+		// The prefetch limit defaults to 4x the limit
+		if p.GetLimit() != 20 {
+			t.Errorf("prefetch limit = %d, want 20", p.GetLimit())
+		}
+		if field := p.GetFilter().GetMust()[0].GetField(); field.GetKey() != vectorstore.PayloadSourceID {
+			t.Errorf("prefetch filter = %v, want source_id", p.GetFilter())
+		}
+	}
+
+	query.Fusion = vectorstore.FusionDBSF
+	query.PrefetchLimit = 7
+	if request, err = c.buildHybridQuery(query, vectorstore.SearchFilter{}, 5); err != nil {
+		t.Fatal(err)
+	}
+	if request.GetQuery().GetFusion() != qdrant.Fusion_DBSF || request.GetPrefetch()[0].GetLimit() != 7 || request.GetPrefetch()[0].GetFilter() != nil {
+		t.Errorf("request = %v, want a DBSF fusion of unfiltered prefetch queries limited to 7", request)
+	}
+
+	query.Fusion = "max"
+	if _, err := c.buildHybridQuery(query, vectorstore.SearchFilter{}, 5); err == nil {
+		t.Error("unsupported fusion accepted")
+	}
+}
+
+func TestBuildHybridQueryText(t *testing.T) {
+	c := &Client{sparseVectorName: "sparse", sparseModel: "qdrant/bm25"}
+	request, err := c.buildHybridQuery(vectorstore.HybridQuery{Text: "red hat"}, vectorstore.SearchFilter{}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefetch := request.GetPrefetch()
+	if len(prefetch) != 1 {
+		t.Fatalf("%d prefetch queries, want 1", len(prefetch))
+	}
+	doc := prefetch[0].GetQuery().GetNearest().GetDocument()
+	if prefetch[0].GetUsing() != "sparse" || doc.GetText() != "red hat" || doc.GetModel() != "qdrant/bm25" {
+		t.Errorf("text prefetch = %v, want red hat embedded by qdrant/bm25", prefetch[0])
+	}
+}
+
+func TestBuildHybridQueryErrors(t *testing.T) {
+	sparse := &vectorstore.SparseVector{Indices: []uint32{1}, Values: []float32{1}}
+	tests := []struct {
+		name   string
+		client *Client
+		query  vectorstore.HybridQuery
+		want   error
+	}{
+		{"Empty", &Client{sparseVectorName: "sparse"}, vectorstore.HybridQuery{}, vectorstore.ErrEmptyQuery},
+		{"SparseWithoutName", &Client{}, vectorstore.HybridQuery{Dense: []float32{1}, Sparse: sparse}, vectorstore.ErrSparseDisabled},
+		{"TextWithoutName", &Client{}, vectorstore.HybridQuery{Text: "hat"}, vectorstore.ErrSparseDisabled},
+		{"TextWithoutModel", &Client{sparseVectorName: "sparse"}, vectorstore.HybridQuery{Text: "hat"}, vectorstore.ErrSparseDisabled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.client.buildHybridQuery(tt.query, vectorstore.SearchFilter{}, 5); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}